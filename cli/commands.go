@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/atotto/clipboard"
+	"github.com/trknhr/chatgpt-dev-utils/internal/chunk"
+	"github.com/trknhr/chatgpt-dev-utils/internal/config"
+	"github.com/trknhr/chatgpt-dev-utils/internal/file"
+	"github.com/trknhr/chatgpt-dev-utils/internal/pairing"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+	"github.com/trknhr/chatgpt-dev-utils/internal/redact"
+	"github.com/trknhr/chatgpt-dev-utils/internal/sink"
+	"github.com/trknhr/chatgpt-dev-utils/internal/templates"
+	"github.com/trknhr/chatgpt-dev-utils/internal/tokens"
+	"github.com/trknhr/chatgpt-dev-utils/internal/ui/components"
+	"github.com/trknhr/chatgpt-dev-utils/internal/utils"
+)
+
+// Exit codes returned by the non-interactive subcommands
+const (
+	exitOK           = 0
+	exitError        = 1
+	exitNotConnected = 2
+	exitSendFailed   = 3
+	exitNoResponse   = 4
+)
+
+const usage = `Usage:
+  cdev [--addr A] [--port P] Start the interactive TUI
+  cdev send  [flags]         Send the rendered prompt to the Chrome extension (or --sink)
+  cdev copy  [flags]         Copy the rendered prompt to the clipboard
+  cdev print [flags]         Print the rendered prompt to stdout
+  cdev pair [--reset]        Show (or regenerate) the extension pairing token
+
+Flags:
+  --template NAME            Template to render (e.g. "Commit Message")
+  --prompt TEXT              Raw template text instead of a named template
+  --files a.go,b.go          Files for a file based prompt (implies --type file)
+  --type file|git            Prompt type (default: git, or file when --files is set)
+  --wait DURATION            send only: how long to wait for the extension (default 5s)
+  --response                 send only: print ChatGPT's reply to stdout
+  --response-timeout DUR     send only: how long to wait for the reply (default 3m)
+  --target ID                send only: client ID of the browser to use, as shown in
+                             the extension popup (default: first available)
+  --sink NAME                send only: extension (default), clipboard, file, stdout,
+                             or http (OpenAI-compatible endpoint from config.yaml)
+  --trust-project            Run the commands of a template from .cdev/templates;
+                             without it such templates are refused
+  --no-redact                Keep secrets found in the prompt instead of replacing
+                             them with [REDACTED:<detector>]
+  --addr ADDR                Address of the WebSocket server (default 127.0.0.1)
+  --port PORT                Port of the WebSocket server (default 32123)
+
+The address and port can also be set in ~/.config/cdev/config.yaml
+(addr, port) or with CDEV_ADDR and CDEV_PORT. When another cdev already
+serves the port, prompts are relayed through it. Set the same port in the
+extension popup, or the extension cannot connect.
+
+Exit codes:
+  0  success
+  1  invalid arguments, rendering error, or prompt over the token budget
+     (with budget.block in config.yaml)
+  2  no extension connected (send)
+  3  the extension was connected but the send failed (send)
+  4  no reply from ChatGPT before --response-timeout (send --response)
+`
+
+// promptOptions holds the flags shared by all subcommands
+type promptOptions struct {
+	template   string
+	prompt     string
+	files      string
+	promptType string
+	wait       time.Duration
+	response   bool
+	respWait   time.Duration
+	target     string
+	sink       string
+	noRedact   bool
+	trust      bool
+}
+
+// runCommand executes a non-interactive subcommand and returns its exit code
+func runCommand(cfg config.Config, name string, args []string, stdout, stderr io.Writer) int {
+	switch name {
+	case "send", "copy", "print":
+	case "pair":
+		return pairCommand(args, stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", name, usage)
+		return exitError
+	}
+
+	opts, err := parsePromptFlags(name, args, &cfg, stderr)
+	if err != nil {
+		return exitError
+	}
+
+	rendered, err := renderPrompt(opts)
+	for _, e := range rendered.Errors {
+		fmt.Fprintf(stderr, "cdev %s: %v\n", name, e)
+	}
+	for _, n := range rendered.Files {
+		fmt.Fprintf(stderr, "cdev %s: %s: %s\n", name, n.Path, n.Note)
+	}
+	var failed utils.CommandErrors
+	if errors.As(err, &failed) {
+		fmt.Fprintf(stderr, "cdev %s: not sent: the template does not allow failed commands\n", name)
+		return exitError
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "cdev %s: %v\n", name, err)
+		return exitError
+	}
+	prompt := rendered.Prompt
+	if !opts.noRedact {
+		found := redact.Current().Find(prompt)
+		for _, f := range found {
+			fmt.Fprintf(stderr, "cdev %s: redacted %s on line %d\n", name, f.Rule, f.Line)
+		}
+		prompt = redact.Apply(prompt, found)
+	}
+
+	budget := tokens.Current()
+	if n, err := budget.Count(prompt); err == nil && budget.Check(n) != tokens.OK {
+		fmt.Fprintf(stderr, "cdev %s: warning: the prompt uses %s\n", name, budget.Describe(n))
+		if budget.Check(n) == tokens.Over && budget.Block && !(name == "send" && opts.sink == sink.NameExtension && partsFit(prompt, budget)) {
+			fmt.Fprintf(stderr, "cdev %s: not sent: the prompt is over the token budget\n", name)
+			return exitError
+		}
+	}
+
+	switch name {
+	case "print":
+		fmt.Fprintln(stdout, prompt)
+	case "copy":
+		if err := clipboard.WriteAll(prompt); err != nil {
+			fmt.Fprintf(stderr, "cdev copy: %v\n", err)
+			return exitError
+		}
+		fmt.Fprintln(stderr, "Copied to clipboard!")
+	case "send":
+		if opts.sink != sink.NameExtension {
+			return sendToSink(cfg, prompt, opts, stdout, stderr)
+		}
+		return sendPrompt(cfg, prompt, opts, stdout, stderr)
+	}
+	return exitOK
+}
+
+// partsFit reports whether prompt, sent to the extension in parts, has no
+// part over the budget
+func partsFit(prompt string, budget tokens.Budget) bool {
+	for _, p := range chunk.Parts(prompt, budget.Part, budget.Counter()) {
+		if n, _ := budget.Count(p); n > budget.Part {
+			return false
+		}
+	}
+	return true
+}
+
+func parsePromptFlags(name string, args []string, cfg *config.Config, stderr io.Writer) (promptOptions, error) {
+	var opts promptOptions
+	fs := flag.NewFlagSet("cdev "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, usage) }
+	fs.StringVar(&opts.template, "template", "", "template name")
+	fs.StringVar(&opts.prompt, "prompt", "", "raw template text")
+	fs.StringVar(&opts.files, "files", "", "comma separated list of files")
+	fs.StringVar(&opts.promptType, "type", "", "prompt type (file or git)")
+	fs.DurationVar(&opts.wait, "wait", 5*time.Second, "time to wait for the extension")
+	fs.BoolVar(&opts.response, "response", false, "print ChatGPT's reply")
+	fs.DurationVar(&opts.respWait, "response-timeout", 3*time.Minute, "time to wait for the reply")
+	fs.StringVar(&opts.target, "target", "", "client ID of the browser to send to")
+	fs.StringVar(&opts.sink, "sink", sink.NameExtension, "where to send the prompt")
+	fs.BoolVar(&opts.noRedact, "no-redact", false, "send secrets found in the prompt as they are")
+	fs.BoolVar(&opts.trust, "trust-project", false, "run the commands of project templates")
+	addServerFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		return opts, errors.New("unexpected arguments")
+	}
+	return opts, nil
+}
+
+// renderPrompt runs the same pipeline as the Final step of the TUI. Failed
+// template commands are handled by the template's on_error policy.
+func renderPrompt(opts promptOptions) (utils.Rendered, error) {
+	promptType := opts.promptType
+	if promptType == "" {
+		promptType = "git"
+		if opts.files != "" {
+			promptType = "file"
+		}
+	}
+	if promptType != "file" && promptType != "git" {
+		return utils.Rendered{}, fmt.Errorf("unknown prompt type %q", promptType)
+	}
+
+	text := opts.prompt
+	policy := templates.PolicyPlaceholder
+	if text == "" {
+		if opts.template == "" {
+			return utils.Rendered{}, errors.New("either --template or --prompt is required")
+		}
+		tmpl, ok := templates.Default().Get(promptType, opts.template)
+		if !ok {
+			return utils.Rendered{}, fmt.Errorf("unknown %s template %q (available: %s)",
+				promptType, opts.template, strings.Join(templates.Names(promptType), ", "))
+		}
+		// Nobody may be watching a hook, so commands from the repository
+		// only run when asked for
+		if tmpl.NeedsConfirmation() && !opts.trust {
+			return utils.Rendered{}, fmt.Errorf("template %q comes from %s and runs commands; pass --trust-project to run them", tmpl.Name, tmpl.Source)
+		}
+		text = tmpl.Body
+		policy = templates.OnError(promptType, opts.template)
+	}
+
+	var selected []*file.FileNode
+	if promptType == "file" {
+		if opts.files == "" {
+			return utils.Rendered{}, errors.New("--files is required for file based prompts")
+		}
+		for _, path := range strings.Split(opts.files, ",") {
+			path = strings.TrimSpace(path)
+			if path == "" {
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				return utils.Rendered{}, err
+			}
+			if info.IsDir() {
+				return utils.Rendered{}, fmt.Errorf("%s is a directory", path)
+			}
+			selected = append(selected, &file.FileNode{Name: filepath.Base(path), Path: path, Selected: true})
+		}
+	}
+
+	return utils.BuildPromptContext(context.Background(), promptType, text, selected, policy, nil)
+}
+
+// pairCommand prints the pairing token the extension needs to connect
+func pairCommand(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("cdev pair", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	reset := fs.Bool("reset", false, "generate a new token; paired extensions must be paired again")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+
+	store, err := pairing.Open(config.TokenPath())
+	if err != nil {
+		fmt.Fprintf(stderr, "cdev pair: %v\n", err)
+		return exitError
+	}
+	token := store.Token()
+	if *reset {
+		if token, err = store.Regenerate(); err != nil {
+			fmt.Fprintf(stderr, "cdev pair: %v\n", err)
+			return exitError
+		}
+	}
+
+	fmt.Fprintf(stdout, "Pairing token: %s\n\n", token)
+	fmt.Fprintln(stdout, "Click the cdev extension icon in Chrome and paste this token.")
+	fmt.Fprintf(stdout, "The token is stored in %s.\n", config.TokenPath())
+	return exitOK
+}
+
+// ackTimeout is how long the extension has to acknowledge a prompt
+const ackTimeout = 5 * time.Second
+
+// sendPrompt starts the WebSocket server (or relays through a running cdev),
+// waits for the extension and delivers the prompt. With --response the reply
+// is streamed to stdout.
+func sendPrompt(cfg config.Config, prompt string, opts promptOptions, stdout, stderr io.Writer) int {
+	store, err := pairing.Open(config.TokenPath())
+	if err != nil {
+		fmt.Fprintf(stderr, "cdev send: pairing token: %v\n", err)
+		return exitSendFailed
+	}
+
+	extension, err := connectExtension(cfg, store)
+	if err != nil {
+		fmt.Fprintf(stderr, "cdev send: %v\n", err)
+		return exitSendFailed
+	}
+
+	if !connected(extension, opts.target) {
+		waitForConnection(extension, opts.wait, opts.target)
+	}
+	if !connected(extension, opts.target) {
+		if opts.target != "" {
+			fmt.Fprintf(stderr, "cdev send: client %q not connected\n", opts.target)
+		} else {
+			fmt.Fprintln(stderr, "cdev send: extension not connected")
+		}
+		return exitNotConnected
+	}
+
+	// Prompts too long for one message are sent in parts
+	budget := tokens.Current()
+	if parts := chunk.Parts(prompt, budget.Part, budget.Counter()); parts != nil {
+		fmt.Fprintf(stderr, "Prompt split into %d parts\n", len(parts)-1)
+		ext := sink.ExtensionSink{Ext: extension, Target: opts.target}
+		delivery, err := ext.SendParts(context.Background(), parts, func(done, total int) {
+			fmt.Fprintf(stderr, "Part %d/%d answered\n", done, total-1)
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "cdev send: %v\n", err)
+			return exitSendFailed
+		}
+		defer delivery.Cancel()
+		return printReplies("extension", delivery.Replies, opts, stdout, stderr)
+	}
+
+	request := protocol.NewPrompt(prompt)
+	request.Target = opts.target
+	replies := extension.Track(request.ID)
+	defer extension.Forget(request.ID)
+
+	sent, err := extension.Send(request)
+	if err != nil || sent == 0 {
+		fmt.Fprintln(stderr, "cdev send: failed to deliver prompt to the extension")
+		return exitSendFailed
+	}
+	return printReplies("extension", replies, opts, stdout, stderr)
+}
+
+// sendToSink delivers the prompt to a sink other than the extension. The
+// reply of an HTTP endpoint is handled like the extension's.
+func sendToSink(cfg config.Config, prompt string, opts promptOptions, stdout, stderr io.Writer) int {
+	sink.Configure(cfg.Sinks, stdout)
+	s, err := sink.ByName(opts.sink, nil, "")
+	if err != nil {
+		fmt.Fprintf(stderr, "cdev send: %v\n", err)
+		return exitError
+	}
+	delivery, err := s.Deliver(prompt)
+	if err != nil {
+		fmt.Fprintf(stderr, "cdev send: %v\n", err)
+		return exitSendFailed
+	}
+	if delivery.Replies == nil {
+		if s.Name() != sink.NameStdout {
+			fmt.Fprintln(stderr, delivery.Status)
+		}
+		return exitOK
+	}
+	defer delivery.Cancel()
+	return printReplies(s.Name(), delivery.Replies, opts, stdout, stderr)
+}
+
+// printReplies waits for the ack from the named sink and, with --response, streams the reply
+func printReplies(name string, replies <-chan protocol.Message, opts promptOptions, stdout, stderr io.Writer) int {
+	timeout := time.After(ackTimeout)
+	acked := false
+	streamed := ""
+	for {
+		select {
+		case m, ok := <-replies:
+			if !ok {
+				fmt.Fprintln(stderr, "cdev send: connection closed before the reply finished")
+				return exitSendFailed
+			}
+			switch m.Type {
+			case protocol.TypeAck:
+				if !opts.response {
+					fmt.Fprintf(stderr, "Sent to %s!\n", name)
+					return exitOK
+				}
+				acked = true
+				timeout = time.After(opts.respWait)
+			case protocol.TypeResponseChunk:
+				fmt.Fprint(stdout, m.Text)
+				streamed += m.Text
+			case protocol.TypeResponseDone:
+				if m.Dropped > 0 {
+					fmt.Fprintln(stdout)
+					fmt.Fprintf(stderr, "cdev send: %d parts of the reply were lost, the reply above is incomplete\n", m.Dropped)
+					return exitSendFailed
+				}
+				// Print whatever the chunks did not cover
+				if strings.HasPrefix(m.Text, streamed) {
+					fmt.Fprint(stdout, m.Text[len(streamed):])
+				} else if streamed == "" {
+					fmt.Fprint(stdout, m.Text)
+				}
+				fmt.Fprintln(stdout)
+				return exitOK
+			case protocol.TypeError:
+				fmt.Fprintf(stderr, "cdev send: %s error: %s\n", name, m.Error)
+				return exitSendFailed
+			}
+		case <-timeout:
+			if !acked {
+				fmt.Fprintf(stderr, "cdev send: the %s did not acknowledge the prompt\n", name)
+				return exitSendFailed
+			}
+			fmt.Fprintln(stderr, "cdev send: timed out waiting for the reply")
+			return exitNoResponse
+		}
+	}
+}
+
+// connected reports whether the target client, or any client when target
+// is empty, is connected
+func connected(extension components.Extension, target string) bool {
+	if target == "" {
+		return extension.Count() > 0
+	}
+	return slices.ContainsFunc(extension.Clients(), func(c protocol.ClientInfo) bool {
+		return c.ID == target
+	})
+}
+
+// waitForConnection blocks until the target (or any) extension client
+// connects or the wait expires
+func waitForConnection(extension components.Extension, wait time.Duration, target string) {
+	timeout := time.After(wait)
+	for {
+		select {
+		case <-extension.Events():
+			if connected(extension, target) {
+				return
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/atotto/clipboard"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trknhr/chatgpt-dev-utils/internal/config"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+	"github.com/trknhr/chatgpt-dev-utils/internal/templates"
+)
+
+func TestRunCommand(t *testing.T) {
+	// freePort returns a port nothing listens on
+	freePort := func(t *testing.T) string {
+		t.Helper()
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer l.Close()
+		_, port, _ := net.SplitHostPort(l.Addr().String())
+		return port
+	}
+	// The copy command reports the clipboard error where there is none
+	copyCode, copyStderr := exitOK, "Copied to clipboard!\n"
+	if err := clipboard.WriteAll("probe"); err != nil {
+		copyCode, copyStderr = exitError, "cdev copy: "+err.Error()+"\n"
+	}
+
+	tests := []struct {
+		name       string
+		command    string
+		args       func(t *testing.T) []string
+		setup      func(t *testing.T)
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name:       "print writes the prompt to stdout",
+			command:    "print",
+			args:       func(t *testing.T) []string { return []string{"--prompt", "Explain $(git rev-parse --sq-quote this)"} },
+			wantCode:   exitOK,
+			wantStdout: "Explain 'this'\n",
+		},
+		{
+			name:       "copy puts the prompt on the clipboard",
+			command:    "copy",
+			args:       func(t *testing.T) []string { return []string{"--prompt", "hello"} },
+			wantCode:   copyCode,
+			wantStderr: copyStderr,
+		},
+		{
+			name:       "unexpected arguments",
+			command:    "print",
+			args:       func(t *testing.T) []string { return []string{"--prompt", "hello", "extra"} },
+			wantCode:   exitError,
+			wantStderr: "unexpected arguments: extra\n",
+		},
+		{
+			name:       "neither template nor prompt",
+			command:    "print",
+			args:       func(t *testing.T) []string { return nil },
+			wantCode:   exitError,
+			wantStderr: "cdev print: either --template or --prompt is required\n",
+		},
+		{
+			name:       "unknown flag",
+			command:    "copy",
+			args:       func(t *testing.T) []string { return []string{"--bogus"} },
+			wantCode:   exitError,
+			wantStderr: "flag provided but not defined: -bogus\n" + usage,
+		},
+		{
+			name:       "unknown template",
+			command:    "print",
+			args:       func(t *testing.T) []string { return []string{"--template", "Nope"} },
+			wantCode:   exitError,
+			wantStderr: "cdev print: unknown git template \"Nope\" (available: Code Review, Commit Message, Change Summary, Custom...)\n",
+		},
+		{
+			name:    "project template without --trust-project",
+			command: "print",
+			setup:   projectTemplate,
+			args: func(t *testing.T) []string {
+				return []string{"--template", "Team"}
+			},
+			wantCode:   exitError,
+			wantStderr: "cdev print: template \"Team\" comes from .cdev/templates/team.md and runs commands; pass --trust-project to run them\n",
+		},
+		{
+			name:    "project template with --trust-project",
+			command: "print",
+			setup:   projectTemplate,
+			args: func(t *testing.T) []string {
+				return []string{"--template", "Team", "--trust-project"}
+			},
+			wantCode:   exitOK,
+			wantStdout: "Team 'ok'\n",
+		},
+		{
+			name:       "help",
+			command:    "help",
+			args:       func(t *testing.T) []string { return nil },
+			wantCode:   exitOK,
+			wantStdout: usage,
+		},
+		{
+			name:       "unknown command",
+			command:    "push",
+			args:       func(t *testing.T) []string { return nil },
+			wantCode:   exitError,
+			wantStderr: "unknown command \"push\"\n\n" + usage,
+		},
+		{
+			name:    "send without an extension",
+			command: "send",
+			args: func(t *testing.T) []string {
+				return []string{"--prompt", "hello", "--wait", "0", "--port", freePort(t)}
+			},
+			wantCode:   exitNotConnected,
+			wantStderr: "cdev send: extension not connected\n",
+		},
+		{
+			name:    "send to a client that is not connected",
+			command: "send",
+			args: func(t *testing.T) []string {
+				return []string{"--prompt", "hello", "--wait", "0", "--port", freePort(t), "--target", "abc"}
+			},
+			wantCode:   exitNotConnected,
+			wantStderr: "cdev send: client \"abc\" not connected\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+			if tt.setup != nil {
+				tt.setup(t)
+			}
+			var stdout, stderr bytes.Buffer
+
+			code := runCommand(config.Default(), tt.command, tt.args(t), &stdout, &stderr)
+
+			assert.Equal(t, tt.wantCode, code)
+			assert.Equal(t, tt.wantStdout, stdout.String())
+			assert.Equal(t, tt.wantStderr, stderr.String())
+		})
+	}
+}
+
+// projectTemplate makes the default registry hold a template from the
+// project template directory
+func projectTemplate(t *testing.T) {
+	r := templates.NewRegistry()
+	r.Add(templates.Template{Kind: "git", Name: "Team", Body: "Team $(git rev-parse --sq-quote ok)", Source: filepath.Join(config.ProjectDir, "templates", "team.md")})
+	previous := templates.Default()
+	templates.SetDefault(r)
+	t.Cleanup(func() { templates.SetDefault(previous) })
+}
+
+func TestPrintReplies(t *testing.T) {
+	tests := []struct {
+		name       string
+		replies    []protocol.Message
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name: "streams the reply",
+			replies: []protocol.Message{
+				{Type: protocol.TypeAck},
+				{Type: protocol.TypeResponseChunk, Text: "Hello"},
+				{Type: protocol.TypeResponseDone, Text: "Hello, world"},
+			},
+			wantCode:   exitOK,
+			wantStdout: "Hello, world\n",
+		},
+		{
+			name: "reports lost parts of the reply",
+			replies: []protocol.Message{
+				{Type: protocol.TypeAck},
+				{Type: protocol.TypeResponseChunk, Text: "Hel"},
+				{Type: protocol.TypeResponseDone, Text: "Hello, world", Dropped: 2},
+			},
+			wantCode:   exitSendFailed,
+			wantStdout: "Hel\n",
+			wantStderr: "cdev send: 2 parts of the reply were lost, the reply above is incomplete\n",
+		},
+		{
+			name:       "connection closed",
+			replies:    []protocol.Message{{Type: protocol.TypeAck}},
+			wantCode:   exitSendFailed,
+			wantStderr: "cdev send: connection closed before the reply finished\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replies := make(chan protocol.Message, len(tt.replies))
+			for _, m := range tt.replies {
+				replies <- m
+			}
+			close(replies)
+			var stdout, stderr bytes.Buffer
+
+			code := printReplies("extension", replies, promptOptions{response: true, respWait: time.Second}, &stdout, &stderr)
+
+			assert.Equal(t, tt.wantCode, code)
+			assert.Equal(t, tt.wantStdout, stdout.String())
+			assert.Equal(t, tt.wantStderr, stderr.String())
+		})
+	}
+}
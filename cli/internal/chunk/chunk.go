@@ -0,0 +1,135 @@
+// Package chunk splits prompts that are too long for one message into a
+// sequence of numbered parts.
+package chunk
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// boundaries start a new segment: a file of a file prompt, a file or a hunk
+// of a diff
+var boundaries = []string{"// File: ", "// Error reading ", "diff --git ", "@@ "}
+
+// header introduces each part; the final instruction follows the last one
+const (
+	header = "Part %d/%d – reply OK only. More parts follow; do not answer until the final message.\n\n"
+	final  = "All %d parts have been sent. Now respond to the request in them as if it had been sent as a single message."
+)
+
+// Parts splits prompt into numbered parts of at most max tokens each, as
+// counted by count, followed by a final instruction message. Parts end at
+// file and diff hunk boundaries where possible, then at line ends. It
+// returns nil if the prompt fits in one message.
+func Parts(prompt string, max int, count func(string) int) []string {
+	if max <= 0 || count(prompt) <= max {
+		return nil
+	}
+	// Leave room for the header of the part
+	room := max - count(fmt.Sprintf(header, 999, 999))
+	if room <= 0 {
+		return nil
+	}
+
+	pieces := Split(prompt, room, count)
+	parts := make([]string, 0, len(pieces)+1)
+	for i, p := range pieces {
+		parts = append(parts, fmt.Sprintf(header, i+1, len(pieces))+p)
+	}
+	return append(parts, fmt.Sprintf(final, len(pieces)))
+}
+
+// Split cuts text into pieces of at most max tokens that join back into
+// text. It cuts at segment boundaries where possible, then at line ends,
+// and only splits a single line that is too long on its own.
+func Split(text string, max int, count func(string) int) []string {
+	var (
+		pieces []string
+		cur    strings.Builder
+		used   int
+	)
+	flush := func() {
+		if cur.Len() > 0 {
+			pieces = append(pieces, cur.String())
+			cur.Reset()
+			used = 0
+		}
+	}
+	add := func(s string, n int) {
+		if used+n > max {
+			flush()
+		}
+		cur.WriteString(s)
+		used += n
+	}
+
+	for _, seg := range segments(text) {
+		if n := count(seg); n <= max {
+			add(seg, n)
+			continue
+		}
+		// The segment alone is too long: pack its lines
+		for _, line := range strings.SplitAfter(seg, "\n") {
+			if line == "" {
+				continue
+			}
+			if n := count(line); n <= max {
+				add(line, n)
+				continue
+			}
+			flush()
+			for _, p := range cut(line, max) {
+				add(p, count(p))
+			}
+		}
+	}
+	flush()
+	return pieces
+}
+
+// segments splits text before each line that starts at a boundary
+func segments(text string) []string {
+	var segs []string
+	start := 0
+	for i := 0; i < len(text); {
+		end := strings.IndexByte(text[i:], '\n')
+		if end < 0 {
+			break
+		}
+		next := i + end + 1
+		if next < len(text) && atBoundary(text[next:]) {
+			segs = append(segs, text[start:next])
+			start = next
+		}
+		i = next
+	}
+	return append(segs, text[start:])
+}
+
+func atBoundary(s string) bool {
+	for _, b := range boundaries {
+		if strings.HasPrefix(s, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// cut splits s into pieces of at most max bytes at rune boundaries. A token
+// spans at least one byte, so each piece is at most max tokens.
+func cut(s string, max int) []string {
+	var pieces []string
+	for len(s) > max {
+		n := max
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		if n == 0 {
+			_, n = utf8.DecodeRuneInString(s)
+		}
+		pieces = append(pieces, s[:n])
+		s = s[n:]
+	}
+	return append(pieces, s)
+}
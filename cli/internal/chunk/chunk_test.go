@@ -0,0 +1,93 @@
+package chunk
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// words counts whitespace separated words as tokens
+func words(s string) int { return len(strings.Fields(s)) }
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		max  int
+		want []string
+	}{
+		{
+			name: "fits",
+			text: "one two\nthree",
+			max:  5,
+			want: []string{"one two\nthree"},
+		},
+		{
+			name: "file boundaries",
+			text: "Review:\n// File: a.go\na a a\n// File: b.go\nb b b\n",
+			max:  7,
+			want: []string{"Review:\n// File: a.go\na a a\n", "// File: b.go\nb b b\n"},
+		},
+		{
+			name: "diff hunks",
+			text: "diff --git a/x b/x\n@@ -1 +1 @@\n-a\n+b\n@@ -9 +9 @@\n-c\n+d\n",
+			max:  6,
+			want: []string{"diff --git a/x b/x\n", "@@ -1 +1 @@\n-a\n+b\n", "@@ -9 +9 @@\n-c\n+d\n"},
+		},
+		{
+			name: "long segment is split at lines",
+			text: "// File: a.go\n1 2\n3 4\n5 6\n",
+			max:  4,
+			want: []string{"// File: a.go\n", "1 2\n3 4\n", "5 6\n"},
+		},
+		{
+			name: "long line is cut at runes",
+			text: "ééééé",
+			max:  4,
+			want: []string{"éé", "éé", "é"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			count := words
+			if tc.name == "long line is cut at runes" {
+				count = func(s string) int { return len(s) }
+			}
+			got := Split(tc.text, tc.max, count)
+
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.text, strings.Join(got, ""))
+			for _, p := range got {
+				assert.LessOrEqual(t, count(p), tc.max)
+			}
+		})
+	}
+}
+
+func TestParts(t *testing.T) {
+	t.Run("short prompts are not split", func(t *testing.T) {
+		assert.Nil(t, Parts("one two three", 100, words))
+	})
+
+	t.Run("numbered parts and a final instruction", func(t *testing.T) {
+		body := "// File: a.go\n" + strings.Repeat("a ", 30) + "\n// File: b.go\n" + strings.Repeat("b ", 30) + "\n"
+
+		parts := Parts(body, 50, words)
+
+		require.Len(t, parts, 3)
+		assert.True(t, strings.HasPrefix(parts[0], "Part 1/2 – reply OK only."))
+		assert.Contains(t, parts[0], "// File: a.go")
+		assert.True(t, strings.HasPrefix(parts[1], "Part 2/2 – reply OK only."))
+		assert.Contains(t, parts[1], "// File: b.go")
+		assert.Equal(t, "All 2 parts have been sent. Now respond to the request in them as if it had been sent as a single message.", parts[2])
+		for _, p := range parts {
+			assert.LessOrEqual(t, words(p), 50)
+		}
+	})
+
+	t.Run("limit too small for the header", func(t *testing.T) {
+		assert.Nil(t, Parts(strings.Repeat("a ", 100), 10, words))
+	})
+}
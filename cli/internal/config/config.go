@@ -0,0 +1,223 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPort is the port the Chrome extension connects to
+const DefaultPort = 32123
+
+// StoreExtensionOrigin is the origin of the extension published on the Chrome Web Store
+const StoreExtensionOrigin = "chrome-extension://bdfinimpohfncpgeokmamgfebfhnkebi"
+
+// Environment variables that override the config files
+const (
+	EnvAddr = "CDEV_ADDR"
+	EnvPort = "CDEV_PORT"
+)
+
+// Config holds the settings read from config.yaml
+type Config struct {
+	// Addr is the interface the WebSocket server binds to
+	Addr string `yaml:"addr"`
+	// Port is the WebSocket server port
+	Port int `yaml:"port"`
+	// AllowedOrigins lists extra chrome-extension:// origins allowed to
+	// connect, e.g. an unpacked development build
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// Sinks configures where prompts can be sent besides the extension
+	Sinks Sinks `yaml:"sinks"`
+	// Budget limits the number of tokens a prompt may use
+	Budget Budget `yaml:"budget"`
+	// Redact removes secrets from prompts before they leave the machine
+	Redact Redact `yaml:"redact"`
+	// Files controls how selected files are put in prompts
+	Files Files `yaml:"files"`
+}
+
+// Files configures the reading of the files put in prompts
+type Files struct {
+	// MaxBytes is the largest file put in a prompt whole; larger files are
+	// cut to their first and last lines. Defaults to 256 KiB.
+	MaxBytes int64 `yaml:"max_bytes"`
+	// Encodings are tried in order on files that are not UTF-8, e.g.
+	// shift_jis or windows-1252. Defaults to shift_jis, euc-jp, gbk, euc-kr
+	// and windows-1252.
+	Encodings []string `yaml:"encodings"`
+}
+
+// Redact configures the secrets removed from prompts
+type Redact struct {
+	// Disabled sends prompts as they are
+	Disabled bool `yaml:"disabled"`
+	// Ignore lists built-in detectors to turn off, e.g. high-entropy
+	Ignore []string `yaml:"ignore"`
+	// Patterns are extra regular expressions to redact
+	Patterns []RedactPattern `yaml:"patterns"`
+}
+
+// RedactPattern is a user detector. If the expression has a capture group,
+// only the first group is redacted.
+type RedactPattern struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+}
+
+// Budget sets the token limit prompts are checked against
+type Budget struct {
+	// Model selects the tokenizer and the default limit
+	Model string `yaml:"model"`
+	// Limit overrides the context window of the model
+	Limit int `yaml:"limit"`
+	// Warn is the share of the limit from which prompts are flagged
+	Warn float64 `yaml:"warn"`
+	// Block refuses to send prompts over the limit instead of warning
+	Block bool `yaml:"block"`
+	// Part is the most tokens one message may use; longer prompts are split
+	// into parts. Defaults to the limit.
+	Part int `yaml:"part"`
+}
+
+// Sinks holds the settings of the prompt outputs
+type Sinks struct {
+	// Default is the sink selected in the Final step
+	Default string `yaml:"default"`
+	// File is the path the file sink writes the prompt to
+	File string `yaml:"file"`
+	// HTTP is an OpenAI-compatible chat completions endpoint
+	HTTP HTTPSink `yaml:"http"`
+}
+
+// HTTPSink configures an OpenAI-compatible chat completions endpoint such as
+// a local llama.cpp or Ollama server
+type HTTPSink struct {
+	// URL of the chat completions endpoint; the sink is disabled when empty
+	URL   string `yaml:"url"`
+	Model string `yaml:"model"`
+	// APIKeyEnv names the environment variable holding the API key, if any
+	APIKeyEnv string `yaml:"api_key_env"`
+}
+
+// ExtensionOrigins returns the Web Store origin plus the configured ones
+func (c Config) ExtensionOrigins() []string {
+	return append([]string{StoreExtensionOrigin}, c.AllowedOrigins...)
+}
+
+// TokenPath is the file the pairing token is stored in
+func TokenPath() string {
+	return filepath.Join(Dir(), "token")
+}
+
+// Default returns the built-in settings: loopback only on the default port
+func Default() Config {
+	return Config{
+		Addr: "127.0.0.1",
+		Port: DefaultPort,
+		Sinks: Sinks{
+			Default: "clipboard",
+			File:    "cdev-prompt.md",
+		},
+		Budget: Budget{
+			Model: "gpt-4o",
+			Warn:  0.8,
+		},
+	}
+}
+
+// ListenAddr returns the host:port the server listens on
+func (c Config) ListenAddr() string {
+	return net.JoinHostPort(c.Addr, strconv.Itoa(c.Port))
+}
+
+// Validate reports settings the server cannot start with
+func (c Config) Validate() error {
+	if c.Port < 1 || c.Port > 65535 {
+		return fmt.Errorf("invalid port %d", c.Port)
+	}
+	if c.Addr != "" && c.Addr != "localhost" && net.ParseIP(c.Addr) == nil {
+		return fmt.Errorf("invalid listen address %q", c.Addr)
+	}
+	return nil
+}
+
+// Load reads the user config, then the project config, then the environment.
+// Later sources override earlier ones; missing files are ignored. The
+// settings that protect prompts and the server are only read from the user
+// config, and setting them in the project config is reported.
+func Load() (Config, error) {
+	cfg := Default()
+	var errs []error
+	if dir := Dir(); dir != "" {
+		errs = append(errs, loadFile(&cfg, filepath.Join(dir, "config.yaml")))
+	}
+	user := cfg
+	project := filepath.Join(ProjectDir, "config.yaml")
+	errs = append(errs, loadFile(&cfg, project))
+	if ignored := keepUserOnly(&cfg, user); len(ignored) > 0 {
+		errs = append(errs, fmt.Errorf("%s: %s ignored, only read from the user config", project, strings.Join(ignored, ", ")))
+	}
+	errs = append(errs, loadEnv(&cfg))
+	return cfg, errors.Join(errs...)
+}
+
+// keepUserOnly restores in cfg the settings a repository must not change
+// from their user values and returns the keys it restored. Redaction
+// patterns of the project are added to the user ones.
+func keepUserOnly(cfg *Config, user Config) []string {
+	var ignored []string
+	keep := func(key string, changed bool, restore func()) {
+		if changed {
+			ignored = append(ignored, key)
+			restore()
+		}
+	}
+	keep("addr", cfg.Addr != user.Addr, func() { cfg.Addr = user.Addr })
+	keep("allowed_origins", !slices.Equal(cfg.AllowedOrigins, user.AllowedOrigins), func() { cfg.AllowedOrigins = user.AllowedOrigins })
+	keep("redact.disabled", cfg.Redact.Disabled != user.Redact.Disabled, func() { cfg.Redact.Disabled = user.Redact.Disabled })
+	keep("redact.ignore", !slices.Equal(cfg.Redact.Ignore, user.Redact.Ignore), func() { cfg.Redact.Ignore = user.Redact.Ignore })
+	keep("sinks.default", cfg.Sinks.Default != user.Sinks.Default, func() { cfg.Sinks.Default = user.Sinks.Default })
+	keep("sinks.file", cfg.Sinks.File != user.Sinks.File, func() { cfg.Sinks.File = user.Sinks.File })
+	keep("sinks.http.url", cfg.Sinks.HTTP.URL != user.Sinks.HTTP.URL, func() { cfg.Sinks.HTTP.URL = user.Sinks.HTTP.URL })
+	keep("sinks.http.api_key_env", cfg.Sinks.HTTP.APIKeyEnv != user.Sinks.HTTP.APIKeyEnv, func() { cfg.Sinks.HTTP.APIKeyEnv = user.Sinks.HTTP.APIKeyEnv })
+	if !slices.Equal(cfg.Redact.Patterns, user.Redact.Patterns) {
+		cfg.Redact.Patterns = append(slices.Clone(user.Redact.Patterns), cfg.Redact.Patterns...)
+	}
+	return ignored
+}
+
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func loadEnv(cfg *Config) error {
+	if addr := os.Getenv(EnvAddr); addr != "" {
+		cfg.Addr = addr
+	}
+	if port := os.Getenv(EnvPort); port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil || p < 1 || p > 65535 {
+			return fmt.Errorf("%s: invalid port %q", EnvPort, port)
+		}
+		cfg.Port = p
+	}
+	return nil
+}
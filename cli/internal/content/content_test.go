@@ -0,0 +1,168 @@
+package content
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+
+	"github.com/trknhr/chatgpt-dev-utils/internal/config"
+)
+
+func TestNew(t *testing.T) {
+	r, err := New(config.Files{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(DefaultMaxBytes), r.MaxBytes)
+
+	r, err = New(config.Files{MaxBytes: 1000, Encodings: []string{"sjis", "klingon"}})
+	assert.ErrorContains(t, err, `files encoding "klingon"`)
+	assert.Equal(t, int64(1000), r.MaxBytes)
+	require.Len(t, r.encodings, 1, "known encodings are kept")
+	assert.Equal(t, "shift_jis", r.encodings[0].name)
+}
+
+func TestRead(t *testing.T) {
+	sjis, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte("// 日本語のコメント\nfunc main() {}\n"))
+	require.NoError(t, err)
+	utf16, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().Bytes([]byte("héllo\nwörld\n"))
+	require.NoError(t, err)
+	lines := strings.Repeat("abcdefghi\n", 100)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		cfg       config.Files
+		want      File
+		wantTrunc string // expected Text of a truncated file
+	}{
+		{
+			name: "utf-8",
+			data: []byte("package a\n"),
+			want: File{Text: "package a\n", Size: 10},
+		},
+		{
+			name: "utf-8 with a byte order mark",
+			data: []byte("\xef\xbb\xbfpackage a\n"),
+			want: File{Text: "package a\n", Size: 13},
+		},
+		{
+			name: "binary",
+			data: []byte("\x7fELF\x02\x01\x01\x00\x00\x00"),
+			want: File{Size: 10, Binary: true},
+		},
+		{
+			name: "shift_jis from the config",
+			data: sjis,
+			cfg:  config.Files{Encodings: []string{"shift_jis", "windows-1252"}},
+			want: File{Text: "// 日本語のコメント\nfunc main() {}\n", Size: int64(len(sjis)), Encoding: "shift_jis"},
+		},
+		{
+			name: "windows-1252 by default",
+			data: []byte("caf\xe9\n"),
+			want: File{Text: "café\n", Size: 5, Encoding: "windows-1252"},
+		},
+		{
+			name: "utf-16 with a byte order mark",
+			data: utf16,
+			want: File{Text: "héllo\nwörld\n", Size: int64(len(utf16)), Encoding: "utf-16le"},
+		},
+		{
+			name: "large files keep their first and last lines",
+			data: []byte(lines),
+			cfg:  config.Files{MaxBytes: 45},
+			want: File{Size: 1000, Truncated: true},
+			// 22 bytes of head and tail hold two whole lines each
+			wantTrunc: "abcdefghi\nabcdefghi\n// ... 960 B truncated ...\nabcdefghi\nabcdefghi\n",
+		},
+		{
+			name: "large files of one line keep whole characters",
+			data: []byte(strings.Repeat("é", 50)),
+			cfg:  config.Files{MaxBytes: 21},
+			want: File{Size: 100, Truncated: true},
+			// 10 bytes from each end, cut on characters
+			wantTrunc: "ééééé\n// ... 80 B truncated ...\nééééé",
+		},
+		{
+			name: "large files in a legacy encoding",
+			data: []byte(strings.Repeat(string(sjis), 10)),
+			cfg:  config.Files{MaxBytes: 2 * int64(len(sjis)), Encodings: []string{"shift_jis"}},
+			want: File{Size: 10 * int64(len(sjis)), Truncated: true, Encoding: "shift_jis"},
+			// Each end holds the file's two lines, the first cut in the head
+			wantTrunc: "// 日本語のコメント\n// ... 315 B truncated ...\nfunc main() {}\n",
+		},
+		{
+			name: "large binary files",
+			data: append([]byte("\x00"), make([]byte, 200)...),
+			cfg:  config.Files{MaxBytes: 50},
+			want: File{Size: 201, Binary: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file")
+			require.NoError(t, os.WriteFile(path, tt.data, 0644))
+			r, err := New(tt.cfg)
+			require.NoError(t, err)
+
+			got, err := r.Read(path)
+			require.NoError(t, err)
+			if tt.want.Truncated {
+				tt.want.Text = tt.wantTrunc
+			}
+			assert.Equal(t, tt.want, got)
+
+			// ReadAll never truncates
+			all, err := r.ReadAll(path)
+			require.NoError(t, err)
+			assert.False(t, all.Truncated)
+		})
+	}
+
+	_, err = Current().Read(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestDefaultEncodings(t *testing.T) {
+	r, err := New(config.Files{})
+	require.NoError(t, err)
+
+	got, err := r.Read(filepath.Join("testdata", "shift_jis.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "shift_jis", got.Encoding)
+	assert.Equal(t, "// 設定ファイルを読み込む\nfunc load() {}\n", got.Text)
+
+	// Bytes no CJK encoding decodes whole fall back to windows-1252
+	path := filepath.Join(t.TempDir(), "latin")
+	require.NoError(t, os.WriteFile(path, []byte("na\xefve caf\xe9\n"), 0644))
+	got, err = r.Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, "windows-1252", got.Encoding)
+	assert.Equal(t, "naïve café\n", got.Text)
+}
+
+func TestNote(t *testing.T) {
+	assert.Equal(t, "", File{Size: 10}.Note())
+	assert.Equal(t, "", File{Size: 10, Encoding: "shift_jis"}.Note(), "converted files are all there")
+	assert.Equal(t, "skipped: binary file, 1.5 KB", File{Size: 1536, Binary: true}.Note())
+	assert.Equal(t, "truncated: first and last lines of 50.0 MB", File{Size: 50 << 20, Truncated: true}.Note())
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		want  string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KB"},
+		{5 << 20, "5.0 MB"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, FormatBytes(tc.bytes))
+	}
+}
@@ -0,0 +1,158 @@
+package file
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Cache keeps the directories read for file trees until they change on
+// disk. Each cached directory is watched with fsnotify.
+type Cache struct {
+	mu      sync.Mutex
+	dirs    map[string]listing
+	pending map[string]bool // dropped directories not reported yet
+	wake    chan struct{}
+	watcher *fsnotify.Watcher
+	changes chan string
+}
+
+// NewCache starts watching for changes. If no watcher can be created,
+// nothing is cached.
+func NewCache() *Cache {
+	c := &Cache{
+		dirs:    map[string]listing{},
+		pending: map[string]bool{},
+		wake:    make(chan struct{}, 1),
+		changes: make(chan string),
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return c
+	}
+	c.watcher = watcher
+	go c.watch()
+	go c.report()
+	return c
+}
+
+var defaultCache = sync.OnceValue(NewCache)
+
+// DefaultCache returns the cache shared by the file trees of the TUI
+func DefaultCache() *Cache {
+	return defaultCache()
+}
+
+// Load is ReadDir through the cache
+func (c *Cache) Load(dir *FileNode, opts Options) ([]*FileNode, error) {
+	key, err := filepath.Abs(dir.Path)
+	if err != nil {
+		return ReadDir(dir, opts)
+	}
+	c.mu.Lock()
+	l, ok := c.dirs[key]
+	c.mu.Unlock()
+	if ok {
+		return l.nodes(dir, opts), nil
+	}
+
+	// Watch before reading so no change is missed
+	watched := c.watcher != nil && c.watcher.Add(key) == nil
+	l, err = readListing(dir)
+	if err != nil {
+		return nil, err
+	}
+	if watched {
+		c.mu.Lock()
+		c.dirs[key] = l
+		c.mu.Unlock()
+	}
+	return l.nodes(dir, opts), nil
+}
+
+// Changes reports the absolute paths of the directories whose cached
+// contents were dropped because they changed on disk. It is nil if nothing
+// is cached.
+func (c *Cache) Changes() <-chan string {
+	if c.watcher == nil {
+		return nil
+	}
+	return c.changes
+}
+
+// Close stops watching
+func (c *Cache) Close() error {
+	if c.watcher == nil {
+		return nil
+	}
+	return c.watcher.Close()
+}
+
+func (c *Cache) watch() {
+	for {
+		select {
+		case ev, ok := <-c.watcher.Events:
+			if !ok {
+				return
+			}
+			dir := filepath.Dir(ev.Name)
+			switch {
+			case slices.Contains(IgnoreFiles, filepath.Base(ev.Name)):
+				// The rules of the whole subtree may have changed
+				c.invalidate(dir, true)
+			case ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename):
+				c.invalidate(ev.Name, true)
+				c.invalidate(dir, false)
+			case ev.Has(fsnotify.Create) || ev.Has(fsnotify.Write):
+				// A written file may have a new size
+				c.invalidate(dir, false)
+			}
+		case _, ok := <-c.watcher.Errors:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// invalidate drops dir, and with subtree the directories below it, and
+// marks each dropped directory to be reported on Changes
+func (c *Cache) invalidate(dir string, subtree bool) {
+	c.mu.Lock()
+	dropped := false
+	for key := range c.dirs {
+		if key == dir || subtree && strings.HasPrefix(key, dir+string(filepath.Separator)) {
+			delete(c.dirs, key)
+			c.pending[key] = true
+			dropped = true
+		}
+	}
+	c.mu.Unlock()
+	if !dropped {
+		return
+	}
+	select {
+	case c.wake <- struct{}{}:
+	default:
+		// report is already woken and takes the new directories too
+	}
+}
+
+// report sends the dropped directories on Changes, in order. A directory
+// dropped again before the reader takes it is reported once, so a slow
+// reader never misses a change and the watcher never waits for it.
+func (c *Cache) report() {
+	for range c.wake {
+		c.mu.Lock()
+		dirs := slices.Sorted(maps.Keys(c.pending))
+		clear(c.pending)
+		c.mu.Unlock()
+		for _, dir := range dirs {
+			c.changes <- dir
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package file
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	// next returns the next changed directory
+	next := func(t *testing.T, c *Cache) string {
+		t.Helper()
+		select {
+		case dir := <-c.Changes():
+			return dir
+		case <-time.After(2 * time.Second):
+			t.Fatal("no change reported")
+			return ""
+		}
+	}
+	names := func(nodes []*FileNode) []string {
+		var out []string
+		for _, n := range nodes {
+			out = append(out, n.Name)
+		}
+		return out
+	}
+
+	t.Run("directories are cached until they change", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), nil, 0644))
+		c := NewCache()
+		t.Cleanup(func() { c.Close() })
+		if c.Changes() == nil {
+			t.Skip("fsnotify is not available")
+		}
+		root := NewTree(dir)
+
+		children, err := c.Load(root, Options{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a.go"}, names(children))
+		assert.Contains(t, c.dirs, dir)
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "b.go"), nil, 0644))
+		assert.Equal(t, dir, next(t, c))
+
+		children, err = c.Load(root, Options{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a.go", "b.go"}, names(children))
+	})
+
+	t.Run("written files update their size", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), nil, 0644))
+		c := NewCache()
+		t.Cleanup(func() { c.Close() })
+		if c.Changes() == nil {
+			t.Skip("fsnotify is not available")
+		}
+		root := NewTree(dir)
+		_, err := c.Load(root, Options{})
+		require.NoError(t, err)
+
+		f, err := os.OpenFile(filepath.Join(dir, "a.go"), os.O_WRONLY, 0)
+		require.NoError(t, err)
+		_, err = f.WriteString("package a\n")
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		assert.Equal(t, dir, next(t, c))
+
+		children, err := c.Load(root, Options{})
+		require.NoError(t, err)
+		require.Len(t, children, 1)
+		assert.Equal(t, int64(10), children[0].Size)
+	})
+
+	t.Run("ignore files invalidate the subtree", func(t *testing.T) {
+		dir := t.TempDir()
+		sub := filepath.Join(dir, "sub")
+		require.NoError(t, os.Mkdir(sub, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(sub, "out.bin"), nil, 0644))
+		c := NewCache()
+		t.Cleanup(func() { c.Close() })
+		if c.Changes() == nil {
+			t.Skip("fsnotify is not available")
+		}
+		root := NewTree(dir)
+		children, err := c.Load(root, Options{})
+		require.NoError(t, err)
+		root.SetChildren(children)
+		children, err = c.Load(root.Children[0], Options{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"out.bin"}, names(children))
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.bin\n"), 0644))
+
+		assert.Equal(t, dir, next(t, c))
+		assert.Equal(t, sub, next(t, c))
+		children, err = c.Load(root, Options{})
+		require.NoError(t, err)
+		root.SetChildren(children)
+		children, err = c.Load(root.Children[0], Options{})
+		require.NoError(t, err)
+		assert.Empty(t, children)
+	})
+
+	t.Run("changes are kept while the reader is behind", func(t *testing.T) {
+		c := NewCache()
+		t.Cleanup(func() { c.Close() })
+		if c.Changes() == nil {
+			t.Skip("fsnotify is not available")
+		}
+		base := t.TempDir()
+		want := map[string]bool{}
+		c.mu.Lock()
+		for i := 0; i < 300; i++ {
+			dir := filepath.Join(base, fmt.Sprint(i))
+			c.dirs[dir] = listing{}
+			want[dir] = true
+		}
+		c.mu.Unlock()
+		for dir := range want {
+			c.invalidate(dir, false)
+		}
+
+		got := map[string]bool{}
+		for len(got) < len(want) {
+			got[next(t, c)] = true
+		}
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("without a watcher nothing is cached", func(t *testing.T) {
+		dir := t.TempDir()
+		c := &Cache{dirs: map[string]listing{}}
+
+		_, err := c.Load(NewTree(dir), Options{})
+
+		require.NoError(t, err)
+		assert.Empty(t, c.dirs)
+		assert.Nil(t, c.Changes())
+	})
+}
+
+func TestSetChildren(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "pkg"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), nil, 0644))
+	root := NewTree(dir)
+	children, err := ReadDir(root, Options{})
+	require.NoError(t, err)
+	root.SetChildren(children)
+	pkg, a := root.Children[0], root.Children[1]
+	pkg.IsOpen, a.Selected = true, true
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.go"), nil, 0644))
+	children, err = ReadDir(root, Options{})
+	require.NoError(t, err)
+	root.SetChildren(children)
+
+	require.Len(t, root.Children, 3)
+	assert.Same(t, pkg, root.Children[0])
+	assert.Same(t, a, root.Children[1])
+	assert.True(t, pkg.IsOpen)
+	assert.True(t, a.Selected)
+	assert.Equal(t, "b.go", root.Children[2].Name)
+	assert.Same(t, root, root.Children[2].Parent)
+}
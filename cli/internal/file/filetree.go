@@ -3,7 +3,9 @@ package file
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 )
@@ -14,28 +16,117 @@ type FileNode struct {
 	IsDir    bool
 	IsOpen   bool
 	Selected bool
+	// Ignored is set for hidden files and files matched by ignore rules;
+	// they are only in the tree when it is built with ShowIgnored
+	Ignored bool
+	// Loaded is set once the children of a directory have been read
+	Loaded bool
+	// Size is the size of a file in bytes
+	Size int64
+	// Ranges are the parts of a selected file to use; nil means the whole
+	// file
+	Ranges []Range
+	// Git is the change git reports for a file, and Changes the number of
+	// changed files below a directory; both are set by GitStatus.Decorate
+	Git      GitState
+	Changes  int
 	Children []*FileNode
 	Parent   *FileNode
+
+	// rel is the path relative to the repository root with forward
+	// slashes; ignore holds the rules that apply to the children
+	rel    string
+	ignore *Ignore
 }
 
-func BuildFileTree(root string) *FileNode {
-	rootNode := &FileNode{
+// Options control which entries a file tree includes
+type Options struct {
+	// ShowIgnored includes hidden and ignored files, marked as Ignored
+	ShowIgnored bool
+}
+
+// skipped are directories that are hidden like ignored files even without
+// an ignore rule
+var skipped = []string{"node_modules", "vendor"}
+
+// NewTree returns the root node of the tree under root with no children
+// loaded. Ignore rules of the directories between the repository root and
+// root apply to the tree.
+func NewTree(root string) *FileNode {
+	top, rel, ignore := repository(root)
+	dir, dirRel := top, ""
+	for _, name := range strings.Split(rel, "/") {
+		if name == "" {
+			continue
+		}
+		ignore = ignore.Extend(dir, dirRel, IgnoreFiles...)
+		dir, dirRel = filepath.Join(dir, name), path.Join(dirRel, name)
+	}
+	return &FileNode{
 		Name:   filepath.Base(root),
 		Path:   root,
 		IsDir:  true,
 		IsOpen: true,
+		rel:    rel,
+		ignore: ignore,
 	}
-	buildFileTreeRecursive(rootNode, root, 0)
+}
+
+func BuildFileTree(root string) *FileNode {
+	return BuildFileTreeWith(root, Options{})
+}
+
+// BuildFileTreeWith reads the whole tree under root at once, following
+// .gitignore files (nested ones included), .git/info/exclude and
+// .cdevignore files. The TUI loads directories lazily with NewTree and a
+// Cache instead.
+func BuildFileTreeWith(root string, opts Options) *FileNode {
+	rootNode := NewTree(root)
+	buildFileTreeRecursive(rootNode, opts)
 	return rootNode
 }
 
-func buildFileTreeRecursive(parent *FileNode, path string, depth int) {
-	if depth > 3 {
+func buildFileTreeRecursive(dir *FileNode, opts Options) {
+	children, err := ReadDir(dir, opts)
+	if err != nil {
 		return
 	}
-	entries, err := os.ReadDir(path)
+	dir.SetChildren(children)
+	for _, child := range dir.Children {
+		if child.IsDir {
+			buildFileTreeRecursive(child, opts)
+		}
+	}
+}
+
+// ReadDir reads the children of dir without changing it, so it can run in
+// the background. Use SetChildren to add them to the tree.
+func ReadDir(dir *FileNode, opts Options) ([]*FileNode, error) {
+	listing, err := readListing(dir)
 	if err != nil {
-		return
+		return nil, err
+	}
+	return listing.nodes(dir, opts), nil
+}
+
+// listing is a directory read from disk with the ignore rules of its
+// children
+type listing struct {
+	ignore  *Ignore
+	entries []listingEntry
+}
+
+type listingEntry struct {
+	name    string
+	isDir   bool
+	size    int64
+	ignored bool // hidden or matched by a rule
+}
+
+func readListing(dir *FileNode) (listing, error) {
+	entries, err := os.ReadDir(dir.Path)
+	if err != nil {
+		return listing{}, err
 	}
 	// Sort entries: directories first, then files
 	sort.Slice(entries, func(i, j int) bool {
@@ -44,25 +135,74 @@ func buildFileTreeRecursive(parent *FileNode, path string, depth int) {
 		}
 		return entries[i].Name() < entries[j].Name()
 	})
+	l := listing{ignore: dir.ignore.Extend(dir.Path, dir.rel, IgnoreFiles...)}
 	for _, entry := range entries {
-		if strings.HasPrefix(entry.Name(), ".") ||
-			entry.Name() == "node_modules" ||
-			entry.Name() == "vendor" {
+		if entry.Name() == ".git" {
 			continue
 		}
-		childPath := filepath.Join(path, entry.Name())
-		child := &FileNode{
-			Name:   entry.Name(),
-			Path:   childPath,
-			IsDir:  entry.IsDir(),
-			IsOpen: false,
-			Parent: parent,
+		var size int64
+		if info, err := entry.Info(); err == nil && !entry.IsDir() {
+			size = info.Size()
 		}
-		parent.Children = append(parent.Children, child)
-		if entry.IsDir() {
-			buildFileTreeRecursive(child, childPath, depth+1)
+		l.entries = append(l.entries, listingEntry{
+			name:  entry.Name(),
+			isDir: entry.IsDir(),
+			size:  size,
+			ignored: strings.HasPrefix(entry.Name(), ".") ||
+				entry.IsDir() && slices.Contains(skipped, entry.Name()) ||
+				l.ignore.Match(path.Join(dir.rel, entry.Name()), entry.IsDir()),
+		})
+	}
+	return l, nil
+}
+
+// nodes returns the entries as children of dir; children of an ignored
+// directory are ignored too
+func (l listing) nodes(dir *FileNode, opts Options) []*FileNode {
+	var children []*FileNode
+	for _, e := range l.entries {
+		ignored := dir.Ignored || e.ignored
+		if ignored && !opts.ShowIgnored {
+			continue
+		}
+		children = append(children, &FileNode{
+			Name:    e.name,
+			Path:    filepath.Join(dir.Path, e.name),
+			IsDir:   e.isDir,
+			Size:    e.size,
+			Ignored: ignored,
+			Parent:  dir,
+			rel:     path.Join(dir.rel, e.name),
+			ignore:  l.ignore,
+		})
+	}
+	return children
+}
+
+// SetChildren replaces the children of dir with ones read by ReadDir.
+// Existing children with the same path are kept, with their selection,
+// open state and loaded children, so the tree can be reloaded in place.
+func (dir *FileNode) SetChildren(children []*FileNode) {
+	existing := make(map[string]*FileNode, len(dir.Children))
+	for _, c := range dir.Children {
+		existing[c.Path] = c
+	}
+	for i, c := range children {
+		if old, ok := existing[c.Path]; ok && old.IsDir == c.IsDir {
+			old.Ignored, old.Size, old.rel, old.ignore = c.Ignored, c.Size, c.rel, c.ignore
+			children[i] = old
 		}
+		children[i].Parent = dir
 	}
+	dir.Children = children
+	dir.Loaded = true
+}
+
+// Snapshot copies what ReadDir needs of dir, so its children can be read in
+// the background while the tree changes. SetChildren puts the children
+// read from the copy back under dir.
+func (dir *FileNode) Snapshot() *FileNode {
+	return &FileNode{Name: dir.Name, Path: dir.Path, IsDir: dir.IsDir, Ignored: dir.Ignored, rel: dir.rel, ignore: dir.ignore}
 }
 
 func FlattenFileTree(root *FileNode) []*FileNode {
@@ -83,8 +223,19 @@ func flattenFileTreeRecursive(node *FileNode, result *[]*FileNode, depth int) {
 }
 
 func RenderFileNode(node *FileNode) string {
+	return RenderFileNodeWith(node, nil)
+}
+
+// RenderFileNodeWith is RenderFileNode with the checkbox states computed by
+// Checks, so rendering many folders does not walk each subtree again
+func RenderFileNodeWith(node *FileNode, checks map[*FileNode]Check) string {
 	depth := GetNodeDepth(node)
 	indent := strings.Repeat("  ", depth)
+	check, ok := checks[node]
+	if !ok {
+		check = node.Check()
+	}
+	checkbox := [...]string{"◯", "◐", "◉"}[check]
 	if node.IsDir {
 		icon := "▶"
 		if node.IsOpen {
@@ -94,14 +245,112 @@ func RenderFileNode(node *FileNode) string {
 		if !node.IsOpen && len(node.Children) > 0 {
 			fileCount = fmt.Sprintf(" (%d items)", len(node.Children))
 		}
-		return fmt.Sprintf("%s%s %s/%s", indent, icon, node.Name, fileCount)
+		changes := ""
+		if !node.IsOpen && node.Changes > 0 {
+			changes = fmt.Sprintf(" [%d changed]", node.Changes)
+		}
+		return fmt.Sprintf("%s%s %s %s/%s%s%s", indent, icon, checkbox, node.Name, fileCount, changes, ignoredMark(node))
 	} else {
-		checkbox := "◯"
-		if node.Selected {
-			checkbox = "◉"
+		return fmt.Sprintf("%s  %s %s%s%s%s", indent, checkbox, node.Name, gitMark(node), rangesMark(node), ignoredMark(node))
+	}
+}
+
+// Check is the state of the checkbox of a node
+type Check int
+
+const (
+	Unchecked Check = iota
+	PartlyChecked
+	Checked
+)
+
+// Check returns whether the node is selected. A directory is checked when
+// every file below it is selected and partly checked when some are. Ignored
+// files count only when selected, and files in folders that are not loaded
+// yet count as not selected.
+func (n *FileNode) Check() Check {
+	if !n.IsDir {
+		if n.Selected {
+			return Checked
 		}
-		return fmt.Sprintf("%s  %s %s", indent, checkbox, node.Name)
+		return Unchecked
+	}
+	return checkOf(n.countChecks(nil))
+}
+
+// Checks returns the state of n and of every directory below it, computed
+// in a single pass over the subtree
+func Checks(n *FileNode) map[*FileNode]Check {
+	checks := map[*FileNode]Check{}
+	if n != nil && n.IsDir {
+		n.countChecks(checks)
+	}
+	return checks
+}
+
+// countChecks counts the selected files below n and the files that count
+// towards its state, and whether every folder below it is loaded. With
+// checks, it records the state of each directory it visits.
+func (n *FileNode) countChecks(checks map[*FileNode]Check) (selected, total int, complete bool) {
+	complete = n.Loaded || n.Ignored
+	for _, child := range n.Children {
+		switch {
+		case child.IsDir:
+			s, t, c := child.countChecks(checks)
+			selected, total, complete = selected+s, total+t, complete && c
+		case child.Selected:
+			selected++
+			total++
+		case !child.Ignored:
+			total++
+		}
+	}
+	if checks != nil {
+		checks[n] = checkOf(selected, total, complete)
+	}
+	return selected, total, complete
+}
+
+func checkOf(selected, total int, complete bool) Check {
+	switch {
+	case selected == 0:
+		return Unchecked
+	case selected == total && complete:
+		return Checked
+	}
+	return PartlyChecked
+}
+
+// rangesMark lists the line ranges of a file selected in part
+func rangesMark(node *FileNode) string {
+	if len(node.Ranges) == 0 {
+		return ""
+	}
+	var lines []string
+	for _, r := range node.Ranges {
+		if r.From == r.To {
+			lines = append(lines, fmt.Sprint(r.From))
+		} else {
+			lines = append(lines, fmt.Sprintf("%d-%d", r.From, r.To))
+		}
+	}
+	return " (lines " + strings.Join(lines, ", ") + ")"
+}
+
+// gitMark shows the change git reports for a file
+func gitMark(node *FileNode) string {
+	if node.Git == GitClean {
+		return ""
+	}
+	return " [" + node.Git.String() + "]"
+}
+
+// ignoredMark flags nodes that are only shown with ShowIgnored
+func ignoredMark(node *FileNode) string {
+	if node.Ignored {
+		return " (ignored)"
 	}
+	return ""
 }
 
 func GetNodeDepth(node *FileNode) int {
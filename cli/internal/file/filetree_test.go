@@ -28,6 +28,99 @@ func TestBuildFileTreeAndFlatten(t *testing.T) {
 
 		flat := FlattenFileTree(tree)
 		assert.Len(t, flat, 2, "expected 2 top-level entries (a.txt, subdir)")
+		assert.Equal(t, int64(5), flat[1].Size, "files have their size")
+	})
+
+	// repo lays out a repository with ignore rules at several levels
+	repo := func(t *testing.T) string {
+		dir := t.TempDir()
+		files := map[string]string{
+			".git/info/exclude":  "secret.txt\n",
+			".gitignore":         "dist/\n*.log\n",
+			".cdevignore":        "fixtures/\n",
+			".env":               "",
+			"main.go":            "",
+			"debug.log":          "",
+			"secret.txt":         "",
+			"dist/app.js":        "",
+			"fixtures/big.json":  "",
+			"node_modules/x.js":  "",
+			"src/.gitignore":     "generated.go\n!keep.log\n",
+			"src/generated.go":   "",
+			"src/keep.log":       "",
+			"src/other.log":      "",
+			"src/handler.go":     "",
+			"src/sub/deep.log":   "",
+			"src/sub/handler.go": "",
+		}
+		for name, content := range files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		}
+		return dir
+	}
+	// paths lists the tree below root with ignored entries marked
+	paths := func(root *FileNode) []string {
+		var out []string
+		var walk func(n *FileNode)
+		walk = func(n *FileNode) {
+			for _, c := range n.Children {
+				rel, _ := filepath.Rel(root.Path, c.Path)
+				rel = filepath.ToSlash(rel)
+				if c.Ignored {
+					rel += " (ignored)"
+				}
+				out = append(out, rel)
+				walk(c)
+			}
+		}
+		walk(root)
+		return out
+	}
+
+	t.Run("ignore rules are followed", func(t *testing.T) {
+		tree := BuildFileTree(repo(t))
+
+		assert.ElementsMatch(t, []string{
+			"src", "src/sub", "src/sub/handler.go", "src/handler.go", "src/keep.log", "main.go",
+		}, paths(tree))
+	})
+
+	t.Run("ignored and hidden files are shown on demand", func(t *testing.T) {
+		tree := BuildFileTreeWith(repo(t), Options{ShowIgnored: true})
+
+		got := paths(tree)
+		assert.Contains(t, got, "main.go")
+		assert.Contains(t, got, ".env (ignored)")
+		assert.Contains(t, got, "secret.txt (ignored)")
+		assert.Contains(t, got, "dist (ignored)")
+		assert.Contains(t, got, "dist/app.js (ignored)")
+		assert.Contains(t, got, "fixtures (ignored)")
+		assert.Contains(t, got, "node_modules (ignored)")
+		assert.Contains(t, got, "src/generated.go (ignored)")
+		assert.Contains(t, got, "src/sub/deep.log (ignored)")
+		assert.Contains(t, got, "src/keep.log")
+		assert.NotContains(t, got, ".git (ignored)")
+	})
+
+	t.Run("no depth limit", func(t *testing.T) {
+		dir := t.TempDir()
+		deep := filepath.Join(dir, "a", "b", "c", "d", "e", "f")
+		require.NoError(t, os.MkdirAll(deep, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(deep, "deep.go"), nil, 0644))
+
+		tree := BuildFileTree(dir)
+
+		assert.Contains(t, paths(tree), "a/b/c/d/e/f/deep.go")
+	})
+
+	t.Run("rules above a subdirectory root apply", func(t *testing.T) {
+		dir := repo(t)
+
+		tree := BuildFileTree(filepath.Join(dir, "src"))
+
+		assert.ElementsMatch(t, []string{"sub", "sub/handler.go", "handler.go", "keep.log"}, paths(tree))
 	})
 }
 
@@ -39,6 +132,72 @@ func TestRenderFileNode(t *testing.T) {
 	})
 }
 
+func TestCheck(t *testing.T) {
+	// tree returns a loaded folder with a file, an ignored file and a
+	// loaded subfolder with one file
+	tree := func() (dir, a, ignored, sub, b *FileNode) {
+		dir = &FileNode{Name: "dir", IsDir: true, Loaded: true}
+		a = &FileNode{Name: "a.go", Parent: dir}
+		ignored = &FileNode{Name: "debug.log", Parent: dir, Ignored: true}
+		sub = &FileNode{Name: "sub", IsDir: true, Loaded: true, Parent: dir}
+		b = &FileNode{Name: "b.go", Parent: sub}
+		sub.Children = []*FileNode{b}
+		dir.Children = []*FileNode{sub, a, ignored}
+		return dir, a, ignored, sub, b
+	}
+
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{
+			name: "nothing selected",
+			test: func(t *testing.T) {
+				dir, _, _, _, _ := tree()
+				assert.Equal(t, Unchecked, dir.Check())
+				assert.Contains(t, RenderFileNode(dir), "◯ dir/")
+			},
+		},
+		{
+			name: "some files selected",
+			test: func(t *testing.T) {
+				dir, _, _, sub, b := tree()
+				b.Selected = true
+				assert.Equal(t, PartlyChecked, dir.Check())
+				assert.Equal(t, Checked, sub.Check())
+				assert.Equal(t, map[*FileNode]Check{dir: PartlyChecked, sub: Checked}, Checks(dir))
+				assert.Contains(t, RenderFileNode(dir), "◐ dir/")
+			},
+		},
+		{
+			name: "every file selected but the ignored ones",
+			test: func(t *testing.T) {
+				dir, a, _, _, b := tree()
+				a.Selected, b.Selected = true, true
+				assert.Equal(t, Checked, dir.Check())
+				assert.Contains(t, RenderFileNode(dir), "◉ dir/")
+			},
+		},
+		{
+			name: "folders not loaded may hold more files",
+			test: func(t *testing.T) {
+				dir, a, _, sub, b := tree()
+				a.Selected, b.Selected = true, true
+				more := &FileNode{Name: "more", IsDir: true, Parent: sub}
+				sub.Children = append(sub.Children, more)
+				assert.Equal(t, PartlyChecked, dir.Check())
+				checks := Checks(dir)
+				assert.Equal(t, map[*FileNode]Check{dir: PartlyChecked, sub: PartlyChecked, more: Unchecked}, checks)
+				assert.Contains(t, RenderFileNodeWith(sub, checks), "◐ sub/")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, tt.test)
+	}
+}
+
 func TestGetNodeDepth(t *testing.T) {
 	t.Run("grandchild depth", func(t *testing.T) {
 		root := &FileNode{Name: "root", IsDir: true}
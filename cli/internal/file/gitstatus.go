@@ -0,0 +1,114 @@
+package file
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// GitState is the change git reports for a file
+type GitState int
+
+const (
+	GitClean GitState = iota
+	GitModified
+	// GitAdded is a new file in the index
+	GitAdded
+	GitRenamed
+	GitUntracked
+	// GitConflicted is a file with unresolved merge conflicts
+	GitConflicted
+)
+
+// String is the letter git uses for the change, "?" for untracked files
+func (s GitState) String() string {
+	return [...]string{"", "M", "A", "R", "?", "U"}[s]
+}
+
+// GitStatus is the state of the changed files of a repository, by path
+// relative to the repository root with forward slashes. Deleted files are
+// left out, as they are not in the tree.
+type GitStatus map[string]GitState
+
+// ReadGitStatus runs git status in the repository containing dir
+func ReadGitStatus(dir string) (GitStatus, error) {
+	top, _, _ := repository(dir)
+	cmd := exec.Command("git", "-C", top, "status", "--porcelain=v2", "-z", "--untracked-files=all")
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			line, _, _ := strings.Cut(string(exitErr.Stderr), "\n")
+			return nil, fmt.Errorf("git status: %s", strings.TrimPrefix(line, "fatal: "))
+		}
+		return nil, fmt.Errorf("git status: %w", err)
+	}
+	return ParseGitStatus(out), nil
+}
+
+// ParseGitStatus reads the output of git status --porcelain=v2 -z
+func ParseGitStatus(out []byte) GitStatus {
+	status := GitStatus{}
+	entries := bytes.Split(out, []byte{0})
+	for i := 0; i < len(entries); i++ {
+		entry := string(entries[i])
+		kind, _, _ := strings.Cut(entry, " ")
+		switch kind {
+		case "1", "2":
+			// Changed and renamed or copied entries: "1 XY sub mH mI mW hH
+			// hI path", with a score before the path of renames and the
+			// original path in the next entry
+			n := 9
+			if kind == "2" {
+				n = 10
+				i++
+			}
+			fields := strings.SplitN(entry, " ", n)
+			if len(fields) < n {
+				continue
+			}
+			xy, path := fields[1], fields[n-1]
+			switch {
+			case strings.Contains(xy, "D"):
+			case kind == "2":
+				status[path] = GitRenamed
+			case strings.HasPrefix(xy, "A"):
+				status[path] = GitAdded
+			default:
+				status[path] = GitModified
+			}
+		case "u":
+			if fields := strings.SplitN(entry, " ", 11); len(fields) == 11 {
+				status[fields[10]] = GitConflicted
+			}
+		case "?":
+			status[entry[2:]] = GitUntracked
+		}
+	}
+	return status
+}
+
+// Changes counts the changed files below dir
+func (s GitStatus) Changes(dir *FileNode) int {
+	n := 0
+	for path := range s {
+		if dir.rel == "" || strings.HasPrefix(path, dir.rel+"/") {
+			n++
+		}
+	}
+	return n
+}
+
+// Decorate sets the git state of node and of the loaded nodes below it
+func (s GitStatus) Decorate(node *FileNode) {
+	if !node.IsDir {
+		node.Git = s[node.rel]
+		return
+	}
+	node.Changes = s.Changes(node)
+	for _, child := range node.Children {
+		s.Decorate(child)
+	}
+}
@@ -0,0 +1,105 @@
+package file
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGitStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want GitStatus
+	}{
+		{
+			name: "modified in the index or the work tree",
+			out:  "1 .M N... 100644 100644 100644 aaaa aaaa a.go\x001 M. N... 100644 100644 100644 aaaa bbbb b.go\x00",
+			want: GitStatus{"a.go": GitModified, "b.go": GitModified},
+		},
+		{
+			name: "added",
+			out:  "1 A. N... 000000 100644 100644 0000 aaaa pkg/new.go\x00",
+			want: GitStatus{"pkg/new.go": GitAdded},
+		},
+		{
+			name: "renamed, with the original path after it",
+			out:  "2 R. N... 100644 100644 100644 aaaa aaaa R100 c d.go\x00b.go\x00? x\x00",
+			want: GitStatus{"c d.go": GitRenamed, "x": GitUntracked},
+		},
+		{
+			name: "deleted files are left out",
+			out:  "1 D. N... 100644 000000 000000 aaaa 0000 gone.go\x001 .D N... 100644 100644 000000 aaaa aaaa gone2.go\x00",
+			want: GitStatus{},
+		},
+		{
+			name: "conflicted and untracked",
+			out:  "u UU N... 100644 100644 100644 100644 aaaa bbbb cccc both.go\x00? dir/untracked file.txt\x00",
+			want: GitStatus{"both.go": GitConflicted, "dir/untracked file.txt": GitUntracked},
+		},
+		{
+			name: "clean",
+			out:  "",
+			want: GitStatus{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseGitStatus([]byte(tt.out)))
+		})
+	}
+}
+
+func TestReadGitStatus(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	git("init", "-q")
+	write("a.go", "package a\n")
+	write("pkg/b.go", "package pkg\n")
+	write("pkg/c.go", "package pkg\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	write("pkg/b.go", "package pkg // changed\n")
+	write("pkg/new.go", "package pkg\n")
+	write("pkg/staged.go", "package pkg\n")
+	git("add", "pkg/staged.go")
+
+	// Paths are relative to the repository root from a folder in it too
+	status, err := ReadGitStatus(filepath.Join(dir, "pkg"))
+	require.NoError(t, err)
+	assert.Equal(t, GitStatus{"pkg/b.go": GitModified, "pkg/new.go": GitUntracked, "pkg/staged.go": GitAdded}, status)
+
+	tree := BuildFileTree(dir)
+	status.Decorate(tree)
+	var lines []string
+	for _, node := range FlattenFileTree(tree) {
+		lines = append(lines, strings.TrimSpace(RenderFileNode(node)))
+	}
+	assert.Equal(t, []string{"▶ ◯ pkg/ (4 items) [3 changed]", "◯ a.go"}, lines)
+
+	tree.Children[0].IsOpen = true
+	lines = nil
+	for _, node := range FlattenFileTree(tree) {
+		lines = append(lines, strings.TrimSpace(RenderFileNode(node)))
+	}
+	assert.Equal(t, []string{"▼ ◯ pkg/", "◯ b.go [M]", "◯ c.go", "◯ new.go [?]", "◯ staged.go [A]", "◯ a.go"}, lines)
+
+	_, err = ReadGitStatus(t.TempDir())
+	assert.Error(t, err, "outside a repository")
+}
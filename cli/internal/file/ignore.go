@@ -0,0 +1,214 @@
+package file
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFiles are read in every directory of the tree, in this order, so
+// .cdevignore rules override .gitignore ones
+var IgnoreFiles = []string{".gitignore", ".cdevignore"}
+
+// ignoreRule is one line of an ignore file
+type ignoreRule struct {
+	base    string // directory of the ignore file, relative to the repository
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Ignore matches paths against gitignore rules. Rules of later files take
+// precedence, as in git. A nil Ignore has no rules.
+type Ignore struct {
+	rules []ignoreRule
+}
+
+// ParseIgnore parses gitignore patterns from a file in the directory base,
+// given relative to the repository root with forward slashes
+func ParseIgnore(base, content string) *Ignore {
+	ig := &Ignore{}
+	ig.add(base, content)
+	return ig
+}
+
+// Extend returns ig with the rules of the ignore files in dir added. rel is
+// dir relative to the repository root. ig itself is not changed.
+func (ig *Ignore) Extend(dir, rel string, names ...string) *Ignore {
+	next := &Ignore{}
+	if ig != nil {
+		next.rules = ig.rules[:len(ig.rules):len(ig.rules)]
+	}
+	for _, name := range names {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+			next.add(rel, string(data))
+		}
+	}
+	return next
+}
+
+func (ig *Ignore) add(base, content string) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(base, scanner.Text()); ok {
+			ig.rules = append(ig.rules, rule)
+		}
+	}
+}
+
+// Match reports whether the path, relative to the repository root with
+// forward slashes, is ignored. It does not check the parent directories.
+func (ig *Ignore) Match(rel string, isDir bool) bool {
+	if ig == nil {
+		return false
+	}
+	ignored := false
+	for _, rule := range ig.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		p := rel
+		if rule.base != "" {
+			var ok bool
+			if p, ok = strings.CutPrefix(rel, rule.base+"/"); !ok {
+				continue
+			}
+		}
+		if rule.re.MatchString(p) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+func parseIgnoreLine(base, line string) (ignoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	rule := ignoreRule{base: path.Clean("/" + base)[1:]}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	// A slash anywhere but at the end anchors the pattern to base
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	re, err := regexp.Compile(globToRegexp(line, anchored))
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.re = re
+	return rule, true
+}
+
+// globToRegexp translates a gitignore glob to a regular expression
+func globToRegexp(glob string, anchored bool) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	if !anchored {
+		sb.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**") && i+2 == len(glob) && (i == 0 || glob[i-1] == '/'):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+// repository finds the git repository containing dir. It returns the
+// repository root, dir relative to it and the rules of .git/info/exclude.
+// Outside a repository dir is its own root.
+func repository(dir string) (string, string, *Ignore) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return dir, "", &Ignore{}
+	}
+	for top := abs; ; {
+		if gitDir, ok := findGitDir(top); ok {
+			rel, _ := filepath.Rel(top, abs)
+			rel = filepath.ToSlash(rel)
+			if rel == "." {
+				rel = ""
+			}
+			exclude := (&Ignore{}).Extend(filepath.Join(gitDir, "info"), "", "exclude")
+			return top, rel, exclude
+		}
+		parent := filepath.Dir(top)
+		if parent == top {
+			return dir, "", &Ignore{}
+		}
+		top = parent
+	}
+}
+
+// findGitDir returns the git directory of a repository rooted at dir. In
+// worktrees and submodules .git is a file naming the git directory.
+func findGitDir(dir string) (string, bool) {
+	gitPath := filepath.Join(dir, ".git")
+	info, err := os.Stat(gitPath)
+	if err != nil {
+		return "", false
+	}
+	if info.IsDir() {
+		return gitPath, true
+	}
+	data, err := os.ReadFile(gitPath)
+	if err != nil {
+		return "", false
+	}
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return "", false
+	}
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(dir, gitDir)
+	}
+	return gitDir, true
+}
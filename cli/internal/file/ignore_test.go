@@ -0,0 +1,47 @@
+package file
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIgnoreMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		rules   string
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{name: "extension anywhere", rules: "*.log", path: "a/b/c.log", ignored: true},
+		{name: "leading slash anchors", rules: "/build", path: "build", isDir: true, ignored: true},
+		{name: "anchored does not match deeper", rules: "/build", path: "src/build", isDir: true},
+		{name: "name matches at any depth", rules: "build", path: "src/build", isDir: true, ignored: true},
+		{name: "trailing slash matches directories", rules: "dist/", path: "dist", isDir: true, ignored: true},
+		{name: "trailing slash skips files", rules: "dist/", path: "dist"},
+		{name: "middle slash anchors", rules: "doc/*.txt", path: "x/doc/a.txt"},
+		{name: "star stays in one directory", rules: "doc/*.txt", path: "doc/x/a.txt"},
+		{name: "leading double star", rules: "**/foo", path: "a/b/foo", ignored: true},
+		{name: "middle double star", rules: "a/**/b", path: "a/x/y/b", ignored: true},
+		{name: "middle double star matches no directory", rules: "a/**/b", path: "a/b", ignored: true},
+		{name: "trailing double star", rules: "abc/**", path: "abc/x/y", ignored: true},
+		{name: "trailing double star not the directory", rules: "abc/**", path: "abc", isDir: true},
+		{name: "negation re-includes", rules: "*.log\n!keep.log", path: "keep.log"},
+		{name: "last match wins", rules: "!keep.log\n*.log", path: "keep.log", ignored: true},
+		{name: "comments and blank lines", rules: "# *.go\n\n", path: "main.go"},
+		{name: "escaped hash", rules: `\#notes`, path: "#notes", ignored: true},
+		{name: "negated class", rules: "[!a]b", path: "cb", ignored: true},
+		{name: "negated class excludes", rules: "[!a]b", path: "ab"},
+		{name: "question mark", rules: "?.tmp", path: "a.tmp", ignored: true},
+		{name: "rules apply below their directory", base: "sub", rules: "*.tmp", path: "sub/x/a.tmp", ignored: true},
+		{name: "rules do not apply elsewhere", base: "sub", rules: "*.tmp", path: "a.tmp"},
+		{name: "anchored to their directory", base: "sub", rules: "/out", path: "sub/out", isDir: true, ignored: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.ignored, ParseIgnore(tc.base, tc.rules).Match(tc.path, tc.isDir))
+		})
+	}
+}
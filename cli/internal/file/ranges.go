@@ -0,0 +1,71 @@
+package file
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Range is a part of a file: lines From to To, counted from 1 and
+// inclusive. Label says what the lines hold, such as "func Foo".
+type Range struct {
+	From, To int
+	Label    string
+}
+
+// String describes r as in "lines 40-88, func Foo"
+func (r Range) String() string {
+	s := fmt.Sprintf("lines %d-%d", r.From, r.To)
+	if r.From == r.To {
+		s = fmt.Sprintf("line %d", r.From)
+	}
+	if r.Label != "" {
+		s += ", " + r.Label
+	}
+	return s
+}
+
+// Contains reports whether line is in r
+func (r Range) Contains(line int) bool {
+	return r.From <= line && line <= r.To
+}
+
+// Excerpt returns the lines of content in r. Lines past the end of content
+// are left out.
+func Excerpt(content string, r Range) string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	from, to := max(r.From, 1), min(r.To, len(lines))
+	if from > to {
+		return ""
+	}
+	return strings.Join(lines[from-1:to], "")
+}
+
+// AddRange adds r to the ranges of n, keeping them in order. A range that
+// is already there is not added again.
+func (n *FileNode) AddRange(r Range) {
+	if r.From > r.To {
+		r.From, r.To = r.To, r.From
+	}
+	if slices.ContainsFunc(n.Ranges, func(o Range) bool { return o.From == r.From && o.To == r.To }) {
+		return
+	}
+	n.Ranges = append(n.Ranges, r)
+	slices.SortFunc(n.Ranges, func(a, b Range) int {
+		if a.From != b.From {
+			return a.From - b.From
+		}
+		return a.To - b.To
+	})
+}
+
+// RemoveRanges removes the ranges of n that hold line
+func (n *FileNode) RemoveRanges(line int) {
+	n.Ranges = slices.DeleteFunc(n.Ranges, func(r Range) bool { return r.Contains(line) })
+	if len(n.Ranges) == 0 {
+		n.Ranges = nil
+	}
+}
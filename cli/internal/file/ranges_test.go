@@ -0,0 +1,43 @@
+package file
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		r     Range
+		want  string
+		lines string
+	}{
+		{name: "lines", r: Range{From: 2, To: 3}, want: "lines 2-3", lines: "b\nc\n"},
+		{name: "one line with a label", r: Range{From: 1, To: 1, Label: "func Foo"}, want: "line 1, func Foo", lines: "a\n"},
+		{name: "past the end", r: Range{From: 4, To: 9}, want: "lines 4-9", lines: "d"},
+		{name: "after the end", r: Range{From: 7, To: 9}, want: "lines 7-9", lines: ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.r.String())
+			assert.Equal(t, tc.lines, Excerpt("a\nb\nc\nd", tc.r))
+		})
+	}
+}
+
+func TestAddRange(t *testing.T) {
+	n := &FileNode{Name: "a.go"}
+
+	n.AddRange(Range{From: 10, To: 12})
+	n.AddRange(Range{From: 5, To: 2})
+	n.AddRange(Range{From: 10, To: 12, Label: "func Foo"})
+
+	assert.Equal(t, []Range{{From: 2, To: 5}, {From: 10, To: 12}}, n.Ranges)
+	assert.Contains(t, RenderFileNode(n), "a.go (lines 2-5, 10-12)")
+
+	n.RemoveRanges(11)
+	n.RemoveRanges(3)
+
+	assert.Nil(t, n.Ranges)
+}
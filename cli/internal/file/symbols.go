@@ -0,0 +1,62 @@
+package file
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+)
+
+// Symbol is a function, method or type declared in a Go file, with the
+// lines it spans, doc comment included
+type Symbol struct {
+	Name  string
+	Range Range
+}
+
+// GoSymbols lists the functions, methods and types declared in the Go
+// source src, in order
+func GoSymbols(path string, src []byte) ([]Symbol, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	symbol := func(label string, doc *ast.CommentGroup, node ast.Node) Symbol {
+		from := node.Pos()
+		if doc != nil {
+			from = doc.Pos()
+		}
+		return Symbol{Name: label, Range: Range{
+			From:  fset.Position(from).Line,
+			To:    fset.Position(node.End()).Line,
+			Label: label,
+		}}
+	}
+
+	var symbols []Symbol
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			label := "func " + d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				label = "func (" + types.ExprString(d.Recv.List[0].Type) + ") " + d.Name.Name
+			}
+			symbols = append(symbols, symbol(label, d.Doc, d))
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if len(d.Specs) == 1 {
+					// type Foo struct{...} spans the whole declaration
+					symbols = append(symbols, symbol("type "+ts.Name.Name, d.Doc, d))
+				} else {
+					symbols = append(symbols, symbol("type "+ts.Name.Name, ts.Doc, ts))
+				}
+			}
+		}
+	}
+	return symbols, nil
+}
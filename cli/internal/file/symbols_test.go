@@ -0,0 +1,46 @@
+package file
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoSymbols(t *testing.T) {
+	src := `package a
+
+// Foo does foo
+func Foo() {
+	println("foo")
+}
+
+type (
+	A int
+	// B is b
+	B struct {
+		x int
+	}
+)
+
+type T struct{}
+
+func (t *T) Bar() {}
+
+const c = 1
+`
+
+	symbols, err := GoSymbols("a.go", []byte(src))
+
+	require.NoError(t, err)
+	assert.Equal(t, []Symbol{
+		{Name: "func Foo", Range: Range{From: 3, To: 6, Label: "func Foo"}},
+		{Name: "type A", Range: Range{From: 9, To: 9, Label: "type A"}},
+		{Name: "type B", Range: Range{From: 10, To: 13, Label: "type B"}},
+		{Name: "type T", Range: Range{From: 16, To: 16, Label: "type T"}},
+		{Name: "func (*T) Bar", Range: Range{From: 18, To: 18, Label: "func (*T) Bar"}},
+	}, symbols)
+
+	_, err = GoSymbols("bad.go", []byte("package"))
+	assert.Error(t, err)
+}
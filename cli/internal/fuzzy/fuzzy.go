@@ -0,0 +1,151 @@
+// Package fuzzy ranks paths against a query the way fzf does: the query
+// characters must appear in order, and matches at word boundaries and in
+// runs score higher.
+package fuzzy
+
+import (
+	"sort"
+	"unicode"
+)
+
+// Scores of a match, after fzf's
+const (
+	scoreMatch        = 16
+	scoreGapStart     = -3
+	scoreGapExtension = -1
+	// bonusBoundary is for a match at the start of a word; bonusDelimiter
+	// at the start of a path segment
+	bonusBoundary    = scoreMatch / 2
+	bonusDelimiter   = bonusBoundary + 1
+	bonusCamel       = bonusBoundary - 1
+	bonusConsecutive = 4
+	// The first query character counts its bonus twice
+	bonusFirstCharMultiplier = 2
+)
+
+// Match is a text that matched the query
+type Match struct {
+	Index     int // index of the text in the ranked list
+	Text      string
+	Score     int
+	Positions []int // rune indexes of the matched characters
+}
+
+// Score matches pattern against text. The match ignores case unless the
+// pattern has upper case letters. It returns false if text does not contain
+// the pattern's characters in order.
+func Score(pattern, text string) (Match, bool) {
+	p := []rune(pattern)
+	if len(p) == 0 {
+		return Match{Text: text}, true
+	}
+	t := []rune(text)
+	caseSensitive := false
+	for _, r := range p {
+		caseSensitive = caseSensitive || unicode.IsUpper(r)
+	}
+	fold := func(r rune) rune {
+		if caseSensitive {
+			return r
+		}
+		return unicode.ToLower(r)
+	}
+
+	// Find the first match going forward, then the shortest one ending
+	// there going backward
+	pi, end := 0, -1
+	for i := 0; i < len(t); i++ {
+		if fold(t[i]) == fold(p[pi]) {
+			pi++
+			if pi == len(p) {
+				end = i + 1
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return Match{}, false
+	}
+	pi, start := len(p)-1, 0
+	for i := end - 1; i >= 0; i-- {
+		if fold(t[i]) == fold(p[pi]) {
+			pi--
+			if pi < 0 {
+				start = i
+				break
+			}
+		}
+	}
+
+	score, consecutive, firstBonus, inGap := 0, 0, 0, false
+	positions := make([]int, 0, len(p))
+	pi = 0
+	for i := start; i < end; i++ {
+		if pi < len(p) && fold(t[i]) == fold(p[pi]) {
+			b := bonus(t, i)
+			if consecutive == 0 {
+				firstBonus = b
+			} else {
+				// A run keeps the bonus of where it started
+				if b >= bonusBoundary && b > firstBonus {
+					firstBonus = b
+				}
+				b = max(b, firstBonus, bonusConsecutive)
+			}
+			if pi == 0 {
+				b *= bonusFirstCharMultiplier
+			}
+			score += scoreMatch + b
+			positions = append(positions, i)
+			consecutive++
+			inGap = false
+			pi++
+			continue
+		}
+		if inGap {
+			score += scoreGapExtension
+		} else {
+			score += scoreGapStart
+		}
+		inGap, consecutive, firstBonus = true, 0, 0
+	}
+	return Match{Text: text, Score: score, Positions: positions}, true
+}
+
+// bonus rates position i of t as the start of a word
+func bonus(t []rune, i int) int {
+	if i == 0 {
+		return bonusDelimiter
+	}
+	prev, cur := t[i-1], t[i]
+	switch {
+	case prev == '/' || prev == '\\':
+		return bonusDelimiter
+	case prev == '_' || prev == '-' || prev == '.' || prev == ' ':
+		return bonusBoundary
+	case unicode.IsLower(prev) && unicode.IsUpper(cur),
+		!unicode.IsDigit(prev) && unicode.IsDigit(cur):
+		return bonusCamel
+	}
+	return 0
+}
+
+// Rank returns the texts that match pattern, best first. Equal scores go
+// to the shorter text.
+func Rank(pattern string, texts []string) []Match {
+	var matches []Match
+	for i, text := range texts {
+		if m, ok := Score(pattern, text); ok {
+			m.Index = i
+			matches = append(matches, m)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return len(a.Text) < len(b.Text)
+	})
+	return matches
+}
@@ -0,0 +1,70 @@
+package fuzzy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name      string
+		pattern   string
+		text      string
+		ok        bool
+		positions []int
+	}{
+		{name: "empty pattern matches", pattern: "", text: "main.go", ok: true, positions: nil},
+		{name: "subsequence", pattern: "mgo", text: "main.go", ok: true, positions: []int{0, 5, 6}},
+		{name: "out of order", pattern: "og", text: "go", ok: false},
+		{name: "ignores case", pattern: "readme", text: "README.md", ok: true, positions: []int{0, 1, 2, 3, 4, 5}},
+		{name: "upper case is exact", pattern: "Readme", text: "README.md", ok: false},
+		{name: "shortest window", pattern: "fs", text: "file/fileselect.go", ok: true, positions: []int{5, 9}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, ok := Score(tc.pattern, tc.text)
+
+			require.Equal(t, tc.ok, ok)
+			if ok {
+				assert.Equal(t, tc.positions, m.Positions)
+			}
+		})
+	}
+}
+
+func TestRank(t *testing.T) {
+	t.Run("word boundaries rank first", func(t *testing.T) {
+		texts := []string{"internal/file/filetree.go", "cmd/fileselect.go", "cmd/file_select.go"}
+
+		ranked := Rank("fs", texts)
+
+		require.Len(t, ranked, 2)
+		assert.Equal(t, "cmd/file_select.go", ranked[0].Text)
+		assert.Equal(t, 2, ranked[0].Index)
+		assert.Equal(t, "cmd/fileselect.go", ranked[1].Text)
+	})
+
+	t.Run("runs beat gaps", func(t *testing.T) {
+		ranked := Rank("sel", []string{"scale_list.go", "select.go"})
+
+		assert.Equal(t, "select.go", ranked[0].Text)
+	})
+
+	t.Run("path segments beat the middle of words", func(t *testing.T) {
+		ranked := Rank("go", []string{"cargo.toml", "cmd/go.mod"})
+
+		assert.Equal(t, "cmd/go.mod", ranked[0].Text)
+	})
+
+	t.Run("shorter texts win ties", func(t *testing.T) {
+		ranked := Rank("main", []string{"cmd/main_test.go", "cmd/main.go"})
+
+		assert.Equal(t, "cmd/main.go", ranked[0].Text)
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		assert.Empty(t, Rank("xyz", []string{"main.go"}))
+	})
+}
@@ -0,0 +1,155 @@
+package hub
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+)
+
+const (
+	// Time allowed to write a frame to the extension
+	writeWait = 10 * time.Second
+
+	// Time allowed to read the next pong from the extension
+	pongWait = 60 * time.Second
+
+	// Send pings with this period; must be less than pongWait
+	pingPeriod = (pongWait * 9) / 10
+
+	// Maximum size of a frame from the extension
+	maxMessageSize = 1 << 20
+
+	// Frames queued per client before it is considered stuck
+	sendQueueSize = 16
+)
+
+var upgrader = websocket.Upgrader{
+	// Origins are checked by the pairing guard before the upgrade
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// Client is a single extension connection, or another cdev instance that
+// relays its prompts through this server
+type Client struct {
+	hub   *Hub
+	conn  *websocket.Conn
+	send  chan []byte
+	relay bool
+	// info is owned by the Run goroutine; the ID is assigned on connect
+	// until the extension says hello
+	info protocol.ClientInfo
+}
+
+// ServeWS upgrades the request to a WebSocket and registers an extension client
+func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, false)
+}
+
+// ServeRelay upgrades the request to a WebSocket for another cdev instance
+func (h *Hub) ServeRelay(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, true)
+}
+
+func (h *Hub) serve(w http.ResponseWriter, r *http.Request, relay bool) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("Upgrade failed:", err)
+		return
+	}
+	c := &Client{
+		hub:   h,
+		conn:  conn,
+		send:  make(chan []byte, sendQueueSize),
+		relay: relay,
+		info:  protocol.ClientInfo{ID: protocol.NewID()[:8]},
+	}
+	select {
+	case h.register <- c:
+	case <-h.done:
+		conn.Close()
+		return
+	}
+
+	go c.writePump()
+	go c.readPump()
+}
+
+// readPump routes frames from the extension until the connection fails
+func (c *Client) readPump() {
+	defer func() {
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.done:
+		}
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Println("Read error:", err)
+			}
+			return
+		}
+		// Any frame proves the client is alive
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		c.handleInbound(data)
+	}
+}
+
+// writePump writes queued frames and keep-alive pings to the extension
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// The hub closed the queue
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Println("Write error:", err)
+				return
+			}
+
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleInbound decodes a frame and hands it to the Run goroutine
+func (c *Client) handleInbound(data []byte) {
+	msg, err := protocol.Decode(data)
+	if err != nil {
+		log.Println("Invalid message:", err)
+		return
+	}
+	if msg.Type == protocol.TypePing {
+		return
+	}
+	select {
+	case c.hub.inbound <- inbound{from: c, msg: msg}:
+	case <-c.hub.done:
+	}
+}
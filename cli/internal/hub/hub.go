@@ -0,0 +1,343 @@
+package hub
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+)
+
+// ErrClosed is returned by Send after the hub has stopped
+var ErrClosed = errors.New("hub is closed")
+
+// ErrUnknownTarget is returned by Send when the targeted client is not connected
+var ErrUnknownTarget = errors.New("target client is not connected")
+
+// Event reports a change in the set of connected extension clients
+type Event struct {
+	Connected bool // true when a client connected or identified itself, false when one left
+	Clients   int  // number of clients after the change
+}
+
+// outbound is a frame of the request id for the client with the target ID,
+// or the first available one; the number of clients it was queued for is
+// reported on result
+type outbound struct {
+	data   []byte
+	id     string
+	target string
+	result chan int
+}
+
+// errDisconnected is the reply to requests whose client left before the
+// reply finished
+const errDisconnected = "the extension disconnected before the reply finished"
+
+// inbound is a frame read from a client
+type inbound struct {
+	from *Client
+	msg  protocol.Message
+}
+
+// Hub owns the set of connected extension clients and of relayed cdev
+// instances. All mutations of the client sets happen on the Run goroutine;
+// other goroutines talk to it through channels.
+type Hub struct {
+	register   chan *Client
+	unregister chan *Client
+	broadcast  chan outbound
+	inbound    chan inbound
+	done       chan struct{}
+	events     chan Event
+	count      atomic.Int32
+	pending    *protocol.Pending
+
+	// infoMu guards info, a copy of the client list for other goroutines
+	infoMu sync.RWMutex
+	info   []protocol.ClientInfo
+}
+
+// New creates a hub. Call Run to start it.
+func New() *Hub {
+	return &Hub{
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		broadcast:  make(chan outbound),
+		inbound:    make(chan inbound),
+		done:       make(chan struct{}),
+		events:     make(chan Event, 1),
+		pending:    protocol.NewPending(),
+	}
+}
+
+// Run processes registrations, prompts and replies until Close is called
+func (h *Hub) Run() {
+	// Extension clients in connection order; the first is the default target
+	var clients []*Client
+	relays := make(map[*Client]bool)
+	// Request IDs of prompts forwarded for a relayed cdev instance
+	routes := make(map[string]*Client)
+	// Extension client each unfinished request was sent to
+	sentTo := make(map[string]*Client)
+
+	drop := func(c *Client) {
+		if c.relay {
+			if relays[c] {
+				delete(relays, c)
+				close(c.send)
+				for id, owner := range routes {
+					if owner == c {
+						delete(routes, id)
+						delete(sentTo, id)
+					}
+				}
+			}
+			return
+		}
+		if i := slices.Index(clients, c); i >= 0 {
+			clients = slices.Delete(clients, i, i+1)
+			close(c.send)
+			h.changed(clients, false, relays)
+			// No reply will come for the requests the client was handling
+			for id, to := range sentTo {
+				if to != c {
+					continue
+				}
+				delete(sentTo, id)
+				failed := protocol.Message{Type: protocol.TypeError, ID: id, Error: errDisconnected}
+				if owner, ok := routes[id]; ok {
+					delete(routes, id)
+					select {
+					case owner.send <- encode(failed):
+					default:
+					}
+					continue
+				}
+				h.pending.Deliver(failed)
+			}
+		}
+	}
+
+	queue := func(c *Client, data []byte) bool {
+		select {
+		case c.send <- data:
+			return true
+		default:
+			// The client is not keeping up; drop it
+			drop(c)
+			return false
+		}
+	}
+
+	// deliver queues data of the request id for the target client, or for
+	// the first client that accepts it when target is empty
+	deliver := func(data []byte, id, target string) (int, error) {
+		for _, c := range slices.Clone(clients) {
+			if target != "" && c.info.ID != target {
+				continue
+			}
+			if queue(c, data) {
+				if id != "" {
+					sentTo[id] = c
+				}
+				return 1, nil
+			}
+		}
+		if target != "" {
+			return 0, ErrUnknownTarget
+		}
+		return 0, nil
+	}
+
+	for {
+		select {
+		case c := <-h.register:
+			if c.relay {
+				relays[c] = true
+				queue(c, encode(status(clients)))
+				continue
+			}
+			clients = append(clients, c)
+			h.changed(clients, true, relays)
+
+		case c := <-h.unregister:
+			drop(c)
+
+		case out := <-h.broadcast:
+			queued, _ := deliver(out.data, out.id, out.target)
+			out.result <- queued
+
+		case in := <-h.inbound:
+			if in.from.relay {
+				// A relayed cdev instance sends a prompt through this server
+				if in.msg.Type != protocol.TypePrompt || !relays[in.from] {
+					continue
+				}
+				queued, err := deliver(encode(in.msg), in.msg.ID, in.msg.Target)
+				if queued == 0 {
+					reason := "extension not connected"
+					if err != nil {
+						reason = err.Error()
+					}
+					queue(in.from, encode(protocol.Message{Type: protocol.TypeError, ID: in.msg.ID, Error: reason}))
+					continue
+				}
+				routes[in.msg.ID] = in.from
+				continue
+			}
+			if in.msg.Type == protocol.TypeHello {
+				if slices.Contains(clients, in.from) && in.msg.Client != nil {
+					in.from.identify(*in.msg.Client, clients)
+					h.changed(clients, true, relays)
+				}
+				continue
+			}
+			if in.msg.Final() {
+				delete(sentTo, in.msg.ID)
+			}
+			if owner, ok := routes[in.msg.ID]; ok {
+				if in.msg.Final() {
+					delete(routes, in.msg.ID)
+				}
+				queue(owner, encode(in.msg))
+				continue
+			}
+			if !h.pending.Deliver(in.msg) {
+				log.Printf("No pending request for %s message %q", in.msg.Type, in.msg.ID)
+			}
+
+		case <-h.done:
+			for _, c := range clients {
+				close(c.send)
+			}
+			for c := range relays {
+				close(c.send)
+			}
+			h.count.Store(0)
+			h.setInfo(nil)
+			return
+		}
+	}
+}
+
+// identify applies the details a client sent in its hello message. The
+// client keeps its server assigned ID if the one it asks for is taken.
+func (c *Client) identify(info protocol.ClientInfo, clients []*Client) {
+	if info.ID == "" || info.ID == c.info.ID || slices.ContainsFunc(clients, func(other *Client) bool {
+		return other.info.ID == info.ID
+	}) {
+		info.ID = c.info.ID
+	}
+	c.info = info
+}
+
+// infos returns the details of the clients in connection order
+func infos(clients []*Client) []protocol.ClientInfo {
+	list := make([]protocol.ClientInfo, len(clients))
+	for i, c := range clients {
+		list[i] = c.info
+	}
+	return list
+}
+
+// status is the message telling relayed instances which clients are connected
+func status(clients []*Client) protocol.Message {
+	return protocol.Message{Type: protocol.TypeStatus, Clients: len(clients), Connected: infos(clients)}
+}
+
+// changed records the new client list and tells the UI and relayed instances
+func (h *Hub) changed(clients []*Client, connected bool, relays map[*Client]bool) {
+	h.setInfo(infos(clients))
+	h.count.Store(int32(len(clients)))
+	h.emit(Event{Connected: connected, Clients: len(clients)})
+	data := encode(status(clients))
+	for c := range relays {
+		select {
+		case c.send <- data:
+		default:
+		}
+	}
+}
+
+func (h *Hub) setInfo(list []protocol.ClientInfo) {
+	h.infoMu.Lock()
+	h.info = list
+	h.infoMu.Unlock()
+}
+
+// encode serializes a message built by the hub itself
+func encode(m protocol.Message) []byte {
+	data, err := m.Encode()
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// emit publishes an event without blocking
+func (h *Hub) emit(e Event) { emitLatest(h.events, e) }
+
+// emitLatest sends on a buffered channel of size one. Only the latest event
+// is kept when the consumer falls behind, so Clients is always current.
+func emitLatest(ch chan Event, e Event) {
+	select {
+	case ch <- e:
+	default:
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- e
+	}
+}
+
+// Close stops Run and disconnects every client
+func (h *Hub) Close() {
+	select {
+	case <-h.done:
+	default:
+		close(h.done)
+	}
+}
+
+// Events delivers connect and disconnect notifications
+func (h *Hub) Events() <-chan Event { return h.events }
+
+// Count returns the number of connected clients
+func (h *Hub) Count() int { return int(h.count.Load()) }
+
+// Clients returns the connected clients in connection order
+func (h *Hub) Clients() []protocol.ClientInfo {
+	h.infoMu.RLock()
+	defer h.infoMu.RUnlock()
+	return slices.Clone(h.info)
+}
+
+// Send queues a message for the client named by m.Target, or for the first
+// available client, and returns how many clients it was queued for
+func (h *Hub) Send(m protocol.Message) (int, error) {
+	data, err := m.Encode()
+	if err != nil {
+		return 0, err
+	}
+	out := outbound{data: data, id: m.ID, target: m.Target, result: make(chan int, 1)}
+	select {
+	case h.broadcast <- out:
+	case <-h.done:
+		return 0, ErrClosed
+	}
+	queued := <-out.result
+	if queued == 0 && m.Target != "" {
+		return 0, ErrUnknownTarget
+	}
+	return queued, nil
+}
+
+// Track returns the channel replies to the request id arrive on
+func (h *Hub) Track(id string) <-chan protocol.Message { return h.pending.Track(id) }
+
+// Forget stops tracking replies to the request id
+func (h *Hub) Forget(id string) { h.pending.Forget(id) }
@@ -0,0 +1,217 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+)
+
+func startHub(t *testing.T) (*Hub, string) {
+	t.Helper()
+	h := New()
+	go h.Run()
+	srv := httptest.NewServer(http.HandlerFunc(h.ServeWS))
+	t.Cleanup(func() {
+		srv.Close()
+		h.Close()
+	})
+	return h, "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	return conn
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) protocol.Message {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	m, err := protocol.Decode(data)
+	require.NoError(t, err)
+	return m
+}
+
+func hello(t *testing.T, conn *websocket.Conn, info protocol.ClientInfo) {
+	t.Helper()
+	data, err := protocol.Message{Type: protocol.TypeHello, Client: &info}.Encode()
+	require.NoError(t, err)
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, data))
+}
+
+func nextEvent(t *testing.T, h *Hub) Event {
+	t.Helper()
+	select {
+	case e := <-h.Events():
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for hub event")
+		return Event{}
+	}
+}
+
+func TestHub(t *testing.T) {
+	t.Run("connect and disconnect events", func(t *testing.T) {
+		h, url := startHub(t)
+
+		conn := dial(t, url)
+		assert.Equal(t, Event{Connected: true, Clients: 1}, nextEvent(t, h))
+		assert.Equal(t, 1, h.Count())
+
+		conn.Close()
+		assert.Equal(t, Event{Connected: false, Clients: 0}, nextEvent(t, h))
+		assert.Equal(t, 0, h.Count())
+	})
+
+	t.Run("send reaches only the first available client", func(t *testing.T) {
+		h, url := startHub(t)
+		a := dial(t, url)
+		defer a.Close()
+		nextEvent(t, h)
+		b := dial(t, url)
+		defer b.Close()
+		nextEvent(t, h)
+
+		sent, err := h.Send(protocol.NewPrompt("hello"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, sent)
+
+		assert.Equal(t, "hello", readMessage(t, a).Prompt)
+		b.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, _, err = b.ReadMessage()
+		assert.Error(t, err, "second client must not receive the prompt")
+	})
+
+	t.Run("hello identifies the client", func(t *testing.T) {
+		h, url := startHub(t)
+		conn := dial(t, url)
+		defer conn.Close()
+		nextEvent(t, h)
+		require.Len(t, h.Clients(), 1)
+		assert.NotEmpty(t, h.Clients()[0].ID)
+
+		hello(t, conn, protocol.ClientInfo{ID: "work", Browser: "Chrome", Profile: "Work", Version: "0.3.0"})
+		assert.Equal(t, Event{Connected: true, Clients: 1}, nextEvent(t, h))
+		assert.Equal(t, []protocol.ClientInfo{{ID: "work", Browser: "Chrome", Profile: "Work", Version: "0.3.0"}}, h.Clients())
+	})
+
+	t.Run("duplicate client ID keeps the assigned one", func(t *testing.T) {
+		h, url := startHub(t)
+		a := dial(t, url)
+		defer a.Close()
+		nextEvent(t, h)
+		hello(t, a, protocol.ClientInfo{ID: "same"})
+		nextEvent(t, h)
+		b := dial(t, url)
+		defer b.Close()
+		nextEvent(t, h)
+		hello(t, b, protocol.ClientInfo{ID: "same"})
+		nextEvent(t, h)
+
+		clients := h.Clients()
+		require.Len(t, clients, 2)
+		assert.Equal(t, "same", clients[0].ID)
+		assert.NotEqual(t, "same", clients[1].ID)
+	})
+
+	t.Run("send to a target client", func(t *testing.T) {
+		h, url := startHub(t)
+		a := dial(t, url)
+		defer a.Close()
+		nextEvent(t, h)
+		b := dial(t, url)
+		defer b.Close()
+		nextEvent(t, h)
+		hello(t, b, protocol.ClientInfo{ID: "second"})
+		nextEvent(t, h)
+
+		request := protocol.NewPrompt("hello")
+		request.Target = "second"
+		sent, err := h.Send(request)
+		require.NoError(t, err)
+		assert.Equal(t, 1, sent)
+		assert.Equal(t, "hello", readMessage(t, b).Prompt)
+	})
+
+	t.Run("send to an unknown target", func(t *testing.T) {
+		h, url := startHub(t)
+		conn := dial(t, url)
+		defer conn.Close()
+		nextEvent(t, h)
+
+		request := protocol.NewPrompt("hello")
+		request.Target = "missing"
+		sent, err := h.Send(request)
+		assert.ErrorIs(t, err, ErrUnknownTarget)
+		assert.Equal(t, 0, sent)
+	})
+
+	t.Run("send without clients", func(t *testing.T) {
+		h, _ := startHub(t)
+
+		sent, err := h.Send(protocol.NewPrompt("hello"))
+		require.NoError(t, err)
+		assert.Equal(t, 0, sent)
+	})
+
+	t.Run("replies are routed to the tracked request", func(t *testing.T) {
+		h, url := startHub(t)
+		conn := dial(t, url)
+		defer conn.Close()
+		nextEvent(t, h)
+
+		replies := h.Track("req")
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("ping")))
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"v":1,"type":"ack","id":"req"}`)))
+
+		select {
+		case m := <-replies:
+			assert.Equal(t, protocol.TypeAck, m.Type)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for reply")
+		}
+	})
+
+	t.Run("requests fail when their client disconnects", func(t *testing.T) {
+		h, url := startHub(t)
+		conn := dial(t, url)
+		nextEvent(t, h)
+
+		request := protocol.NewPrompt("hello")
+		replies := h.Track(request.ID)
+		sent, err := h.Send(request)
+		require.NoError(t, err)
+		require.Equal(t, 1, sent)
+		readMessage(t, conn)
+		conn.Close()
+
+		select {
+		case m := <-replies:
+			assert.Equal(t, protocol.TypeError, m.Type)
+			assert.Equal(t, errDisconnected, m.Error)
+		case <-time.After(2 * time.Second):
+			t.Fatal("the request was not failed")
+		}
+		_, ok := <-replies
+		assert.False(t, ok)
+	})
+
+	t.Run("send after close", func(t *testing.T) {
+		h := New()
+		go h.Run()
+		h.Close()
+
+		_, err := h.Send(protocol.NewPrompt("hello"))
+		assert.ErrorIs(t, err, ErrClosed)
+	})
+}
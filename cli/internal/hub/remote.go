@@ -0,0 +1,149 @@
+package hub
+
+import (
+	"log"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+)
+
+// Remote sends prompts through the hub of another cdev instance that already
+// owns the server port. It offers the same methods as Hub.
+type Remote struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	events  chan Event
+	count   atomic.Int32
+	pending *protocol.Pending
+	done    chan struct{}
+
+	infoMu sync.RWMutex
+	info   []protocol.ClientInfo
+}
+
+// Dial connects to the relay endpoint of the cdev server at addr (host:port),
+// authenticating with the pairing token
+func Dial(addr, token string) (*Remote, error) {
+	u := url.URL{Scheme: "ws", Host: addr, Path: "/relay", RawQuery: url.Values{"token": {token}}.Encode()}
+	dialer := websocket.Dialer{HandshakeTimeout: 5 * time.Second}
+	conn, _, err := dialer.Dial(u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Remote{
+		conn:    conn,
+		events:  make(chan Event, 1),
+		pending: protocol.NewPending(),
+		done:    make(chan struct{}),
+	}
+	go r.readLoop()
+	return r, nil
+}
+
+// readLoop tracks the extension clients and routes replies until the
+// connection closes
+func (r *Remote) readLoop() {
+	defer func() {
+		r.count.Store(0)
+		r.infoMu.Lock()
+		r.info = nil
+		r.infoMu.Unlock()
+		emitLatest(r.events, Event{Connected: false, Clients: 0})
+		close(r.done)
+	}()
+
+	for {
+		_, data, err := r.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Println("Relay read error:", err)
+			}
+			return
+		}
+		msg, err := protocol.Decode(data)
+		if err != nil {
+			log.Println("Invalid message from relay:", err)
+			continue
+		}
+		if msg.Type == protocol.TypeStatus {
+			r.infoMu.Lock()
+			changed := !slices.Equal(r.info, msg.Connected)
+			r.info = msg.Connected
+			r.infoMu.Unlock()
+			previous := r.count.Swap(int32(msg.Clients))
+			if int(previous) != msg.Clients || changed {
+				emitLatest(r.events, Event{Connected: msg.Clients >= int(previous), Clients: msg.Clients})
+			}
+			continue
+		}
+		r.pending.Deliver(msg)
+	}
+}
+
+// Events delivers connect and disconnect notifications of the remote hub
+func (r *Remote) Events() <-chan Event { return r.events }
+
+// Count returns the number of extension clients connected to the remote hub
+func (r *Remote) Count() int { return int(r.count.Load()) }
+
+// Clients returns the extension clients connected to the remote hub
+func (r *Remote) Clients() []protocol.ClientInfo {
+	r.infoMu.RLock()
+	defer r.infoMu.RUnlock()
+	return slices.Clone(r.info)
+}
+
+// Send forwards a message to the remote hub, which delivers it to the client
+// named by m.Target or the first available one, and returns the number of
+// extension clients it will reach
+func (r *Remote) Send(m protocol.Message) (int, error) {
+	select {
+	case <-r.done:
+		return 0, ErrClosed
+	default:
+	}
+	if r.Count() == 0 {
+		if m.Target != "" {
+			return 0, ErrUnknownTarget
+		}
+		return 0, nil
+	}
+	if m.Target != "" && !slices.ContainsFunc(r.Clients(), func(c protocol.ClientInfo) bool {
+		return c.ID == m.Target
+	}) {
+		return 0, ErrUnknownTarget
+	}
+	data, err := m.Encode()
+	if err != nil {
+		return 0, err
+	}
+
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	r.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := r.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// Track returns the channel replies to the request id arrive on
+func (r *Remote) Track(id string) <-chan protocol.Message { return r.pending.Track(id) }
+
+// Forget stops tracking replies to the request id
+func (r *Remote) Forget(id string) { r.pending.Forget(id) }
+
+// Close disconnects from the remote hub
+func (r *Remote) Close() error {
+	r.writeMu.Lock()
+	r.conn.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	r.writeMu.Unlock()
+	return r.conn.Close()
+}
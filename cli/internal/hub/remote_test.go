@@ -0,0 +1,160 @@
+package hub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+)
+
+func TestRemote(t *testing.T) {
+	// startRelayHub serves both endpoints and returns the server's host:port
+	startRelayHub := func(t *testing.T) (*Hub, string) {
+		t.Helper()
+		h := New()
+		go h.Run()
+		mux := http.NewServeMux()
+		mux.HandleFunc("/ws", h.ServeWS)
+		mux.HandleFunc("/relay", h.ServeRelay)
+		srv := httptest.NewServer(mux)
+		t.Cleanup(func() {
+			srv.Close()
+			h.Close()
+		})
+		return h, strings.TrimPrefix(srv.URL, "http://")
+	}
+
+	remoteEvent := func(t *testing.T, r *Remote) Event {
+		t.Helper()
+		select {
+		case e := <-r.Events():
+			return e
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for remote event")
+			return Event{}
+		}
+	}
+
+	t.Run("follows the extension count of the hub", func(t *testing.T) {
+		h, addr := startRelayHub(t)
+		r, err := Dial(addr, "")
+		require.NoError(t, err)
+		defer r.Close()
+		assert.Equal(t, 0, r.Count())
+
+		ext := dial(t, "ws://"+addr+"/ws")
+		nextEvent(t, h)
+		assert.Equal(t, Event{Connected: true, Clients: 1}, remoteEvent(t, r))
+		assert.Equal(t, 1, r.Count())
+
+		ext.Close()
+		assert.Equal(t, Event{Connected: false, Clients: 0}, remoteEvent(t, r))
+	})
+
+	t.Run("prompts and replies are relayed", func(t *testing.T) {
+		h, addr := startRelayHub(t)
+		ext := dial(t, "ws://"+addr+"/ws")
+		defer ext.Close()
+		nextEvent(t, h)
+
+		r, err := Dial(addr, "")
+		require.NoError(t, err)
+		defer r.Close()
+		require.Eventually(t, func() bool { return r.Count() == 1 }, 2*time.Second, 10*time.Millisecond)
+
+		request := protocol.NewPrompt("hello")
+		replies := r.Track(request.ID)
+		sent, err := r.Send(request)
+		require.NoError(t, err)
+		assert.Equal(t, 1, sent)
+
+		_, data, err := ext.ReadMessage()
+		require.NoError(t, err)
+		m, err := protocol.Decode(data)
+		require.NoError(t, err)
+		assert.Equal(t, request, m)
+
+		reply, err := protocol.Message{Type: protocol.TypeResponseDone, ID: m.ID, Text: "hi"}.Encode()
+		require.NoError(t, err)
+		require.NoError(t, ext.WriteMessage(websocket.TextMessage, reply))
+
+		select {
+		case got := <-replies:
+			assert.Equal(t, "hi", got.Text)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for relayed reply")
+		}
+	})
+
+	t.Run("relayed requests fail when the extension disconnects", func(t *testing.T) {
+		h, addr := startRelayHub(t)
+		ext := dial(t, "ws://"+addr+"/ws")
+		nextEvent(t, h)
+
+		r, err := Dial(addr, "")
+		require.NoError(t, err)
+		defer r.Close()
+		require.Eventually(t, func() bool { return r.Count() == 1 }, 2*time.Second, 10*time.Millisecond)
+
+		request := protocol.NewPrompt("hello")
+		replies := r.Track(request.ID)
+		_, err = r.Send(request)
+		require.NoError(t, err)
+		readMessage(t, ext)
+		ext.Close()
+
+		select {
+		case got := <-replies:
+			assert.Equal(t, protocol.TypeError, got.Type)
+			assert.Equal(t, errDisconnected, got.Error)
+		case <-time.After(2 * time.Second):
+			t.Fatal("the relayed request was not failed")
+		}
+	})
+
+	t.Run("lists the clients of the hub and sends to a target", func(t *testing.T) {
+		h, addr := startRelayHub(t)
+		first := dial(t, "ws://"+addr+"/ws")
+		defer first.Close()
+		nextEvent(t, h)
+		second := dial(t, "ws://"+addr+"/ws")
+		defer second.Close()
+		nextEvent(t, h)
+		hello(t, second, protocol.ClientInfo{ID: "second", Browser: "Firefox"})
+		nextEvent(t, h)
+
+		r, err := Dial(addr, "")
+		require.NoError(t, err)
+		defer r.Close()
+		require.Eventually(t, func() bool { return len(r.Clients()) == 2 }, 2*time.Second, 10*time.Millisecond)
+		assert.Equal(t, protocol.ClientInfo{ID: "second", Browser: "Firefox"}, r.Clients()[1])
+
+		request := protocol.NewPrompt("hello")
+		request.Target = "second"
+		sent, err := r.Send(request)
+		require.NoError(t, err)
+		assert.Equal(t, 1, sent)
+		assert.Equal(t, "hello", readMessage(t, second).Prompt)
+
+		request.Target = "missing"
+		_, err = r.Send(request)
+		assert.ErrorIs(t, err, ErrUnknownTarget)
+	})
+
+	t.Run("send without extension", func(t *testing.T) {
+		_, addr := startRelayHub(t)
+		r, err := Dial(addr, "")
+		require.NoError(t, err)
+		defer r.Close()
+
+		sent, err := r.Send(protocol.NewPrompt("hello"))
+		require.NoError(t, err)
+		assert.Equal(t, 0, sent)
+	})
+}
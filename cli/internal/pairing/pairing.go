@@ -0,0 +1,205 @@
+package pairing
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// tokenAlphabet avoids characters that are easy to confuse (0/O, 1/I/L)
+const tokenAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// NewToken returns a random token such as "K7QP-3MZD-9XTR-WB2H"
+func NewToken() string {
+	n := big.NewInt(int64(len(tokenAlphabet)))
+	var sb strings.Builder
+	for i := 0; i < 16; i++ {
+		if i > 0 && i%4 == 0 {
+			sb.WriteByte('-')
+		}
+		// rand.Int draws uniformly; a byte modulo the alphabet size would
+		// favor its first characters
+		v, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			panic(err)
+		}
+		sb.WriteByte(tokenAlphabet[v.Int64()])
+	}
+	return sb.String()
+}
+
+// normalize makes pasted tokens comparable: case, spaces and dashes are ignored
+func normalize(token string) string {
+	token = strings.ToUpper(token)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, token)
+}
+
+// Store keeps the pairing token in a file readable only by the user, so it
+// survives restarts and is shared by every cdev instance of that user
+type Store struct {
+	path  string
+	mu    sync.RWMutex
+	token string
+}
+
+// Open loads the token at path, creating one if the file does not exist
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+	data, err := os.ReadFile(path)
+	if err == nil && normalize(string(data)) != "" {
+		s.token = strings.TrimSpace(string(data))
+		return s, nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if _, err := s.Regenerate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Token returns the current token
+func (s *Store) Token() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.token
+}
+
+// Regenerate replaces the token; paired extensions must be paired again
+func (s *Store) Regenerate() (string, error) {
+	token := NewToken()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(s.path, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.token = token
+	s.mu.Unlock()
+	return token, nil
+}
+
+// Valid reports whether candidate matches the token. The file is re-read on
+// a mismatch so a token regenerated by another instance takes effect.
+func (s *Store) Valid(candidate string) bool {
+	candidate = normalize(candidate)
+	if candidate == "" {
+		return false
+	}
+	if equal(candidate, normalize(s.Token())) {
+		return true
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil || normalize(string(data)) == "" {
+		return false
+	}
+	s.mu.Lock()
+	s.token = strings.TrimSpace(string(data))
+	s.mu.Unlock()
+	return equal(candidate, normalize(string(data)))
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// Guard authenticates WebSocket handshakes before they are upgraded
+type Guard struct {
+	Store *Store
+	// AllowedOrigins lists the chrome-extension:// origins that may connect
+	AllowedOrigins []string
+}
+
+// rejection describes a failed handshake and the HTTP status to answer with
+type rejection struct {
+	status int
+	reason string
+}
+
+func (r *rejection) Error() string { return r.reason }
+
+func rejectf(status int, format string, args ...any) error {
+	return &rejection{status: status, reason: fmt.Sprintf(format, args...)}
+}
+
+// OriginAllowed reports whether origin is one of the allowed extension origins
+func (g Guard) OriginAllowed(origin string) bool {
+	if !strings.HasPrefix(origin, "chrome-extension://") {
+		return false
+	}
+	for _, allowed := range g.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckExtension requires an allowed chrome-extension:// origin and the token
+func (g Guard) CheckExtension(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if !g.OriginAllowed(origin) {
+		return rejectf(http.StatusForbidden, "origin %q is not an allowed extension", origin)
+	}
+	return g.checkToken(r)
+}
+
+// CheckRelay authenticates another cdev instance. It sends no Origin header;
+// any request that does comes from a browser and must be an allowed extension.
+func (g Guard) CheckRelay(r *http.Request) error {
+	if origin := r.Header.Get("Origin"); origin != "" && !g.OriginAllowed(origin) {
+		return rejectf(http.StatusForbidden, "origin %q may not relay prompts", origin)
+	}
+	return g.checkToken(r)
+}
+
+func (g Guard) checkToken(r *http.Request) error {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		return rejectf(http.StatusUnauthorized, "missing pairing token")
+	}
+	if g.Store == nil || !g.Store.Valid(token) {
+		return rejectf(http.StatusUnauthorized, "invalid pairing token")
+	}
+	return nil
+}
+
+// Wrap runs check before next and rejects and logs failed handshakes
+func (g Guard) Wrap(check func(*http.Request) error, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := check(r); err != nil {
+			status := http.StatusForbidden
+			var rej *rejection
+			if errors.As(err, &rej) {
+				status = rej.status
+			}
+			log.Printf("Rejected WebSocket handshake from %s on %s: %v", r.RemoteAddr, r.URL.Path, err)
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// CORS sets Access-Control-Allow-Origin for allowed extension origins only
+func (g Guard) CORS(w http.ResponseWriter, r *http.Request) {
+	if origin := r.Header.Get("Origin"); g.OriginAllowed(origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+	}
+}
@@ -0,0 +1,124 @@
+package pairing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const extensionOrigin = "chrome-extension://bdfinimpohfncpgeokmamgfebfhnkebi"
+
+func TestStore(t *testing.T) {
+	t.Run("creates a private token file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cdev", "token")
+
+		s, err := Open(path)
+		require.NoError(t, err)
+		assert.Regexp(t, `^[2-9A-Z]{4}(-[2-9A-Z]{4}){3}$`, s.Token())
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	})
+
+	t.Run("reuses the stored token", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "token")
+		first, err := Open(path)
+		require.NoError(t, err)
+
+		second, err := Open(path)
+		require.NoError(t, err)
+		assert.Equal(t, first.Token(), second.Token())
+	})
+
+	t.Run("valid ignores case and separators", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "token")
+		require.NoError(t, os.WriteFile(path, []byte("ABCD-EFGH-JKMN-PQRS\n"), 0600))
+		s, err := Open(path)
+		require.NoError(t, err)
+
+		assert.True(t, s.Valid("ABCD-EFGH-JKMN-PQRS"))
+		assert.True(t, s.Valid(" abcdefghjkmnpqrs "))
+		assert.False(t, s.Valid("ABCD-EFGH-JKMN-PQRT"))
+		assert.False(t, s.Valid(""))
+	})
+
+	t.Run("picks up a token regenerated by another instance", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "token")
+		s, err := Open(path)
+		require.NoError(t, err)
+		other, err := Open(path)
+		require.NoError(t, err)
+
+		token, err := other.Regenerate()
+		require.NoError(t, err)
+
+		assert.True(t, s.Valid(token))
+		assert.Equal(t, token, s.Token())
+	})
+}
+
+func TestGuard(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("ABCD-EFGH-JKMN-PQRS\n"), 0600))
+	store, err := Open(path)
+	require.NoError(t, err)
+	guard := Guard{Store: store, AllowedOrigins: []string{extensionOrigin}}
+
+	serve := func(check func(*http.Request) error, target, origin string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		rec := httptest.NewRecorder()
+		guard.Wrap(check, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		name   string
+		relay  bool
+		target string
+		origin string
+		want   int
+	}{
+		{name: "extension with token", target: "/ws?token=ABCD-EFGH-JKMN-PQRS", origin: extensionOrigin, want: http.StatusOK},
+		{name: "extension without token", target: "/ws", origin: extensionOrigin, want: http.StatusUnauthorized},
+		{name: "extension with wrong token", target: "/ws?token=WRONG", origin: extensionOrigin, want: http.StatusUnauthorized},
+		{name: "web page with token", target: "/ws?token=ABCD-EFGH-JKMN-PQRS", origin: "https://evil.example", want: http.StatusForbidden},
+		{name: "other extension", target: "/ws?token=ABCD-EFGH-JKMN-PQRS", origin: "chrome-extension://other", want: http.StatusForbidden},
+		{name: "no origin", target: "/ws?token=ABCD-EFGH-JKMN-PQRS", want: http.StatusForbidden},
+		{name: "relay with token", relay: true, target: "/relay?token=ABCD-EFGH-JKMN-PQRS", want: http.StatusOK},
+		{name: "relay without token", relay: true, target: "/relay", want: http.StatusUnauthorized},
+		{name: "relay from web page", relay: true, target: "/relay?token=ABCD-EFGH-JKMN-PQRS", origin: "http://localhost:3000", want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := guard.CheckExtension
+			if tt.relay {
+				check = guard.CheckRelay
+			}
+			assert.Equal(t, tt.want, serve(check, tt.target, tt.origin))
+		})
+	}
+
+	t.Run("CORS only for allowed origins", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.Header.Set("Origin", "https://evil.example")
+		rec := httptest.NewRecorder()
+		guard.CORS(rec, req)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+		req.Header.Set("Origin", extensionOrigin)
+		guard.CORS(rec, req)
+		assert.Equal(t, extensionOrigin, rec.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
@@ -0,0 +1,218 @@
+package protocol
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Version is the protocol version spoken by this build
+const Version = 1
+
+// Message types exchanged between cdev and the extension
+const (
+	TypePrompt        = "prompt"         // cdev → extension: a prompt to submit
+	TypeAck           = "ack"            // extension → cdev: prompt received
+	TypeResponseChunk = "response-chunk" // extension → cdev: text appended to the reply
+	TypeResponseDone  = "response-done"  // extension → cdev: reply finished, Text holds the full reply
+	TypeError         = "error"          // either direction: the request failed
+	TypePing          = "ping"           // extension → cdev: keep-alive
+	TypeStatus        = "status"         // cdev → relayed cdev: connected extensions
+	TypeHello         = "hello"          // extension → cdev: identifies the client after connecting
+)
+
+// ErrUnsupportedVersion is returned by Decode for messages from a newer protocol
+var ErrUnsupportedVersion = errors.New("unsupported protocol version")
+
+// Message is a single WebSocket frame. ID correlates every reply with the
+// prompt that caused it.
+type Message struct {
+	Version int    `json:"v"`
+	Type    string `json:"type"`
+	ID      string `json:"id,omitempty"`
+	Prompt  string `json:"prompt,omitempty"`
+	Text    string `json:"text,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Clients int    `json:"clients,omitempty"`
+	// Target is the ID of the client a prompt is for; empty means the first
+	// available client
+	Target string `json:"target,omitempty"`
+	// Sequence is shared by the parts of a split prompt, so the extension
+	// submits them all in the same conversation
+	Sequence string `json:"sequence,omitempty"`
+	// Client describes the sender of a hello message
+	Client *ClientInfo `json:"client,omitempty"`
+	// Connected lists the extension clients in a status message
+	Connected []ClientInfo `json:"connected,omitempty"`
+	// Dropped counts the chunks of the reply lost before this final message
+	// because the waiter fell behind; see Pending
+	Dropped int `json:"-"`
+}
+
+// ClientInfo identifies a connected extension
+type ClientInfo struct {
+	ID      string `json:"id"`
+	Browser string `json:"browser,omitempty"`
+	Profile string `json:"profile,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// Label is a short human readable description of the client
+func (c ClientInfo) Label() string {
+	label := c.Browser
+	if label == "" {
+		label = "Browser"
+	}
+	if c.Profile != "" {
+		label += " · " + c.Profile
+	}
+	if c.Version != "" {
+		label += " (v" + c.Version + ")"
+	}
+	return label + " [" + c.ID + "]"
+}
+
+// NewID returns a random request ID
+func NewID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewPrompt creates a prompt message with a fresh request ID
+func NewPrompt(prompt string) Message {
+	return Message{Version: Version, Type: TypePrompt, ID: NewID(), Prompt: prompt}
+}
+
+// Encode serializes the message as JSON
+func (m Message) Encode() ([]byte, error) {
+	if m.Version == 0 {
+		m.Version = Version
+	}
+	return json.Marshal(m)
+}
+
+// Final reports whether no more messages follow for this request
+func (m Message) Final() bool {
+	return m.Type == TypeResponseDone || m.Type == TypeError
+}
+
+// Decode parses a frame. The bare "ping" text sent by older extensions is
+// returned as a ping message.
+func Decode(data []byte) (Message, error) {
+	if string(data) == TypePing {
+		return Message{Version: Version, Type: TypePing}, nil
+	}
+	var m Message
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Message{}, err
+	}
+	if m.Version > Version {
+		return Message{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, m.Version)
+	}
+	if m.Type == "" {
+		return Message{}, errors.New("message has no type")
+	}
+	return m, nil
+}
+
+// Pending correlates replies with the prompts waiting for them
+type Pending struct {
+	mu      sync.Mutex
+	waiters map[string]chan Message
+	dropped map[string]int
+}
+
+// NewPending creates an empty tracker
+func NewPending() *Pending {
+	return &Pending{waiters: make(map[string]chan Message), dropped: make(map[string]int)}
+}
+
+// Track registers a request ID and returns the channel its replies arrive
+// on. The channel is closed after a final message or Forget.
+func (p *Pending) Track(id string) <-chan Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ch := make(chan Message, 64)
+	p.waiters[id] = ch
+	return ch
+}
+
+// Deliver routes a reply to its waiter and reports whether one was found.
+// Chunks are dropped rather than blocking when the waiter falls behind, and
+// counted in the Dropped field of the final message.
+func (p *Pending) Deliver(m Message) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ch, ok := p.waiters[m.ID]
+	if !ok {
+		return false
+	}
+	if m.Final() {
+		m.Dropped = p.dropped[m.ID]
+		select {
+		case ch <- m:
+		default:
+			// Make room so the final message is never lost, by dropping the
+			// oldest chunk, or the oldest message when there is no chunk
+			m.Dropped += evict(ch)
+			ch <- m
+		}
+		close(ch)
+		delete(p.waiters, m.ID)
+		delete(p.dropped, m.ID)
+		return true
+	}
+	select {
+	case ch <- m:
+	default:
+		if m.Type == TypeResponseChunk {
+			p.dropped[m.ID]++
+		}
+	}
+	return true
+}
+
+// evict removes the oldest chunk from ch, keeping the order of the other
+// messages, and returns the number of chunks removed. When ch is full and
+// holds no chunk, the oldest message is removed instead. Only Deliver sends
+// on ch, under the lock, so the messages taken out fit back in.
+func evict(ch chan Message) int {
+	var kept []Message
+	evicted := 0
+	for done := false; !done; {
+		select {
+		case old := <-ch:
+			if evicted == 0 && old.Type == TypeResponseChunk {
+				evicted++
+				continue
+			}
+			kept = append(kept, old)
+		default:
+			done = true
+		}
+	}
+	if evicted == 0 && len(kept) == cap(ch) {
+		kept = kept[1:]
+	}
+	for _, old := range kept {
+		ch <- old
+	}
+	return evicted
+}
+
+// Forget stops tracking a request and closes its channel
+func (p *Pending) Forget(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ch, ok := p.waiters[id]; ok {
+		close(ch)
+		delete(p.waiters, id)
+		delete(p.dropped, id)
+	}
+}
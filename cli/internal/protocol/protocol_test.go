@@ -0,0 +1,193 @@
+package protocol
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	t.Run("prompt round trip", func(t *testing.T) {
+		m := NewPrompt("hello")
+		require.NotEmpty(t, m.ID)
+
+		data, err := m.Encode()
+		require.NoError(t, err)
+
+		decoded, err := Decode(data)
+		require.NoError(t, err)
+		assert.Equal(t, m, decoded)
+	})
+
+	t.Run("encode fills in the version", func(t *testing.T) {
+		data, err := Message{Type: TypeAck, ID: "1"}.Encode()
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"v":1,"type":"ack","id":"1"}`, string(data))
+	})
+
+	t.Run("legacy ping text", func(t *testing.T) {
+		m, err := Decode([]byte("ping"))
+		require.NoError(t, err)
+		assert.Equal(t, TypePing, m.Type)
+	})
+
+	t.Run("newer version is rejected", func(t *testing.T) {
+		_, err := Decode([]byte(`{"v":99,"type":"ack"}`))
+		assert.ErrorIs(t, err, ErrUnsupportedVersion)
+	})
+
+	t.Run("missing type is rejected", func(t *testing.T) {
+		_, err := Decode([]byte(`{"v":1}`))
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid json is rejected", func(t *testing.T) {
+		_, err := Decode([]byte(`{`))
+		assert.Error(t, err)
+	})
+
+	t.Run("hello carries client info", func(t *testing.T) {
+		m, err := Decode([]byte(`{"v":1,"type":"hello","client":{"id":"a1","browser":"Chrome","profile":"Work","version":"0.3.0"}}`))
+		require.NoError(t, err)
+		require.NotNil(t, m.Client)
+		assert.Equal(t, ClientInfo{ID: "a1", Browser: "Chrome", Profile: "Work", Version: "0.3.0"}, *m.Client)
+	})
+}
+
+func TestClientInfoLabel(t *testing.T) {
+	tests := []struct {
+		name   string
+		info   ClientInfo
+		expect string
+	}{
+		{name: "full", info: ClientInfo{ID: "a1", Browser: "Chrome", Profile: "Work", Version: "0.3.0"}, expect: "Chrome · Work (v0.3.0) [a1]"},
+		{name: "id only", info: ClientInfo{ID: "a1"}, expect: "Browser [a1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, tt.info.Label())
+		})
+	}
+}
+
+func TestPending(t *testing.T) {
+	t.Run("replies reach the matching request", func(t *testing.T) {
+		p := NewPending()
+		a := p.Track("a")
+		b := p.Track("b")
+
+		assert.True(t, p.Deliver(Message{Type: TypeAck, ID: "b"}))
+		assert.True(t, p.Deliver(Message{Type: TypeResponseChunk, ID: "a", Text: "hi"}))
+
+		assert.Equal(t, "hi", (<-a).Text)
+		assert.Equal(t, TypeAck, (<-b).Type)
+	})
+
+	t.Run("final message closes the channel", func(t *testing.T) {
+		p := NewPending()
+		ch := p.Track("a")
+
+		p.Deliver(Message{Type: TypeResponseDone, ID: "a", Text: "done"})
+
+		m, ok := <-ch
+		assert.True(t, ok)
+		assert.Equal(t, "done", m.Text)
+		_, ok = <-ch
+		assert.False(t, ok)
+		assert.False(t, p.Deliver(Message{Type: TypeAck, ID: "a"}))
+	})
+
+	t.Run("final message is kept when the buffer is full", func(t *testing.T) {
+		p := NewPending()
+		ch := p.Track("a")
+		for i := 0; i < 100; i++ {
+			p.Deliver(Message{Type: TypeResponseChunk, ID: "a", Text: "x"})
+		}
+		p.Deliver(Message{Type: TypeResponseDone, ID: "a", Text: "full"})
+
+		var last Message
+		chunks := 0
+		for m := range ch {
+			if m.Type == TypeResponseChunk {
+				chunks++
+			}
+			last = m
+		}
+		assert.Equal(t, TypeResponseDone, last.Type)
+		assert.Equal(t, "full", last.Text)
+		assert.Equal(t, 100-chunks, last.Dropped, "lost chunks are counted")
+	})
+
+	t.Run("a full buffer keeps the ack", func(t *testing.T) {
+		p := NewPending()
+		ch := p.Track("a")
+		p.Deliver(Message{Type: TypeAck, ID: "a"})
+		for i := 0; i < 100; i++ {
+			p.Deliver(Message{Type: TypeResponseChunk, ID: "a", Text: fmt.Sprint(i)})
+		}
+		p.Deliver(Message{Type: TypeResponseDone, ID: "a", Text: "full"})
+
+		var got []Message
+		for m := range ch {
+			got = append(got, m)
+		}
+		require.Len(t, got, cap(ch))
+		assert.Equal(t, TypeAck, got[0].Type, "the ack is never evicted")
+		assert.Equal(t, "1", got[1].Text, "the oldest chunk made room")
+		assert.Equal(t, TypeResponseDone, got[len(got)-1].Type)
+		assert.Equal(t, 100-(cap(ch)-2), got[len(got)-1].Dropped)
+	})
+
+	t.Run("a buffer full of acks drops the oldest one", func(t *testing.T) {
+		p := NewPending()
+		ch := p.Track("a")
+		for i := 0; i < cap(ch); i++ {
+			p.Deliver(Message{Type: TypeAck, ID: "a", Text: fmt.Sprint(i)})
+		}
+
+		delivered := make(chan bool)
+		go func() { delivered <- p.Deliver(Message{Type: TypeResponseDone, ID: "a", Text: "full"}) }()
+		select {
+		case ok := <-delivered:
+			assert.True(t, ok)
+		case <-time.After(time.Second):
+			t.Fatal("Deliver blocked on a full buffer")
+		}
+
+		var got []Message
+		for m := range ch {
+			got = append(got, m)
+		}
+		require.Len(t, got, cap(ch))
+		assert.Equal(t, "1", got[0].Text, "the oldest ack made room")
+		assert.Equal(t, TypeResponseDone, got[len(got)-1].Type)
+		assert.Equal(t, 0, got[len(got)-1].Dropped, "only chunks are counted")
+	})
+
+	t.Run("nothing is dropped while the waiter keeps up", func(t *testing.T) {
+		p := NewPending()
+		ch := p.Track("a")
+		p.Deliver(Message{Type: TypeResponseChunk, ID: "a", Text: "x"})
+		p.Deliver(Message{Type: TypeResponseDone, ID: "a", Text: "x"})
+
+		<-ch
+		assert.Equal(t, 0, (<-ch).Dropped)
+	})
+
+	t.Run("unknown request", func(t *testing.T) {
+		p := NewPending()
+		assert.False(t, p.Deliver(Message{Type: TypeAck, ID: "missing"}))
+	})
+
+	t.Run("forget closes the channel", func(t *testing.T) {
+		p := NewPending()
+		ch := p.Track("a")
+		p.Forget("a")
+
+		_, ok := <-ch
+		assert.False(t, ok)
+	})
+}
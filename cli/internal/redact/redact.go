@@ -0,0 +1,224 @@
+// Package redact finds secrets and credentials in prompts and replaces them
+// before the prompts leave the machine.
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/trknhr/chatgpt-dev-utils/internal/config"
+)
+
+// Rule is a detector. Matches of Pattern are redacted, or only its first
+// capture group if it has one. With MinEntropy set, matches with a lower
+// Shannon entropy per character are ignored.
+type Rule struct {
+	Name       string
+	Pattern    *regexp.Regexp
+	MinEntropy float64
+}
+
+// HighEntropy is the detector for random looking strings without a known
+// format
+const HighEntropy = "high-entropy"
+
+// builtin are the detectors used unless ignored in the config
+var builtin = []Rule{
+	{Name: "private-key", Pattern: regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY(?: BLOCK)?-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY(?: BLOCK)?-----`)},
+	{Name: "aws-access-key-id", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA)[0-9A-Z]{16}\b`)},
+	{Name: "aws-secret-access-key", Pattern: regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+]{40})\b`)},
+	{Name: "github-token", Pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{Name: "openai-api-key", Pattern: regexp.MustCompile(`\bsk-(?:proj-|svcacct-)?[A-Za-z0-9_-]{20,}`)},
+	{Name: "slack-token", Pattern: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{Name: "google-api-key", Pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{Name: "stripe-key", Pattern: regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{24,}\b`)},
+	// KEY=value lines of .env files and shell scripts, also in diffs
+	{Name: "env-secret", Pattern: regexp.MustCompile(`(?m)^[+ -]?\s*(?:export\s+)?[A-Z0-9_]*(?:SECRET|PASSWORD|PASSWD|TOKEN|API_?KEY|PRIVATE_KEY|CREDENTIALS?)[A-Z0-9_]*\s*=\s*["']?([^\s"'#]{8,})`)},
+	{Name: HighEntropy, Pattern: regexp.MustCompile(`[A-Za-z0-9+/_=-]{32,}`), MinEntropy: 4.5},
+}
+
+// Finding is a secret in a text
+type Finding struct {
+	Rule       string
+	Start, End int // byte offsets of the secret
+	Line       int // 1-based line the secret starts on
+	Secret     string
+}
+
+// Replacement is the text the secret is replaced with
+func (f Finding) Replacement() string {
+	return "[REDACTED:" + f.Rule + "]"
+}
+
+// Redactor finds secrets with a set of rules
+type Redactor struct {
+	rules []Rule
+}
+
+// New builds a redactor from the built-in detectors and the patterns in the
+// config. Invalid patterns are reported and skipped.
+func New(cfg config.Redact) (*Redactor, error) {
+	if cfg.Disabled {
+		return &Redactor{}, nil
+	}
+	r := &Redactor{}
+	for _, rule := range builtin {
+		if !slices.Contains(cfg.Ignore, rule.Name) {
+			r.rules = append(r.rules, rule)
+		}
+	}
+	var errs []error
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("redact pattern %q: %w", p.Name, err))
+			continue
+		}
+		name := p.Name
+		if name == "" {
+			name = "custom"
+		}
+		r.rules = append(r.rules, Rule{Name: name, Pattern: re})
+	}
+	return r, errors.Join(errs...)
+}
+
+// Rules returns the names of the detectors in use
+func (r *Redactor) Rules() []string {
+	names := make([]string, len(r.rules))
+	for i, rule := range r.rules {
+		names[i] = rule.Name
+	}
+	return names
+}
+
+// Find returns the secrets in text in order. Where detectors overlap, the
+// first rule wins.
+func (r *Redactor) Find(text string) []Finding {
+	var found []Finding
+	taken := func(start, end int) bool {
+		return slices.ContainsFunc(found, func(f Finding) bool { return start < f.End && f.Start < end })
+	}
+	for _, rule := range r.rules {
+		for _, m := range rule.Pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[0], m[1]
+			if len(m) >= 4 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			secret := text[start:end]
+			if start == end || taken(start, end) {
+				continue
+			}
+			if rule.MinEntropy > 0 && !random(secret, rule.MinEntropy) {
+				continue
+			}
+			found = append(found, Finding{
+				Rule:   rule.Name,
+				Start:  start,
+				End:    end,
+				Line:   strings.Count(text[:start], "\n") + 1,
+				Secret: secret,
+			})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Start < found[j].Start })
+	return found
+}
+
+// random reports whether s mixes upper case letters, lower case letters and
+// digits with at least min bits of entropy per character. Hex strings such
+// as commit hashes stay below the threshold.
+func random(s string, min float64) bool {
+	var upper, lower, digit bool
+	for _, c := range s {
+		upper = upper || unicode.IsUpper(c)
+		lower = lower || unicode.IsLower(c)
+		digit = digit || unicode.IsDigit(c)
+	}
+	return upper && lower && digit && Entropy(s) >= min
+}
+
+// Entropy returns the Shannon entropy of s in bits per character
+func Entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := map[rune]int{}
+	n := 0
+	for _, c := range s {
+		counts[c]++
+		n++
+	}
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// Apply replaces the findings in text, which must come from Find on the
+// same text
+func Apply(text string, findings []Finding) string {
+	var sb strings.Builder
+	last := 0
+	for _, f := range findings {
+		sb.WriteString(text[last:f.Start])
+		sb.WriteString(f.Replacement())
+		last = f.End
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+// Offset maps the byte offset pos in the text to the offset in the text
+// Apply returns. Offsets inside a secret map to the end of its replacement.
+func Offset(findings []Finding, pos int) int {
+	shift := 0
+	for _, f := range findings {
+		switch {
+		case pos <= f.Start:
+			return pos + shift
+		case pos < f.End:
+			return f.Start + shift + len(f.Replacement())
+		}
+		shift += len(f.Replacement()) - (f.End - f.Start)
+	}
+	return pos + shift
+}
+
+// Mask shortens a secret for display, keeping only its first characters
+func Mask(secret string) string {
+	first, _, _ := strings.Cut(secret, "\n")
+	runes := []rune(first)
+	if len(runes) > 4 {
+		runes = runes[:4]
+	}
+	return string(runes) + "…"
+}
+
+var (
+	mu      sync.RWMutex
+	current = &Redactor{rules: builtin}
+)
+
+// Configure sets the redactor prompts are checked with
+func Configure(r *Redactor) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = r
+}
+
+// Current returns the configured redactor
+func Current() *Redactor {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/trknhr/chatgpt-dev-utils/internal/hub"
+	"github.com/trknhr/chatgpt-dev-utils/internal/pairing"
+)
+
+// ErrAddrInUse is returned by Listen when another process owns the address
+var ErrAddrInUse = errors.New("address already in use")
+
+// Server is the HTTP server the extension and relayed cdev instances connect
+// to. It serves /ws for extensions, /relay for other cdev instances and /ping
+// as a health check.
+type Server struct {
+	hub      *hub.Hub
+	guard    pairing.Guard
+	mux      *http.ServeMux
+	http     *http.Server
+	listener net.Listener
+}
+
+// New creates a server and starts its hub. Call Serve, or use Listen, to
+// accept connections.
+func New(guard pairing.Guard) *Server {
+	s := &Server{
+		hub:   hub.New(),
+		guard: guard,
+		mux:   http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/ws", guard.Wrap(guard.CheckExtension, s.hub.ServeWS))
+	s.mux.HandleFunc("/relay", guard.Wrap(guard.CheckRelay, s.hub.ServeRelay))
+	s.mux.HandleFunc("/ping", s.handlePing)
+	s.http = &http.Server{Handler: s.mux}
+	go s.hub.Run()
+	return s
+}
+
+// Listen creates a server listening on addr (host:port; port 0 picks a free
+// one) and serves it in the background
+func Listen(addr string, guard pairing.Guard) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		if isAddrInUse(err) {
+			return nil, ErrAddrInUse
+		}
+		return nil, err
+	}
+	s := New(guard)
+	s.listener = listener
+	go func() {
+		if err := s.serve(listener); err != nil {
+			log.Printf("WebSocket server error: %v", err)
+		}
+	}()
+	return s, nil
+}
+
+// Serve accepts connections on listener until Close is called
+func (s *Server) Serve(listener net.Listener) error {
+	s.listener = listener
+	return s.serve(listener)
+}
+
+func (s *Server) serve(listener net.Listener) error {
+	err := s.http.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Handler returns the routes of the server, e.g. for httptest
+func (s *Server) Handler() http.Handler { return s.mux }
+
+// Hub returns the hub the extension clients are registered with
+func (s *Server) Hub() *hub.Hub { return s.hub }
+
+// Addr returns the address the server listens on, or "" before Serve
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// Close stops accepting connections and disconnects every client
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s.hub.Close()
+	return s.http.Shutdown(ctx)
+}
+
+// handlePing is a simple HTTP health check; the answer identifies cdev
+func (s *Server) handlePing(w http.ResponseWriter, r *http.Request) {
+	s.guard.CORS(w, r)
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("pong"))
+}
+
+// Probe reports whether a cdev server answers /ping at addr
+func Probe(addr string) bool {
+	client := http.Client{Timeout: time.Second}
+	resp, err := client.Get("http://" + addr + "/ping")
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16))
+	return err == nil && resp.StatusCode == http.StatusOK && string(body) == "pong"
+}
+
+func isAddrInUse(err error) bool {
+	if errors.Is(err, syscall.EADDRINUSE) {
+		return true
+	}
+	// Windows reports WSAEADDRINUSE with its own message
+	return strings.Contains(strings.ToLower(err.Error()), "only one usage of each socket address")
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trknhr/chatgpt-dev-utils/internal/pairing"
+)
+
+const testOrigin = "chrome-extension://test"
+
+func testGuard(t *testing.T) pairing.Guard {
+	t.Helper()
+	store, err := pairing.Open(filepath.Join(t.TempDir(), "token"))
+	require.NoError(t, err)
+	return pairing.Guard{Store: store, AllowedOrigins: []string{testOrigin}}
+}
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{
+			name: "Listen picks a free port and answers ping",
+			test: func(t *testing.T) {
+				s, err := Listen("127.0.0.1:0", testGuard(t))
+				require.NoError(t, err)
+				defer s.Close()
+
+				assert.NotEmpty(t, s.Addr())
+				assert.True(t, Probe(s.Addr()))
+			},
+		},
+		{
+			name: "Listen reports an address in use",
+			test: func(t *testing.T) {
+				s, err := Listen("127.0.0.1:0", testGuard(t))
+				require.NoError(t, err)
+				defer s.Close()
+
+				_, err = Listen(s.Addr(), testGuard(t))
+				assert.ErrorIs(t, err, ErrAddrInUse)
+			},
+		},
+		{
+			name: "Probe fails for other servers",
+			test: func(t *testing.T) {
+				other := httptest.NewServer(http.NotFoundHandler())
+				defer other.Close()
+
+				assert.False(t, Probe(other.Listener.Addr().String()))
+			},
+		},
+		{
+			name: "ping allows only extension origins",
+			test: func(t *testing.T) {
+				s := New(testGuard(t))
+				defer s.Close()
+
+				for origin, allowed := range map[string]string{testOrigin: testOrigin, "https://example.com": ""} {
+					req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+					req.Header.Set("Origin", origin)
+					rec := httptest.NewRecorder()
+					s.Handler().ServeHTTP(rec, req)
+
+					assert.Equal(t, http.StatusOK, rec.Code)
+					assert.Equal(t, allowed, rec.Header().Get("Access-Control-Allow-Origin"))
+				}
+			},
+		},
+		{
+			name: "ws requires a pairing token",
+			test: func(t *testing.T) {
+				s := New(testGuard(t))
+				defer s.Close()
+
+				req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+				req.Header.Set("Origin", testOrigin)
+				rec := httptest.NewRecorder()
+				s.Handler().ServeHTTP(rec, req)
+
+				assert.Equal(t, http.StatusUnauthorized, rec.Code)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, tt.test)
+	}
+}
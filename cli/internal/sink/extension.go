@@ -0,0 +1,125 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+)
+
+// AckTimeout is how long the extension has to acknowledge a part
+var AckTimeout = 5 * time.Second
+
+// PartTimeout is how long ChatGPT has to answer a part
+var PartTimeout = 3 * time.Minute
+
+// ErrNotConnected is returned when no extension received the prompt
+var ErrNotConnected = errors.New("extension not connected")
+
+// Extension is the connection to the Chrome extension; *hub.Hub and
+// *hub.Remote implement it
+type Extension interface {
+	Send(msg protocol.Message) (int, error)
+	Track(id string) <-chan protocol.Message
+	Forget(id string)
+}
+
+// ExtensionSink submits the prompt in ChatGPT through the Chrome extension
+// and streams the reply
+type ExtensionSink struct {
+	Ext Extension
+	// Target is the client ID to send to; empty means the first available
+	Target string
+}
+
+func (ExtensionSink) Name() string  { return NameExtension }
+func (ExtensionSink) Label() string { return "Extension (ChatGPT)" }
+
+func (e ExtensionSink) Deliver(prompt string) (Delivery, error) {
+	return e.deliver(prompt, "")
+}
+
+// deliver submits prompt as part of sequence, or on its own if sequence is
+// empty
+func (e ExtensionSink) deliver(prompt, sequence string) (Delivery, error) {
+	// Register before sending so no reply is missed
+	request := protocol.NewPrompt(prompt)
+	request.Target = e.Target
+	request.Sequence = sequence
+	replies := e.Ext.Track(request.ID)
+
+	sent, err := e.Ext.Send(request)
+	if err != nil || sent == 0 {
+		e.Ext.Forget(request.ID)
+		if err == nil {
+			err = ErrNotConnected
+		}
+		return Delivery{}, err
+	}
+	return Delivery{
+		Status:    "Sent to extension!",
+		RequestID: request.ID,
+		Replies:   replies,
+		Cancel:    func() { e.Ext.Forget(request.ID) },
+		Waiting:   "Waiting for the extension...",
+	}, nil
+}
+
+// SendParts submits the parts of a split prompt in order. Each part must be
+// acknowledged by the extension and answered by ChatGPT before the next is
+// sent. The reply to the last part is streamed through the returned
+// Delivery. progress, if not nil, is called as parts are answered. The parts
+// share a sequence ID, so the extension submits them in one conversation.
+func (e ExtensionSink) SendParts(ctx context.Context, parts []string, progress func(done, total int)) (Delivery, error) {
+	sequence := protocol.NewID()
+	last := len(parts) - 1
+	for i, part := range parts[:last] {
+		d, err := e.deliver(part, sequence)
+		if err == nil {
+			err = awaitAnswer(ctx, d.Replies)
+			d.Cancel()
+		}
+		if err != nil {
+			return Delivery{}, fmt.Errorf("part %d/%d: %w", i+1, last, err)
+		}
+		if progress != nil {
+			progress(i+1, len(parts))
+		}
+	}
+	return e.deliver(parts[last], sequence)
+}
+
+// awaitAnswer waits for the ack of a part and then for ChatGPT's answer
+func awaitAnswer(ctx context.Context, replies <-chan protocol.Message) error {
+	timeout := time.NewTimer(AckTimeout)
+	defer timeout.Stop()
+	acked := false
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			if !acked {
+				return errors.New("the extension did not acknowledge the part")
+			}
+			return errors.New("timed out waiting for ChatGPT to answer")
+		case m, ok := <-replies:
+			if !ok {
+				return errors.New("connection closed before ChatGPT answered")
+			}
+			switch m.Type {
+			case protocol.TypeAck:
+				if !acked {
+					acked = true
+					timeout.Reset(PartTimeout)
+				}
+			case protocol.TypeResponseDone:
+				return nil
+			case protocol.TypeError:
+				return errors.New(m.Error)
+			}
+		}
+	}
+}
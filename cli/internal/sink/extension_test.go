@@ -0,0 +1,115 @@
+package sink
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+)
+
+// fakeExtension records sent messages instead of talking to a browser
+type fakeExtension struct {
+	clients int
+	pending *protocol.Pending
+	sent    []protocol.Message
+	// reply, if set, answers each sent message
+	reply func(msg protocol.Message) []protocol.Message
+}
+
+func newFakeExtension(clients int) *fakeExtension {
+	return &fakeExtension{clients: clients, pending: protocol.NewPending()}
+}
+
+func (f *fakeExtension) Track(id string) <-chan protocol.Message { return f.pending.Track(id) }
+func (f *fakeExtension) Forget(id string)                        { f.pending.Forget(id) }
+func (f *fakeExtension) Send(msg protocol.Message) (int, error) {
+	if f.clients == 0 {
+		return 0, nil
+	}
+	f.sent = append(f.sent, msg)
+	if f.reply != nil {
+		for _, m := range f.reply(msg) {
+			f.pending.Deliver(m)
+		}
+	}
+	return 1, nil
+}
+
+func TestExtensionSink(t *testing.T) {
+	t.Run("sends to the target and streams replies", func(t *testing.T) {
+		ext := newFakeExtension(1)
+
+		d, err := ExtensionSink{Ext: ext, Target: "work"}.Deliver("hello")
+		require.NoError(t, err)
+		require.Len(t, ext.sent, 1)
+		assert.Equal(t, "hello", ext.sent[0].Prompt)
+		assert.Equal(t, "work", ext.sent[0].Target)
+		assert.Empty(t, ext.sent[0].Sequence)
+		assert.Equal(t, ext.sent[0].ID, d.RequestID)
+
+		ext.pending.Deliver(protocol.Message{Type: protocol.TypeAck, ID: d.RequestID})
+		assert.Equal(t, protocol.TypeAck, (<-d.Replies).Type)
+
+		d.Cancel()
+		_, ok := <-d.Replies
+		assert.False(t, ok)
+	})
+
+	t.Run("parts are sent after the previous one is answered", func(t *testing.T) {
+		ext := newFakeExtension(1)
+		ext.reply = func(msg protocol.Message) []protocol.Message {
+			return []protocol.Message{
+				{Type: protocol.TypeAck, ID: msg.ID},
+				{Type: protocol.TypeResponseDone, ID: msg.ID, Text: "OK"},
+			}
+		}
+		var progress [][2]int
+
+		d, err := ExtensionSink{Ext: ext}.SendParts(context.Background(), []string{"one", "two", "go"}, func(done, total int) {
+			progress = append(progress, [2]int{done, total})
+		})
+
+		require.NoError(t, err)
+		require.Len(t, ext.sent, 3)
+		assert.Equal(t, "go", ext.sent[2].Prompt)
+		assert.Equal(t, ext.sent[2].ID, d.RequestID)
+		assert.NotEmpty(t, ext.sent[0].Sequence)
+		for _, m := range ext.sent {
+			assert.Equal(t, ext.sent[0].Sequence, m.Sequence, "the parts go to one conversation")
+		}
+		assert.Equal(t, [][2]int{{1, 3}, {2, 3}}, progress)
+	})
+
+	t.Run("a failed part stops the sequence", func(t *testing.T) {
+		ext := newFakeExtension(1)
+		ext.reply = func(msg protocol.Message) []protocol.Message {
+			return []protocol.Message{{Type: protocol.TypeError, ID: msg.ID, Error: "input not found"}}
+		}
+
+		_, err := ExtensionSink{Ext: ext}.SendParts(context.Background(), []string{"one", "two", "go"}, nil)
+
+		assert.EqualError(t, err, "part 1/2: input not found")
+		assert.Len(t, ext.sent, 1)
+	})
+
+	t.Run("an unacknowledged part times out", func(t *testing.T) {
+		previous := AckTimeout
+		AckTimeout = 10 * time.Millisecond
+		t.Cleanup(func() { AckTimeout = previous })
+		ext := newFakeExtension(1)
+
+		_, err := ExtensionSink{Ext: ext}.SendParts(context.Background(), []string{"one", "go"}, nil)
+
+		assert.EqualError(t, err, "part 1/1: the extension did not acknowledge the part")
+	})
+
+	t.Run("not connected", func(t *testing.T) {
+		ext := newFakeExtension(0)
+
+		_, err := ExtensionSink{Ext: ext}.Deliver("hello")
+		assert.ErrorIs(t, err, ErrNotConnected)
+	})
+}
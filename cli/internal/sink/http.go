@@ -0,0 +1,198 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/trknhr/chatgpt-dev-utils/internal/config"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+)
+
+// HTTP sends the prompt to an OpenAI-compatible chat completions endpoint,
+// such as a local llama.cpp or Ollama server, and streams the reply
+type HTTP struct {
+	URL    string
+	Model  string
+	APIKey string
+	Client *http.Client
+}
+
+func newHTTP(cfg config.HTTPSink) HTTP {
+	h := HTTP{URL: cfg.URL, Model: cfg.Model}
+	if cfg.APIKeyEnv != "" {
+		h.APIKey = os.Getenv(cfg.APIKeyEnv)
+	}
+	return h
+}
+
+func (HTTP) Name() string { return NameHTTP }
+
+func (h HTTP) Label() string {
+	if h.Model == "" {
+		return "OpenAI-compatible API"
+	}
+	return fmt.Sprintf("OpenAI-compatible API (%s)", h.Model)
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model    string        `json:"model,omitempty"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+}
+
+// chatResponse covers both a streamed chunk (delta) and a full reply (message)
+type chatResponse struct {
+	Choices []struct {
+		Delta   chatMessage `json:"delta"`
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (h HTTP) Deliver(prompt string) (Delivery, error) {
+	body, err := json.Marshal(chatRequest{
+		Model:    h.Model,
+		Messages: []chatMessage{{Role: "user", Content: prompt}},
+		Stream:   true,
+	})
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	id := protocol.NewID()
+	replies := make(chan protocol.Message, 64)
+	go h.stream(ctx, id, body, replies)
+
+	return Delivery{
+		Status:    "Sent to " + h.Label(),
+		RequestID: id,
+		Replies:   replies,
+		Cancel:    cancel,
+		Waiting:   "Waiting for the model...",
+	}, nil
+}
+
+// stream posts the request and reports the reply on replies as ack,
+// response-chunk and response-done messages, or a single error
+func (h HTTP) stream(ctx context.Context, id string, body []byte, replies chan<- protocol.Message) {
+	defer close(replies)
+	emit := func(m protocol.Message) bool {
+		m.Version = protocol.Version
+		m.ID = id
+		select {
+		case replies <- m:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	fail := func(err error) {
+		emit(protocol.Message{Type: protocol.TypeError, Error: err.Error()})
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		fail(err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream, application/json")
+	if h.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.APIKey)
+	}
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		fail(fmt.Errorf("%s: %s", resp.Status, apiError(text)))
+		return
+	}
+	if !emit(protocol.Message{Type: protocol.TypeAck}) {
+		return
+	}
+
+	// Servers that ignore "stream" answer with a single JSON document
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var reply chatResponse
+		if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+			fail(fmt.Errorf("invalid response: %w", err))
+			return
+		}
+		if len(reply.Choices) == 0 {
+			fail(fmt.Errorf("response has no choices"))
+			return
+		}
+		emit(protocol.Message{Type: protocol.TypeResponseDone, Text: reply.Choices[0].Message.Content})
+		return
+	}
+
+	var full strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var chunk chatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			fail(fmt.Errorf("invalid stream chunk: %w", err))
+			return
+		}
+		if chunk.Error != nil {
+			fail(fmt.Errorf("%s", chunk.Error.Message))
+			return
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		text := chunk.Choices[0].Delta.Content
+		full.WriteString(text)
+		if !emit(protocol.Message{Type: protocol.TypeResponseChunk, Text: text}) {
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fail(err)
+		return
+	}
+	emit(protocol.Message{Type: protocol.TypeResponseDone, Text: full.String()})
+}
+
+// apiError extracts the message of an OpenAI style error body
+func apiError(body []byte) string {
+	var reply chatResponse
+	if json.Unmarshal(body, &reply) == nil && reply.Error != nil {
+		return reply.Error.Message
+	}
+	return strings.TrimSpace(string(body))
+}
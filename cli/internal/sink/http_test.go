@@ -0,0 +1,110 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+)
+
+// collect reads replies until the channel closes
+func collect(t *testing.T, replies <-chan protocol.Message) []protocol.Message {
+	t.Helper()
+	var list []protocol.Message
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case m, ok := <-replies:
+			if !ok {
+				return list
+			}
+			list = append(list, m)
+		case <-timeout:
+			t.Fatal("timed out waiting for replies")
+			return list
+		}
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	t.Run("streams server-sent events", func(t *testing.T) {
+		var got chatRequest
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, text := range []string{"Hel", "lo"} {
+				fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", text)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		}))
+		defer srv.Close()
+
+		d, err := HTTP{URL: srv.URL, Model: "llama3", APIKey: "key"}.Deliver("hi")
+		require.NoError(t, err)
+		replies := collect(t, d.Replies)
+
+		assert.Equal(t, chatRequest{Model: "llama3", Messages: []chatMessage{{Role: "user", Content: "hi"}}, Stream: true}, got)
+		require.Len(t, replies, 4)
+		assert.Equal(t, protocol.TypeAck, replies[0].Type)
+		assert.Equal(t, "Hel", replies[1].Text)
+		assert.Equal(t, "lo", replies[2].Text)
+		assert.Equal(t, protocol.Message{Version: protocol.Version, Type: protocol.TypeResponseDone, ID: d.RequestID, Text: "Hello"}, replies[3])
+	})
+
+	t.Run("accepts a non-streamed reply", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"Hello"}}]}`)
+		}))
+		defer srv.Close()
+
+		d, err := HTTP{URL: srv.URL}.Deliver("hi")
+		require.NoError(t, err)
+		replies := collect(t, d.Replies)
+
+		require.Len(t, replies, 2)
+		assert.Equal(t, protocol.TypeResponseDone, replies[1].Type)
+		assert.Equal(t, "Hello", replies[1].Text)
+	})
+
+	t.Run("reports API errors", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"message":"model \"gpt\" not found"}}`)
+		}))
+		defer srv.Close()
+
+		d, err := HTTP{URL: srv.URL}.Deliver("hi")
+		require.NoError(t, err)
+		replies := collect(t, d.Replies)
+
+		require.Len(t, replies, 1)
+		assert.Equal(t, protocol.TypeError, replies[0].Type)
+		assert.Equal(t, `404 Not Found: model "gpt" not found`, replies[0].Error)
+	})
+
+	t.Run("cancel stops waiting", func(t *testing.T) {
+		release := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		}))
+		defer srv.Close()
+		defer close(release)
+
+		d, err := HTTP{URL: srv.URL}.Deliver("hi")
+		require.NoError(t, err)
+		d.Cancel()
+
+		collect(t, d.Replies)
+	})
+}
@@ -0,0 +1,62 @@
+package sink
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/atotto/clipboard"
+)
+
+// Clipboard copies the prompt to the system clipboard
+type Clipboard struct{}
+
+func (Clipboard) Name() string  { return NameClipboard }
+func (Clipboard) Label() string { return "Clipboard" }
+
+func (Clipboard) Deliver(prompt string) (Delivery, error) {
+	if err := clipboard.WriteAll(prompt); err != nil {
+		return Delivery{}, err
+	}
+	return Delivery{Status: "Copied to clipboard!"}, nil
+}
+
+// File writes the prompt to a file, replacing its content
+type File struct {
+	Path string
+}
+
+func (File) Name() string    { return NameFile }
+func (f File) Label() string { return fmt.Sprintf("File (%s)", f.Path) }
+
+func (f File) Deliver(prompt string) (Delivery, error) {
+	if f.Path == "" {
+		return Delivery{}, fmt.Errorf("no file configured (sinks.file)")
+	}
+	if dir := filepath.Dir(f.Path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return Delivery{}, err
+		}
+	}
+	if err := os.WriteFile(f.Path, []byte(prompt), 0644); err != nil {
+		return Delivery{}, err
+	}
+	return Delivery{Status: "Written to " + f.Path}, nil
+}
+
+// Stdout writes the prompt to W. In the TUI W is flushed after exit, so the
+// delivery asks the TUI to quit.
+type Stdout struct {
+	W io.Writer
+}
+
+func (Stdout) Name() string  { return NameStdout }
+func (Stdout) Label() string { return "Stdout (on exit)" }
+
+func (s Stdout) Deliver(prompt string) (Delivery, error) {
+	if _, err := fmt.Fprintln(s.W, prompt); err != nil {
+		return Delivery{}, err
+	}
+	return Delivery{Status: "Printed to stdout", Quit: true}, nil
+}
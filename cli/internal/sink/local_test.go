@@ -0,0 +1,41 @@
+package sink
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile(t *testing.T) {
+	t.Run("writes the prompt and creates directories", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "out", "prompt.md")
+
+		d, err := File{Path: path}.Deliver("hello")
+		require.NoError(t, err)
+		assert.Equal(t, "Written to "+path, d.Status)
+		assert.Nil(t, d.Replies)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(data))
+	})
+
+	t.Run("requires a path", func(t *testing.T) {
+		_, err := File{}.Deliver("hello")
+		assert.Error(t, err)
+	})
+}
+
+func TestStdout(t *testing.T) {
+	var out strings.Builder
+
+	d, err := Stdout{W: &out}.Deliver("hello")
+	require.NoError(t, err)
+
+	assert.Equal(t, "hello\n", out.String())
+	assert.True(t, d.Quit)
+}
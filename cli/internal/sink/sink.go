@@ -0,0 +1,116 @@
+// Package sink delivers a rendered prompt to one of several outputs: the
+// clipboard, the Chrome extension, a file, stdout or an OpenAI-compatible
+// chat completions endpoint.
+package sink
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/trknhr/chatgpt-dev-utils/internal/config"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+)
+
+// Sink names, as used by --sink and sinks.default in config.yaml
+const (
+	NameClipboard = "clipboard"
+	NameExtension = "extension"
+	NameFile      = "file"
+	NameStdout    = "stdout"
+	NameHTTP      = "http"
+)
+
+// Sink is an output for rendered prompts
+type Sink interface {
+	// Name identifies the sink in flags and config
+	Name() string
+	// Label describes the sink in the TUI
+	Label() string
+	// Deliver outputs the prompt
+	Deliver(prompt string) (Delivery, error)
+}
+
+// Delivery describes a delivered prompt. Sinks that answer, like the
+// extension and HTTP endpoints, stream the reply on Replies.
+type Delivery struct {
+	// Status is shown to the user, e.g. "Copied to clipboard!"
+	Status string
+	// RequestID correlates the replies with the prompt
+	RequestID string
+	// Replies receives the reply as protocol messages and is closed after
+	// the final one; nil when the sink does not answer
+	Replies <-chan protocol.Message
+	// Cancel stops waiting for the reply
+	Cancel func()
+	// Waiting is shown until the first reply arrives
+	Waiting string
+	// Quit asks the TUI to exit, e.g. so stdout can be written
+	Quit bool
+}
+
+var (
+	mu       sync.RWMutex
+	settings           = config.Default().Sinks
+	stdout   io.Writer = os.Stdout
+)
+
+// Configure sets the sink settings and the writer used by the stdout sink
+func Configure(cfg config.Sinks, out io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	settings = cfg
+	stdout = out
+}
+
+// DefaultName returns the sink selected when none was chosen
+func DefaultName() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if settings.Default == "" {
+		return NameClipboard
+	}
+	return settings.Default
+}
+
+// Available returns the sinks that can be used, in display order. The
+// extension sink is included when ext is not nil, the HTTP sink when an
+// endpoint is configured.
+func Available(ext Extension, target string) []Sink {
+	mu.RLock()
+	defer mu.RUnlock()
+	sinks := []Sink{Clipboard{}}
+	if ext != nil {
+		sinks = append(sinks, ExtensionSink{Ext: ext, Target: target})
+	}
+	sinks = append(sinks, File{Path: settings.File}, Stdout{W: stdout})
+	if settings.HTTP.URL != "" {
+		sinks = append(sinks, newHTTP(settings.HTTP))
+	}
+	return sinks
+}
+
+// Find returns the sink with the given name
+func Find(sinks []Sink, name string) (Sink, bool) {
+	for _, s := range sinks {
+		if s.Name() == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// ByName returns an available sink or an error listing the available ones
+func ByName(name string, ext Extension, target string) (Sink, error) {
+	sinks := Available(ext, target)
+	if s, ok := Find(sinks, name); ok {
+		return s, nil
+	}
+	names := make([]string, len(sinks))
+	for i, s := range sinks {
+		names[i] = s.Name()
+	}
+	return nil, fmt.Errorf("unknown or unconfigured sink %q (available: %s)", name, strings.Join(names, ", "))
+}
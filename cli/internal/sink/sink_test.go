@@ -0,0 +1,76 @@
+package sink
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trknhr/chatgpt-dev-utils/internal/config"
+)
+
+func names(sinks []Sink) []string {
+	var list []string
+	for _, s := range sinks {
+		list = append(list, s.Name())
+	}
+	return list
+}
+
+func TestAvailable(t *testing.T) {
+	t.Cleanup(func() { Configure(config.Default().Sinks, os.Stdout) })
+
+	tests := []struct {
+		name   string
+		cfg    config.Sinks
+		ext    Extension
+		expect []string
+	}{
+		{
+			name:   "without extension or endpoint",
+			cfg:    config.Default().Sinks,
+			expect: []string{NameClipboard, NameFile, NameStdout},
+		},
+		{
+			name:   "with extension",
+			cfg:    config.Default().Sinks,
+			ext:    newFakeExtension(1),
+			expect: []string{NameClipboard, NameExtension, NameFile, NameStdout},
+		},
+		{
+			name:   "with endpoint",
+			cfg:    config.Sinks{HTTP: config.HTTPSink{URL: "http://localhost:8080/v1/chat/completions"}},
+			expect: []string{NameClipboard, NameFile, NameStdout, NameHTTP},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Configure(tt.cfg, io.Discard)
+			assert.Equal(t, tt.expect, names(Available(tt.ext, "")))
+		})
+	}
+}
+
+func TestByName(t *testing.T) {
+	t.Cleanup(func() { Configure(config.Default().Sinks, os.Stdout) })
+	t.Setenv("TEST_API_KEY", "secret")
+	Configure(config.Sinks{HTTP: config.HTTPSink{URL: "http://x", Model: "llama3", APIKeyEnv: "TEST_API_KEY"}}, io.Discard)
+
+	s, err := ByName(NameHTTP, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, HTTP{URL: "http://x", Model: "llama3", APIKey: "secret"}, s)
+
+	_, err = ByName(NameExtension, nil, "")
+	assert.ErrorContains(t, err, "available: clipboard, file, stdout, http")
+}
+
+func TestDefaultName(t *testing.T) {
+	t.Cleanup(func() { Configure(config.Default().Sinks, os.Stdout) })
+
+	Configure(config.Sinks{}, io.Discard)
+	assert.Equal(t, NameClipboard, DefaultName())
+
+	Configure(config.Sinks{Default: NameHTTP}, io.Discard)
+	assert.Equal(t, NameHTTP, DefaultName())
+}
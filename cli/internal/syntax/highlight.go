@@ -0,0 +1,47 @@
+// Package syntax colors source code for the terminal
+package syntax
+
+import (
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// Style is the chroma style the code is colored with
+const Style = "monokai"
+
+// Highlight colors text, guessing the language from the file name and then the
+// content. Each line is colored on its own, so lines can be shown apart.
+// Text in a language that is not recognized is returned as is.
+func Highlight(name, text string) []string {
+	plain := strings.Split(text, "\n")
+	lexer := lexers.Match(name)
+	if lexer == nil {
+		lexer = lexers.Analyse(text)
+	}
+	if lexer == nil {
+		return plain
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, text)
+	if err != nil {
+		return plain
+	}
+	formatter, style := formatters.TTY256, styles.Get(Style)
+
+	var lines []string
+	for _, tokens := range chroma.SplitTokensIntoLines(iterator.Tokens()) {
+		var sb strings.Builder
+		if err := formatter.Format(&sb, style, chroma.Literator(tokens...)); err != nil {
+			return plain
+		}
+		lines = append(lines, strings.TrimSuffix(sb.String(), "\n"))
+	}
+	// A last line without a newline after it has no tokens of its own
+	for len(lines) < len(plain) {
+		lines = append(lines, "")
+	}
+	return lines[:len(plain)]
+}
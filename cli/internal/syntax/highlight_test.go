@@ -0,0 +1,39 @@
+package syntax
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		text    string
+		colored bool
+	}{
+		{name: "go by extension", file: "main.go", text: "package main\n\nfunc main() {\n}", colored: true},
+		{name: "trailing line without tokens", file: "a.py", text: "x = 1\n", colored: true},
+		{name: "unknown language", file: "notes", text: "some words\nmore words", colored: false},
+		{name: "empty", file: "empty.go", text: "", colored: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := Highlight(tt.file, tt.text)
+			plain := make([]string, len(lines))
+			for i, line := range lines {
+				plain[i] = ansi.Strip(line)
+			}
+			// Coloring keeps the lines as they are
+			assert.Equal(t, strings.Split(tt.text, "\n"), plain)
+			if tt.colored {
+				assert.NotEqual(t, plain, lines)
+			} else {
+				assert.Equal(t, plain, lines)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package templates
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pos is a position in a template body. Line and Col start at 1; Col counts
+// bytes.
+type Pos struct {
+	Offset int
+	Line   int
+	Col    int
+}
+
+func (p Pos) String() string { return fmt.Sprintf("line %d, column %d", p.Line, p.Col) }
+
+// Node is a piece of a parsed template: Text or Substitution
+type Node interface {
+	node()
+}
+
+// Text is literal template text; escapes are already resolved
+type Text struct {
+	Value string
+	Pos   Pos
+}
+
+// Substitution is a $(...) command substitution
+type Substitution struct {
+	// Command is the text between the parentheses, e.g. `git diff --cached`
+	Command string
+	// Pos is the position of the $ and End the position after the )
+	Pos Pos
+	End Pos
+}
+
+func (Text) node()         {}
+func (Substitution) node() {}
+
+// Source returns the substitution as written in the template
+func (s Substitution) Source() string { return "$(" + s.Command + ")" }
+
+// SyntaxError reports a malformed template
+type SyntaxError struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *SyntaxError) Error() string { return fmt.Sprintf("%s: %s", e.Pos, e.Msg) }
+
+// Parse splits a template body into text and $(...) substitutions.
+//
+//   - a substitution ends at the ) that balances its (, so commands may
+//     contain parentheses and span lines
+//   - inside a substitution, ) within '...' or "..." and a \-escaped ) do not
+//     count; the command text is kept as written for the shell word parser
+//   - \$( in text is a literal $(
+//
+// On a syntax error the nodes parsed so far are returned, followed by the
+// rest of the body as Text, so callers can still render the template.
+func Parse(body string) ([]Node, error) {
+	p := &parser{src: body, line: 1, col: 1}
+	return p.parse()
+}
+
+type parser struct {
+	src       string
+	off       int
+	line, col int
+	nodes     []Node
+	text      strings.Builder
+	textPos   Pos
+}
+
+func (p *parser) pos() Pos { return Pos{Offset: p.off, Line: p.line, Col: p.col} }
+
+// advance moves past n bytes, tracking lines
+func (p *parser) advance(n int) {
+	for i := 0; i < n; i++ {
+		if p.src[p.off] == '\n' {
+			p.line++
+			p.col = 1
+		} else {
+			p.col++
+		}
+		p.off++
+	}
+}
+
+func (p *parser) addText(s string, at Pos) {
+	if p.text.Len() == 0 {
+		p.textPos = at
+	}
+	p.text.WriteString(s)
+}
+
+func (p *parser) flushText() {
+	if p.text.Len() > 0 {
+		p.nodes = append(p.nodes, Text{Value: p.text.String(), Pos: p.textPos})
+		p.text.Reset()
+	}
+}
+
+func (p *parser) parse() ([]Node, error) {
+	for p.off < len(p.src) {
+		rest := p.src[p.off:]
+		switch {
+		case strings.HasPrefix(rest, `\$(`):
+			p.addText("$(", p.pos())
+			p.advance(3)
+		case strings.HasPrefix(rest, "$("):
+			start := p.pos()
+			if err := p.substitution(); err != nil {
+				// Keep the unparsed rest as literal text
+				p.addText(p.src[start.Offset:], start)
+				p.flushText()
+				return p.nodes, err
+			}
+		default:
+			p.addText(rest[:1], p.pos())
+			p.advance(1)
+		}
+	}
+	p.flushText()
+	return p.nodes, nil
+}
+
+// substitution scans $(...) starting at the current position
+func (p *parser) substitution() error {
+	start := p.pos()
+	p.advance(2)
+	cmdStart := p.off
+	depth := 1
+	var quote byte
+	var quotePos Pos
+
+	for p.off < len(p.src) {
+		c := p.src[p.off]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case quote == '"':
+			if c == '\\' && p.off+1 < len(p.src) {
+				p.advance(1)
+			} else if c == '"' {
+				quote = 0
+			}
+		case c == '\\' && p.off+1 < len(p.src):
+			p.advance(1)
+		case c == '\'' || c == '"':
+			quote = c
+			quotePos = p.pos()
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				command := p.src[cmdStart:p.off]
+				p.advance(1)
+				p.flushText()
+				p.nodes = append(p.nodes, Substitution{Command: command, Pos: start, End: p.pos()})
+				return nil
+			}
+		}
+		p.advance(1)
+	}
+
+	// Rewind so the caller can keep the rest as text
+	p.off, p.line, p.col = start.Offset, start.Line, start.Col
+	if quote != 0 {
+		return &SyntaxError{Pos: quotePos, Msg: fmt.Sprintf("unterminated %c quote in $(...)", quote)}
+	}
+	return &SyntaxError{Pos: start, Msg: "unterminated $(...)"}
+}
+
+// Expand renders nodes, replacing every substitution with the result of
+// eval. It makes a single pass: output of eval is never parsed again.
+func Expand(nodes []Node, eval func(Substitution) string) string {
+	var sb strings.Builder
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case Text:
+			sb.WriteString(n.Value)
+		case Substitution:
+			sb.WriteString(eval(n))
+		}
+	}
+	return sb.String()
+}
+
+// Substitutions returns the substitutions among nodes
+func Substitutions(nodes []Node) []Substitution {
+	var subs []Substitution
+	for _, n := range nodes {
+		if s, ok := n.(Substitution); ok {
+			subs = append(subs, s)
+		}
+	}
+	return subs
+}
@@ -0,0 +1,200 @@
+package templates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		expect []Node
+	}{
+		{
+			name:   "plain text",
+			body:   "no substitutions",
+			expect: []Node{Text{Value: "no substitutions", Pos: Pos{0, 1, 1}}},
+		},
+		{
+			name: "single substitution",
+			body: "Diff: $(git diff)",
+			expect: []Node{
+				Text{Value: "Diff: ", Pos: Pos{0, 1, 1}},
+				Substitution{Command: "git diff", Pos: Pos{6, 1, 7}, End: Pos{17, 1, 18}},
+			},
+		},
+		{
+			name: "parentheses inside double quotes",
+			body: `$(git log --pretty=format:"%h (%an)")`,
+			expect: []Node{
+				Substitution{Command: `git log --pretty=format:"%h (%an)"`, Pos: Pos{0, 1, 1}, End: Pos{37, 1, 38}},
+			},
+		},
+		{
+			name: "closing parenthesis inside single quotes",
+			body: `$(git log --grep=')')!`,
+			expect: []Node{
+				Substitution{Command: `git log --grep=')'`, Pos: Pos{0, 1, 1}, End: Pos{21, 1, 22}},
+				Text{Value: "!", Pos: Pos{21, 1, 22}},
+			},
+		},
+		{
+			name: "balanced nested parentheses",
+			body: `$(git log --format=(%h))`,
+			expect: []Node{
+				Substitution{Command: `git log --format=(%h)`, Pos: Pos{0, 1, 1}, End: Pos{24, 1, 25}},
+			},
+		},
+		{
+			name: "escaped parenthesis",
+			body: `$(git log --grep=\))`,
+			expect: []Node{
+				Substitution{Command: `git log --grep=\)`, Pos: Pos{0, 1, 1}, End: Pos{20, 1, 21}},
+			},
+		},
+		{
+			name: "escaped quote inside double quotes",
+			body: `$(git log --grep="a\")")`,
+			expect: []Node{
+				Substitution{Command: `git log --grep="a\")"`, Pos: Pos{0, 1, 1}, End: Pos{24, 1, 25}},
+			},
+		},
+		{
+			name: "substitution spanning lines",
+			body: "A\n$(git log\n  --oneline)\nB",
+			expect: []Node{
+				Text{Value: "A\n", Pos: Pos{0, 1, 1}},
+				Substitution{Command: "git log\n  --oneline", Pos: Pos{2, 2, 1}, End: Pos{24, 3, 13}},
+				Text{Value: "\nB", Pos: Pos{24, 3, 13}},
+			},
+		},
+		{
+			name: "escaped substitution is literal",
+			body: `Use \$(git diff) to include the diff`,
+			expect: []Node{
+				Text{Value: "Use $(git diff) to include the diff", Pos: Pos{0, 1, 1}},
+			},
+		},
+		{
+			name: "lone dollar and backslash are literal",
+			body: `cost $5 \n`,
+			expect: []Node{
+				Text{Value: `cost $5 \n`, Pos: Pos{0, 1, 1}},
+			},
+		},
+		{
+			name: "adjacent substitutions",
+			body: "$(a)$(b)",
+			expect: []Node{
+				Substitution{Command: "a", Pos: Pos{0, 1, 1}, End: Pos{4, 1, 5}},
+				Substitution{Command: "b", Pos: Pos{4, 1, 5}, End: Pos{8, 1, 9}},
+			},
+		},
+		{
+			name:   "empty substitution",
+			body:   "$()",
+			expect: []Node{Substitution{Command: "", Pos: Pos{0, 1, 1}, End: Pos{3, 1, 4}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := Parse(tt.body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expect, nodes)
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		pos    Pos
+		msg    string
+		expect []Node
+	}{
+		{
+			name: "unterminated substitution",
+			body: "Diff: $(git diff",
+			pos:  Pos{6, 1, 7},
+			msg:  "line 1, column 7: unterminated $(...)",
+			expect: []Node{
+				Text{Value: "Diff: $(git diff", Pos: Pos{0, 1, 1}},
+			},
+		},
+		{
+			name: "unterminated quote",
+			body: "$(a)\n$(git log --grep='x)",
+			pos:  Pos{22, 2, 18},
+			msg:  "line 2, column 18: unterminated ' quote in $(...)",
+			expect: []Node{
+				Substitution{Command: "a", Pos: Pos{0, 1, 1}, End: Pos{4, 1, 5}},
+				Text{Value: "\n$(git log --grep='x)", Pos: Pos{4, 1, 5}},
+			},
+		},
+		{
+			name: "unbalanced parentheses",
+			body: "$(git log (x)",
+			pos:  Pos{0, 1, 1},
+			msg:  "line 1, column 1: unterminated $(...)",
+			expect: []Node{
+				Text{Value: "$(git log (x)", Pos: Pos{0, 1, 1}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := Parse(tt.body)
+
+			var syntaxErr *SyntaxError
+			require.ErrorAs(t, err, &syntaxErr)
+			assert.Equal(t, tt.pos, syntaxErr.Pos)
+			assert.EqualError(t, err, tt.msg)
+			assert.Equal(t, tt.expect, nodes)
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	t.Run("single pass", func(t *testing.T) {
+		nodes, err := Parse("a $(first) b")
+		require.NoError(t, err)
+
+		calls := 0
+		out := Expand(nodes, func(s Substitution) string {
+			calls++
+			return "$(second)"
+		})
+
+		assert.Equal(t, "a $(second) b", out)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("escaped substitution is not evaluated", func(t *testing.T) {
+		nodes, err := Parse(`\$(git diff)`)
+		require.NoError(t, err)
+
+		out := Expand(nodes, func(s Substitution) string {
+			t.Fatalf("unexpected evaluation of %q", s.Command)
+			return ""
+		})
+
+		assert.Equal(t, "$(git diff)", out)
+	})
+
+	t.Run("substitutions are listed in order", func(t *testing.T) {
+		nodes, err := Parse("$(a) x $(b)")
+		require.NoError(t, err)
+
+		subs := Substitutions(nodes)
+
+		require.Len(t, subs, 2)
+		assert.Equal(t, "$(a)", subs[0].Source())
+		assert.Equal(t, "$(b)", subs[1].Source())
+	})
+}
@@ -0,0 +1,278 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/trknhr/chatgpt-dev-utils/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// customName is the free-form template that is always listed last
+const customName = "Custom..."
+
+// Policy decides what happens when a template command fails
+type Policy string
+
+const (
+	PolicyFail        Policy = "fail"        // do not send the prompt
+	PolicyPlaceholder Policy = "placeholder" // insert "[git error: ...]" (default)
+	PolicyOmit        Policy = "omit"        // leave the substitution out
+)
+
+// Template is a named prompt body for either the "file" or "git" prompt type
+type Template struct {
+	Kind        string `yaml:"kind"`
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Body        string `yaml:"body"`
+	OnError     Policy `yaml:"on_error"`
+	Source      string `yaml:"-"` // file the template was loaded from, empty for built-ins
+	// Overrides is the Source of the template this one replaced, "built-in"
+	// for a built-in, or empty if it replaced none
+	Overrides string `yaml:"-"`
+}
+
+// FromProject reports whether the template was loaded from the project
+// template directory, which comes with the repository
+func (t Template) FromProject() bool {
+	dir := filepath.Join(config.ProjectDir, "templates") + string(filepath.Separator)
+	return strings.HasPrefix(filepath.Clean(t.Source), dir)
+}
+
+// Commands returns the commands a git template runs, in template order. File
+// templates run none.
+func (t Template) Commands() []string {
+	if t.Kind != "git" {
+		return nil
+	}
+	nodes, _ := Parse(t.Body)
+	var commands []string
+	for _, s := range Substitutions(nodes) {
+		commands = append(commands, s.Command)
+	}
+	return commands
+}
+
+// NeedsConfirmation reports whether the template comes with the repository
+// and runs commands, which the user must agree to before they run
+func (t Template) NeedsConfirmation() bool {
+	return t.FromProject() && len(t.Commands()) > 0
+}
+
+var builtin = []Template{
+	{Kind: "git", Name: "Code Review", Description: "Review the staged diff", Body: "Please review this diff and provide feedback:\n\n$(git diff --cached)\n\nFocus on:\n- Code quality\n- Security issues\n- Performance considerations"},
+	{Kind: "git", Name: "Commit Message", Description: "Write a commit message for the staged changes", Body: "Generate a concise commit message for the following staged changes:\n```\n$(git diff --cached)\n```\n\nFollow the format used in recent commits:\n```\n$(git log -n 3 --pretty=format:%s)\n```\n\nFormat: type(scope): description\n\nOnly return the commit message in plain text. Do not include explanations or comments."},
+	{Kind: "git", Name: "Change Summary", Description: "Summarize the last commit", Body: "Summarize the changes in this commit:\n\n$(git log --oneline -1)\n$(git diff HEAD~1)"},
+	{Kind: "git", Name: customName, Description: "Start from the staged diff", Body: "$(git diff --cached)"},
+	{Kind: "file", Name: "Code Review", Description: "Review the selected files", Body: "Please review this code and provide feedback:\n\n$(files)\n\nFocus on:\n- Code quality\n- Best practices\n- Potential issues"},
+	{Kind: "file", Name: "Documentation", Description: "Document the selected files", Body: "Generate documentation for this code:\n\n$(files)\n\nInclude:\n- Function descriptions\n- Usage examples\n- Parameters and return values"},
+	{Kind: "file", Name: customName, Description: "Write your own prompt", Body: "Please add your prompt with $(files)"},
+}
+
+// Registry holds the built-in templates plus any loaded from template directories
+type Registry struct {
+	templates []Template
+}
+
+// NewRegistry creates a registry containing only the built-in templates
+func NewRegistry() *Registry {
+	r := &Registry{}
+	for _, t := range builtin {
+		r.Add(t)
+	}
+	return r
+}
+
+// Add registers a template. A template with the same kind and name is replaced
+// in place and recorded in Overrides; new templates are listed before the
+// "Custom..." entry.
+func (r *Registry) Add(t Template) {
+	for i, existing := range r.templates {
+		if existing.Kind == t.Kind && existing.Name == t.Name {
+			t.Overrides = existing.Source
+			if t.Overrides == "" {
+				t.Overrides = "built-in"
+			}
+			r.templates[i] = t
+			return
+		}
+	}
+	if t.Name != customName {
+		for i, existing := range r.templates {
+			if existing.Kind == t.Kind && existing.Name == customName {
+				r.templates = append(r.templates[:i], append([]Template{t}, r.templates[i:]...)...)
+				return
+			}
+		}
+	}
+	r.templates = append(r.templates, t)
+}
+
+// Names returns the template names for a prompt type in display order
+func (r *Registry) Names(kind string) []string {
+	var names []string
+	for _, t := range r.templates {
+		if t.Kind == kind {
+			names = append(names, t.Name)
+		}
+	}
+	return names
+}
+
+// Get looks up a template by prompt type and name
+func (r *Registry) Get(kind, name string) (Template, bool) {
+	for _, t := range r.templates {
+		if t.Kind == kind && t.Name == name {
+			return t, true
+		}
+	}
+	return Template{}, false
+}
+
+// LoadDir adds every *.md, *.yaml and *.yml template in dir. A missing
+// directory is not an error; invalid files are skipped and reported.
+func (r *Registry) LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var errs []error
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".md", ".yaml", ".yml":
+		default:
+			continue
+		}
+		t, err := ParseFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		r.Add(t)
+	}
+	return errors.Join(errs...)
+}
+
+// ParseFile reads a template from a Markdown file with YAML front matter or
+// from a YAML file with kind, name, description and body keys
+func ParseFile(path string) (Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Template{}, err
+	}
+
+	var t Template
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".md" {
+		t, err = parseMarkdown(data)
+	} else {
+		err = yaml.Unmarshal(data, &t)
+	}
+	if err != nil {
+		return Template{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if t.Name == "" {
+		t.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if t.Kind == "" {
+		t.Kind = "git"
+		if strings.Contains(t.Body, "$(files)") {
+			t.Kind = "file"
+		}
+	}
+	if t.Kind != "file" && t.Kind != "git" {
+		return Template{}, fmt.Errorf("%s: unknown kind %q (expected file or git)", path, t.Kind)
+	}
+	if strings.TrimSpace(t.Body) == "" {
+		return Template{}, fmt.Errorf("%s: template body is empty", path)
+	}
+	switch t.OnError {
+	case "":
+		t.OnError = PolicyPlaceholder
+	case PolicyFail, PolicyPlaceholder, PolicyOmit:
+	default:
+		return Template{}, fmt.Errorf("%s: unknown on_error %q (expected fail, placeholder or omit)", path, t.OnError)
+	}
+	t.Source = path
+	return t, nil
+}
+
+// parseMarkdown splits optional "---" delimited front matter from the body
+func parseMarkdown(data []byte) (Template, error) {
+	var t Template
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	if !bytes.HasPrefix(data, []byte("---\n")) {
+		t.Body = strings.TrimSpace(string(data))
+		return t, nil
+	}
+
+	rest := data[len("---\n"):]
+	end := bytes.Index(rest, []byte("\n---"))
+	if end == -1 {
+		return t, errors.New("front matter is not terminated by ---")
+	}
+	if err := yaml.Unmarshal(rest[:end], &t); err != nil {
+		return t, err
+	}
+	body := rest[end+len("\n---"):]
+	if i := bytes.IndexByte(body, '\n'); i != -1 {
+		body = body[i+1:]
+	} else {
+		body = nil
+	}
+	t.Body = strings.TrimSpace(string(body))
+	return t, nil
+}
+
+// Load builds a registry from the built-ins, the user template directory and
+// the project template directory, in that order of precedence
+func Load() (*Registry, error) {
+	r := NewRegistry()
+	var errs []error
+	if dir := config.Dir(); dir != "" {
+		errs = append(errs, r.LoadDir(filepath.Join(dir, "templates")))
+	}
+	errs = append(errs, r.LoadDir(filepath.Join(config.ProjectDir, "templates")))
+	return r, errors.Join(errs...)
+}
+
+var defaultRegistry = NewRegistry()
+
+// Default returns the registry used by the TUI and the subcommands
+func Default() *Registry { return defaultRegistry }
+
+// SetDefault replaces the registry returned by Default
+func SetDefault(r *Registry) { defaultRegistry = r }
+
+// Names returns the template names of the default registry
+func Names(kind string) []string { return defaultRegistry.Names(kind) }
+
+// Body returns a template body from the default registry
+func Body(kind, name string) (string, bool) {
+	t, ok := defaultRegistry.Get(kind, name)
+	return t.Body, ok
+}
+
+// OnError returns the error policy of a template in the default registry
+func OnError(kind, name string) Policy {
+	if t, ok := defaultRegistry.Get(kind, name); ok && t.OnError != "" {
+		return t.OnError
+	}
+	return PolicyPlaceholder
+}
@@ -0,0 +1,174 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trknhr/chatgpt-dev-utils/internal/config"
+)
+
+func TestNames(t *testing.T) {
+	t.Run("git templates keep display order", func(t *testing.T) {
+		assert.Equal(t, []string{"Code Review", "Commit Message", "Change Summary", "Custom..."}, Names("git"))
+	})
+
+	t.Run("file templates keep display order", func(t *testing.T) {
+		assert.Equal(t, []string{"Code Review", "Documentation", "Custom..."}, Names("file"))
+	})
+
+	t.Run("unknown kind has no templates", func(t *testing.T) {
+		assert.Empty(t, Names("unknown"))
+	})
+}
+
+func TestBody(t *testing.T) {
+	t.Run("same name differs by kind", func(t *testing.T) {
+		gitBody, ok := Body("git", "Code Review")
+		assert.True(t, ok)
+		assert.Contains(t, gitBody, "$(git diff --cached)")
+
+		fileBody, ok := Body("file", "Code Review")
+		assert.True(t, ok)
+		assert.Contains(t, fileBody, "$(files)")
+	})
+
+	t.Run("unknown template", func(t *testing.T) {
+		_, ok := Body("git", "Does not exist")
+		assert.False(t, ok)
+	})
+}
+
+func TestRegistryLoadDir(t *testing.T) {
+	writeFile := func(t *testing.T, dir, name, content string) {
+		t.Helper()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	t.Run("markdown with front matter", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, "review.md", "---\nkind: git\nname: Team Review\ndescription: Our review checklist\n---\nReview:\n\n$(git diff --cached)\n")
+
+		r := NewRegistry()
+		require.NoError(t, r.LoadDir(dir))
+
+		tmpl, ok := r.Get("git", "Team Review")
+		require.True(t, ok)
+		assert.Equal(t, "Our review checklist", tmpl.Description)
+		assert.Equal(t, "Review:\n\n$(git diff --cached)", tmpl.Body)
+		assert.Equal(t, filepath.Join(dir, "review.md"), tmpl.Source)
+	})
+
+	t.Run("yaml file", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, "explain.yaml", "kind: file\nname: Explain\nbody: |\n  Explain this code:\n  $(files)\n")
+
+		r := NewRegistry()
+		require.NoError(t, r.LoadDir(dir))
+
+		body, ok := r.Get("file", "Explain")
+		require.True(t, ok)
+		assert.Equal(t, "Explain this code:\n$(files)\n", body.Body)
+	})
+
+	t.Run("name and kind are inferred", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, "Tests.md", "Write tests for:\n$(files)")
+
+		r := NewRegistry()
+		require.NoError(t, r.LoadDir(dir))
+
+		_, ok := r.Get("file", "Tests")
+		assert.True(t, ok)
+	})
+
+	t.Run("new templates are listed before Custom", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, "a.md", "---\nkind: git\nname: Release Notes\n---\n$(git log --oneline -10)")
+
+		r := NewRegistry()
+		require.NoError(t, r.LoadDir(dir))
+
+		assert.Equal(t, []string{"Code Review", "Commit Message", "Change Summary", "Release Notes", "Custom..."}, r.Names("git"))
+	})
+
+	t.Run("project template overrides built-in", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, "commit.md", "---\nkind: git\nname: Commit Message\n---\nConventional commit for:\n$(git diff --cached)")
+
+		r := NewRegistry()
+		require.NoError(t, r.LoadDir(dir))
+
+		tmpl, ok := r.Get("git", "Commit Message")
+		require.True(t, ok)
+		assert.Contains(t, tmpl.Body, "Conventional commit")
+		assert.Equal(t, "built-in", tmpl.Overrides)
+		assert.Len(t, r.Names("git"), 4)
+
+		other := t.TempDir()
+		writeFile(t, other, "commit.md", "---\nkind: git\nname: Commit Message\n---\n$(git diff)")
+		require.NoError(t, r.LoadDir(other))
+		tmpl, _ = r.Get("git", "Commit Message")
+		assert.Equal(t, filepath.Join(dir, "commit.md"), tmpl.Overrides)
+	})
+
+	t.Run("templates from the project are marked", func(t *testing.T) {
+		t.Chdir(t.TempDir())
+		require.NoError(t, os.MkdirAll(filepath.Join(config.ProjectDir, "templates"), 0755))
+		writeFile(t, filepath.Join(config.ProjectDir, "templates"), "mine.md", "---\nname: Mine\n---\n$(git status)")
+		t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+		r, err := Load()
+		require.NoError(t, err)
+		tmpl, ok := r.Get("git", "Mine")
+		require.True(t, ok)
+		assert.True(t, tmpl.FromProject())
+		assert.True(t, tmpl.NeedsConfirmation())
+		assert.Equal(t, []string{"git status"}, tmpl.Commands())
+		assert.Empty(t, tmpl.Overrides)
+		builtin, _ := r.Get("git", "Code Review")
+		assert.False(t, builtin.FromProject())
+		assert.False(t, builtin.NeedsConfirmation())
+	})
+
+	t.Run("invalid files are reported and skipped", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, "bad.md", "---\nkind: svn\n---\nbody")
+		writeFile(t, dir, "empty.yaml", "kind: git\nname: Empty\n")
+		writeFile(t, dir, "good.md", "---\nkind: git\nname: Good\n---\n$(git status)")
+		writeFile(t, dir, "notes.txt", "ignored")
+
+		r := NewRegistry()
+		err := r.LoadDir(dir)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "bad.md")
+		assert.Contains(t, err.Error(), "empty.yaml")
+
+		_, ok := r.Get("git", "Good")
+		assert.True(t, ok)
+	})
+
+	t.Run("error policy", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, "strict.md", "---\nname: Strict\non_error: fail\n---\n$(git diff --cached)")
+		writeFile(t, dir, "loose.md", "---\nname: Loose\n---\n$(git diff --cached)")
+		writeFile(t, dir, "typo.md", "---\nname: Typo\non_error: ignore\n---\n$(git diff --cached)")
+
+		r := NewRegistry()
+		err := r.LoadDir(dir)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `typo.md: unknown on_error "ignore"`)
+
+		strict, _ := r.Get("git", "Strict")
+		assert.Equal(t, PolicyFail, strict.OnError)
+		loose, _ := r.Get("git", "Loose")
+		assert.Equal(t, PolicyPlaceholder, loose.OnError)
+	})
+
+	t.Run("missing directory is not an error", func(t *testing.T) {
+		r := NewRegistry()
+		assert.NoError(t, r.LoadDir(filepath.Join(t.TempDir(), "missing")))
+	})
+}
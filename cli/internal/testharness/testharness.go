@@ -0,0 +1,267 @@
+// Package testharness runs the WebSocket server on an ephemeral port and
+// connects fake extension clients to it, so the path from the TUI to the
+// browser can be tested without Chrome.
+package testharness
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/gorilla/websocket"
+	"github.com/trknhr/chatgpt-dev-utils/internal/hub"
+	"github.com/trknhr/chatgpt-dev-utils/internal/pairing"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+	"github.com/trknhr/chatgpt-dev-utils/internal/server"
+)
+
+// Origin is the extension origin the harness server allows
+const Origin = "chrome-extension://testharness"
+
+// Timeout bounds every wait in the harness
+var Timeout = 2 * time.Second
+
+// Env is a running server with a pairing token in a temporary directory
+type Env struct {
+	Server *server.Server
+	Store  *pairing.Store
+}
+
+// Start runs a server on a free loopback port until the test ends
+func Start(t testing.TB) *Env {
+	t.Helper()
+	store, err := pairing.Open(filepath.Join(t.TempDir(), "token"))
+	if err != nil {
+		t.Fatalf("open pairing store: %v", err)
+	}
+	srv, err := server.Listen("127.0.0.1:0", pairing.Guard{Store: store, AllowedOrigins: []string{Origin}})
+	if err != nil {
+		t.Fatalf("start server: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return &Env{Server: srv, Store: store}
+}
+
+// Hub returns the hub the TUI talks to
+func (e *Env) Hub() *hub.Hub { return e.Server.Hub() }
+
+// URL returns the WebSocket URL of path with the given pairing token
+func (e *Env) URL(path, token string) string {
+	u := url.URL{Scheme: "ws", Host: e.Server.Addr(), Path: path}
+	if token != "" {
+		u.RawQuery = url.Values{"token": {token}}.Encode()
+	}
+	return u.String()
+}
+
+// Dial opens a raw WebSocket to /ws, returning the HTTP response so tests
+// can check rejected handshakes
+func (e *Env) Dial(origin, token string) (*websocket.Conn, *http.Response, error) {
+	header := http.Header{}
+	if origin != "" {
+		header.Set("Origin", origin)
+	}
+	dialer := websocket.Dialer{HandshakeTimeout: Timeout}
+	return dialer.Dial(e.URL("/ws", token), header)
+}
+
+// Connect pairs a fake extension, says hello with info and waits until the
+// hub lists it
+func (e *Env) Connect(t testing.TB, info protocol.ClientInfo) *FakeExtension {
+	t.Helper()
+	conn, _, err := e.Dial(Origin, e.Store.Token())
+	if err != nil {
+		t.Fatalf("connect fake extension: %v", err)
+	}
+	f := &FakeExtension{t: t, conn: conn}
+	t.Cleanup(func() { conn.Close() })
+	f.Send(protocol.Message{Type: protocol.TypeHello, Client: &info})
+
+	deadline := time.Now().Add(Timeout)
+	for !slices.Contains(e.Hub().Clients(), info) {
+		if time.Now().After(deadline) {
+			t.Fatalf("fake extension %q was not registered", info.ID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return f
+}
+
+// FakeExtension plays the Chrome extension: it reads the frames cdev sends
+// and answers with acks and replies
+type FakeExtension struct {
+	t    testing.TB
+	conn *websocket.Conn
+}
+
+// ReadRaw returns the next frame exactly as it was sent
+func (f *FakeExtension) ReadRaw() []byte {
+	f.t.Helper()
+	f.conn.SetReadDeadline(time.Now().Add(Timeout))
+	_, data, err := f.conn.ReadMessage()
+	if err != nil {
+		f.t.Fatalf("fake extension read: %v", err)
+	}
+	return data
+}
+
+// Read returns the next frame decoded
+func (f *FakeExtension) Read() protocol.Message {
+	f.t.Helper()
+	m, err := protocol.Decode(f.ReadRaw())
+	if err != nil {
+		f.t.Fatalf("fake extension decode: %v", err)
+	}
+	return m
+}
+
+// ExpectNothing fails the test if a frame arrives within wait
+func (f *FakeExtension) ExpectNothing(wait time.Duration) {
+	f.t.Helper()
+	f.conn.SetReadDeadline(time.Now().Add(wait))
+	if _, data, err := f.conn.ReadMessage(); err == nil {
+		f.t.Fatalf("fake extension got unexpected frame %s", data)
+	}
+}
+
+// Send writes a protocol message to cdev
+func (f *FakeExtension) Send(m protocol.Message) {
+	f.t.Helper()
+	data, err := m.Encode()
+	if err != nil {
+		f.t.Fatalf("encode: %v", err)
+	}
+	if err := f.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		f.t.Fatalf("fake extension write: %v", err)
+	}
+}
+
+// Ack acknowledges the prompt with the request id
+func (f *FakeExtension) Ack(id string) {
+	f.Send(protocol.Message{Type: protocol.TypeAck, ID: id})
+}
+
+// Chunk streams part of the reply
+func (f *FakeExtension) Chunk(id, text string) {
+	f.Send(protocol.Message{Type: protocol.TypeResponseChunk, ID: id, Text: text})
+}
+
+// Done finishes the reply with its full text
+func (f *FakeExtension) Done(id, text string) {
+	f.Send(protocol.Message{Type: protocol.TypeResponseDone, ID: id, Text: text})
+}
+
+// Fail reports an error for the request
+func (f *FakeExtension) Fail(id, reason string) {
+	f.Send(protocol.Message{Type: protocol.TypeError, ID: id, Error: reason})
+}
+
+// Close disconnects the fake extension
+func (f *FakeExtension) Close() {
+	f.conn.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	f.conn.Close()
+}
+
+// Key returns the key message for s, e.g. "e", "tab" or "esc"
+func Key(s string) tea.KeyMsg {
+	switch s {
+	case "tab":
+		return tea.KeyMsg{Type: tea.KeyTab}
+	case "esc":
+		return tea.KeyMsg{Type: tea.KeyEsc}
+	case "enter":
+		return tea.KeyMsg{Type: tea.KeyEnter}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+// Await runs cmd, including every command of a batch, and returns the first
+// message match accepts. Commands that block, like waiting for the next
+// connection event, are left running.
+func Await(t testing.TB, cmd tea.Cmd, match func(tea.Msg) bool) tea.Msg {
+	t.Helper()
+	msgs := make(chan tea.Msg, 16)
+	var run func(tea.Cmd)
+	run = func(cmd tea.Cmd) {
+		if cmd == nil {
+			return
+		}
+		go func() {
+			msg := cmd()
+			if batch, ok := msg.(tea.BatchMsg); ok {
+				for _, c := range batch {
+					run(c)
+				}
+				return
+			}
+			msgs <- msg
+		}()
+	}
+	run(cmd)
+
+	timeout := time.After(Timeout)
+	for {
+		select {
+		case msg := <-msgs:
+			if match(msg) {
+				return msg
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for a matching tea.Msg")
+			return nil
+		}
+	}
+}
+
+// Settle plays the Bubble Tea event loop: it runs cmd, feeds every message
+// it produces back into model and runs the resulting commands, until done
+// accepts the model. Blocking commands are left running.
+func Settle(t testing.TB, model tea.Model, cmd tea.Cmd, done func(tea.Model) bool) (tea.Model, tea.Cmd) {
+	t.Helper()
+	msgs := make(chan tea.Msg, 64)
+	var run func(tea.Cmd)
+	run = func(cmd tea.Cmd) {
+		if cmd == nil {
+			return
+		}
+		go func() {
+			msg := cmd()
+			if batch, ok := msg.(tea.BatchMsg); ok {
+				for _, c := range batch {
+					run(c)
+				}
+				return
+			}
+			if msg != nil {
+				msgs <- msg
+			}
+		}()
+	}
+
+	if done(model) {
+		return model, cmd
+	}
+	run(cmd)
+	timeout := time.After(Timeout)
+	for {
+		select {
+		case msg := <-msgs:
+			if _, ok := msg.(tea.QuitMsg); ok {
+				t.Fatal("model quit before settling")
+			}
+			model, cmd = model.Update(msg)
+			if done(model) {
+				return model, cmd
+			}
+			run(cmd)
+		case <-timeout:
+			t.Fatal("timed out waiting for the model to settle")
+			return model, nil
+		}
+	}
+}
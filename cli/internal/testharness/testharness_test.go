@@ -0,0 +1,148 @@
+package testharness
+
+import (
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+	"github.com/trknhr/chatgpt-dev-utils/internal/ui/components"
+)
+
+// anyMsg accepts the first message a command produces
+func anyMsg(tea.Msg) bool { return true }
+
+// isResult reports whether the prompt was delivered and the reply view opened
+func isResult(model tea.Model) bool {
+	_, ok := model.(*components.Result)
+	return ok
+}
+
+func TestEndToEnd(t *testing.T) {
+	t.Run("Final sends the prompt frame to the extension", func(t *testing.T) {
+		env := Start(t)
+		ext := env.Connect(t, protocol.ClientInfo{ID: "chrome", Browser: "Chrome"})
+
+		final := components.NewFinal("git", "Template", "Review this", nil, 80, 24, true, env.Hub())
+		model, cmd := final.Update(Key("e"))
+		require.NotNil(t, cmd)
+		model, _ = Settle(t, model, cmd, isResult)
+		result := model.(*components.Result)
+
+		m := ext.Read()
+		assert.Equal(t, protocol.Version, m.Version)
+		assert.Equal(t, protocol.TypePrompt, m.Type)
+		assert.Equal(t, result.RequestID, m.ID)
+		assert.Equal(t, "Review this", m.Prompt)
+		assert.Empty(t, m.Target)
+	})
+
+	t.Run("Result view shows the streamed reply", func(t *testing.T) {
+		env := Start(t)
+		ext := env.Connect(t, protocol.ClientInfo{ID: "chrome"})
+
+		final := components.NewFinal("git", "Template", "Review this", nil, 80, 24, true, env.Hub())
+		model, cmd := final.Update(Key("e"))
+		model, cmd = Settle(t, model, cmd, isResult)
+		id := ext.Read().ID
+
+		ext.Ack(id)
+		model, cmd = model.Update(Await(t, cmd, anyMsg))
+		assert.Contains(t, model.View(), "ChatGPT is answering...")
+
+		ext.Chunk(id, "Looks ")
+		model, cmd = model.Update(Await(t, cmd, anyMsg))
+		ext.Done(id, "Looks good")
+		model, _ = model.Update(Await(t, cmd, anyMsg))
+
+		result := model.(*components.Result)
+		assert.Equal(t, "Done", result.Status)
+		assert.Equal(t, "Looks good", result.Response)
+		assert.Contains(t, model.View(), "Looks good")
+	})
+
+	t.Run("extension error is shown", func(t *testing.T) {
+		env := Start(t)
+		ext := env.Connect(t, protocol.ClientInfo{ID: "chrome"})
+
+		final := components.NewFinal("git", "Template", "Review this", nil, 80, 24, true, env.Hub())
+		model, cmd := final.Update(Key("e"))
+		model, cmd = Settle(t, model, cmd, isResult)
+		ext.Fail(ext.Read().ID, "no ChatGPT tab")
+		model, _ = model.Update(Await(t, cmd, anyMsg))
+
+		assert.Contains(t, model.View(), "Error: no ChatGPT tab")
+	})
+
+	t.Run("prompt goes to the selected target only", func(t *testing.T) {
+		env := Start(t)
+		work := env.Connect(t, protocol.ClientInfo{ID: "work", Profile: "Work"})
+		personal := env.Connect(t, protocol.ClientInfo{ID: "personal", Profile: "Personal"})
+
+		final := components.NewFinal("git", "Template", "Review this", nil, 120, 40, true, env.Hub())
+		assert.Contains(t, final.View(), "Browser · Personal [personal]")
+		final.Update(Key("t"))
+		final.Update(Key("t"))
+		require.Equal(t, "personal", final.Target)
+		_, cmd := final.Update(Key("e"))
+		Settle(t, final, cmd, isResult)
+
+		assert.Equal(t, "personal", personal.Read().Target)
+		work.ExpectNothing(100 * time.Millisecond)
+	})
+
+	t.Run("Root shows the connection status", func(t *testing.T) {
+		env := Start(t)
+		root := components.NewRoot(80, 24, env.Hub(), env.Store.Token())
+		assert.Contains(t, root.View(), "Extension not connected · pairing token: "+env.Store.Token())
+
+		cmd := root.Init()
+		ext := env.Connect(t, protocol.ClientInfo{ID: "chrome"})
+		msg := Await(t, cmd, func(msg tea.Msg) bool {
+			c, ok := msg.(components.ConnectionMsg)
+			return ok && c.Clients == 1
+		})
+		_, cmd = root.Update(msg)
+		assert.NotContains(t, root.View(), "Extension not connected")
+
+		ext.Close()
+		msg = Await(t, cmd, func(msg tea.Msg) bool {
+			c, ok := msg.(components.ConnectionMsg)
+			return ok && c.Clients == 0
+		})
+		root.Update(msg)
+		assert.Contains(t, root.View(), "Extension not connected")
+	})
+}
+
+func TestHandshake(t *testing.T) {
+	env := Start(t)
+
+	tests := []struct {
+		name   string
+		origin string
+		token  string
+		status int
+	}{
+		{name: "missing token", origin: Origin, token: "", status: 401},
+		{name: "wrong token", origin: Origin, token: "AAAA-BBBB-CCCC-DDDD", status: 401},
+		{name: "web page origin", origin: "https://example.com", token: env.Store.Token(), status: 403},
+		{name: "no origin", origin: "", token: env.Store.Token(), status: 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, resp, err := env.Dial(tt.origin, tt.token)
+			require.Error(t, err)
+			require.NotNil(t, resp)
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+
+	t.Run("paired extension is accepted", func(t *testing.T) {
+		conn, _, err := env.Dial(Origin, env.Store.Token())
+		require.NoError(t, err)
+		conn.Close()
+	})
+}
@@ -0,0 +1,118 @@
+package tokens
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/trknhr/chatgpt-dev-utils/internal/config"
+)
+
+// Level is how a token count compares to a budget
+type Level int
+
+const (
+	OK   Level = iota
+	Warn       // close to the limit
+	Over       // over the limit
+)
+
+// Budget is the number of tokens a prompt may use
+type Budget struct {
+	Model  Model
+	Limit  int
+	WarnAt float64 // share of Limit from which counts are flagged
+	Block  bool    // refuse to send prompts over Limit
+	Part   int     // most tokens per message before a prompt is split
+}
+
+// NewBudget builds a budget from the config. An unknown model is reported
+// and replaced by DefaultModel.
+func NewBudget(cfg config.Budget) (Budget, error) {
+	var err error
+	name := cfg.Model
+	if name == "" {
+		name = DefaultModel
+	}
+	model, ok := Lookup(name)
+	if !ok {
+		err = fmt.Errorf("unknown budget model %q (known: %v)", name, Models())
+		model, _ = Lookup(DefaultModel)
+	}
+	b := Budget{Model: model, Limit: cfg.Limit, WarnAt: cfg.Warn, Block: cfg.Block, Part: cfg.Part}
+	if b.Limit <= 0 {
+		b.Limit = model.Window
+	}
+	if b.Part <= 0 || b.Part > b.Limit {
+		b.Part = b.Limit
+	}
+	if b.WarnAt <= 0 || b.WarnAt > 1 {
+		b.WarnAt = 0.8
+	}
+	return b, err
+}
+
+// Check compares n tokens to the budget
+func (b Budget) Check(n int) Level {
+	switch {
+	case n > b.Limit:
+		return Over
+	case float64(n) >= b.WarnAt*float64(b.Limit):
+		return Warn
+	}
+	return OK
+}
+
+// Describe summarizes n against the budget, e.g. "1,234 / 128,000 tokens (gpt-4o)"
+func (b Budget) Describe(n int) string {
+	return fmt.Sprintf("%s / %s tokens (%s)", Format(n), Format(b.Limit), b.Model.Name)
+}
+
+// Count returns the number of tokens text uses with the budget's model
+func (b Budget) Count(text string) (int, error) {
+	return Count(b.Model.Encoding, text)
+}
+
+// Counter returns Count as a function for splitting prompts; text that
+// cannot be counted counts as its length in bytes
+func (b Budget) Counter() func(string) int {
+	return func(text string) int {
+		n, err := b.Count(text)
+		if err != nil {
+			return len(text)
+		}
+		return n
+	}
+}
+
+// Format writes n with thousands separators
+func Format(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0 && s[i-1] != '-'; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+var (
+	mu      sync.RWMutex
+	current Budget
+)
+
+func init() {
+	current, _ = NewBudget(config.Budget{})
+}
+
+// Configure sets the budget the UI checks prompts against
+func Configure(b Budget) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = b
+}
+
+// Current returns the configured budget
+func Current() Budget {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
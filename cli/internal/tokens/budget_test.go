@@ -0,0 +1,53 @@
+package tokens
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trknhr/chatgpt-dev-utils/internal/config"
+)
+
+func TestNewBudget(t *testing.T) {
+	t.Run("defaults to the model window", func(t *testing.T) {
+		b, err := NewBudget(config.Budget{Model: "gpt-4"})
+		require.NoError(t, err)
+		assert.Equal(t, 8192, b.Limit)
+		assert.Equal(t, 8192, b.Part)
+		assert.Equal(t, 0.8, b.WarnAt)
+		assert.False(t, b.Block)
+	})
+
+	t.Run("limit overrides the window", func(t *testing.T) {
+		b, err := NewBudget(config.Budget{Limit: 32000, Warn: 0.5, Block: true, Part: 8000})
+		require.NoError(t, err)
+		assert.Equal(t, DefaultModel, b.Model.Name)
+		assert.Equal(t, 32000, b.Limit)
+		assert.Equal(t, 8000, b.Part)
+		assert.Equal(t, 0.5, b.WarnAt)
+		assert.True(t, b.Block)
+	})
+
+	t.Run("unknown model falls back to the default", func(t *testing.T) {
+		b, err := NewBudget(config.Budget{Model: "gpt-2"})
+		assert.ErrorContains(t, err, `unknown budget model "gpt-2"`)
+		assert.Equal(t, DefaultModel, b.Model.Name)
+	})
+}
+
+func TestBudget(t *testing.T) {
+	b, err := NewBudget(config.Budget{Limit: 1000, Warn: 0.8})
+	require.NoError(t, err)
+
+	assert.Equal(t, OK, b.Check(799))
+	assert.Equal(t, Warn, b.Check(800))
+	assert.Equal(t, Warn, b.Check(1000))
+	assert.Equal(t, Over, b.Check(1001))
+	assert.Equal(t, "1,001 / 1,000 tokens (gpt-4o)", b.Describe(1001))
+}
+
+func TestFormat(t *testing.T) {
+	for n, want := range map[int]string{0: "0", 999: "999", 1000: "1,000", 1047576: "1,047,576", -1234: "-1,234"} {
+		assert.Equal(t, want, Format(n))
+	}
+}
@@ -0,0 +1,131 @@
+// Package tokens counts prompt tokens offline and checks them against the
+// context window of a model.
+package tokens
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+
+	"github.com/trknhr/chatgpt-dev-utils/internal/content"
+)
+
+// Encodings understood by Count
+const (
+	CL100K = "cl100k_base"
+	O200K  = "o200k_base"
+)
+
+// Model is a chat model with its tokenizer and context window
+type Model struct {
+	Name     string
+	Encoding string
+	Window   int // context window in tokens
+}
+
+// models lists the models a budget can be set for
+var models = []Model{
+	{Name: "gpt-4o", Encoding: O200K, Window: 128000},
+	{Name: "gpt-4o-mini", Encoding: O200K, Window: 128000},
+	{Name: "gpt-4.1", Encoding: O200K, Window: 1047576},
+	{Name: "o3", Encoding: O200K, Window: 200000},
+	{Name: "o4-mini", Encoding: O200K, Window: 200000},
+	{Name: "gpt-4-turbo", Encoding: CL100K, Window: 128000},
+	{Name: "gpt-4", Encoding: CL100K, Window: 8192},
+	{Name: "gpt-3.5-turbo", Encoding: CL100K, Window: 16385},
+}
+
+// DefaultModel is the model budgets use when none is configured
+const DefaultModel = "gpt-4o"
+
+// Lookup returns the model with the given name
+func Lookup(name string) (Model, bool) {
+	for _, m := range models {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Model{}, false
+}
+
+// Models returns the names of the known models
+func Models() []string {
+	names := make([]string, len(models))
+	for i, m := range models {
+		names[i] = m.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	// The vocabularies are embedded in the binary; nothing is downloaded
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// encoders builds each tokenizer once, on first use
+var encoders = map[string]func() (*tiktoken.Tiktoken, error){
+	CL100K: sync.OnceValues(func() (*tiktoken.Tiktoken, error) { return tiktoken.GetEncoding(CL100K) }),
+	O200K:  sync.OnceValues(func() (*tiktoken.Tiktoken, error) { return tiktoken.GetEncoding(O200K) }),
+}
+
+// Count returns the number of tokens text encodes to. Special tokens in the
+// text are counted as ordinary text.
+func Count(encoding, text string) (int, error) {
+	encoder, ok := encoders[encoding]
+	if !ok {
+		return 0, fmt.Errorf("unknown encoding %q", encoding)
+	}
+	enc, err := encoder()
+	if err != nil {
+		return 0, err
+	}
+	return len(enc.EncodeOrdinary(text)), nil
+}
+
+// fileKey identifies a version of a file
+type fileKey struct {
+	path, encoding string
+	size           int64
+	modTime        time.Time
+}
+
+var (
+	filesMu sync.Mutex
+	files   = map[fileKey]int{}
+)
+
+// CountFile returns the number of tokens the file at path adds to a prompt:
+// none for a binary file, and those of the first and last lines of a large
+// one. Counts are cached until the file changes.
+func CountFile(encoding, path string) (int, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	key := fileKey{path: path, encoding: encoding, size: info.Size(), modTime: info.ModTime()}
+	filesMu.Lock()
+	n, ok := files[key]
+	filesMu.Unlock()
+	if ok {
+		return n, nil
+	}
+
+	// Count the text a prompt holds of the file
+	f, err := content.Current().Read(path)
+	if err != nil {
+		return 0, err
+	}
+	if n, err = Count(encoding, f.Text); err != nil {
+		return 0, err
+	}
+	filesMu.Lock()
+	files[key] = n
+	filesMu.Unlock()
+	return n, nil
+}
@@ -0,0 +1,71 @@
+package tokens
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		text     string
+		want     int
+	}{
+		{name: "cl100k", encoding: CL100K, text: "hello world", want: 2},
+		{name: "o200k", encoding: O200K, text: "hello world", want: 2},
+		{name: "empty", encoding: O200K, text: "", want: 0},
+		{name: "special tokens are plain text", encoding: CL100K, text: "<|endoftext|>", want: 7},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := Count(tc.encoding, tc.text)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, n)
+		})
+	}
+
+	t.Run("unknown encoding", func(t *testing.T) {
+		_, err := Count("p50k_base", "hello")
+		assert.Error(t, err)
+	})
+}
+
+func TestCountFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	require.NoError(t, os.WriteFile(path, []byte("hello world"), 0644))
+
+	n, err := CountFile(O200K, path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// A changed file is counted again
+	require.NoError(t, os.WriteFile(path, []byte("hello world, hello world"), 0644))
+	n, err = CountFile(O200K, path)
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	// Binary files add nothing to a prompt
+	bin := filepath.Join(t.TempDir(), "a.bin")
+	require.NoError(t, os.WriteFile(bin, []byte("\x00\x01\x02 hello world"), 0644))
+	n, err = CountFile(O200K, bin)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	_, err = CountFile(O200K, filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestLookup(t *testing.T) {
+	m, ok := Lookup("gpt-4")
+	require.True(t, ok)
+	assert.Equal(t, Model{Name: "gpt-4", Encoding: CL100K, Window: 8192}, m)
+
+	_, ok = Lookup("gpt-2")
+	assert.False(t, ok)
+	assert.Contains(t, Models(), DefaultModel)
+}
@@ -34,11 +34,11 @@ func TestComponentInterface(t *testing.T) {
 		},
 		{
 			name:      "Final",
-			component: NewFinal("git", "Template", "Prompt", nil, 80, 24, false, nil, nil),
+			component: NewFinal("git", "Template", "Prompt", nil, 80, 24, false, nil),
 		},
 		{
 			name:      "Root",
-			component: NewRoot(80, 24, nil, nil),
+			component: NewRoot(80, 24, nil, ""),
 		},
 	}
 
@@ -1,10 +1,18 @@
 package components
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
 	"github.com/charmbracelet/bubbles/textarea"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/trknhr/chatgpt-dev-utils/internal/file"
+	"github.com/trknhr/chatgpt-dev-utils/internal/templates"
+	"github.com/trknhr/chatgpt-dev-utils/internal/tokens"
+	"github.com/trknhr/chatgpt-dev-utils/internal/utils"
 )
 
 type Edit struct {
@@ -15,6 +23,20 @@ type Edit struct {
 	Textarea         textarea.Model
 	Width            int
 	Height           int
+
+	// checking is the text whose commands are being checked, if any
+	checking string
+	// check is the result of the last command check, cleared on edits
+	check *checkDoneMsg
+
+	// tokens is the token count of the text and selected files; counts
+	// numbers the counts and counting is the one in progress
+	tokens   int
+	counts   int
+	counting int
+
+	// session is the state shared with the other steps
+	session *Session
 }
 
 func NewEdit(promptType, selectedTemplate, templateContent string, selectedFiles []*file.FileNode, width, height int) *Edit {
@@ -41,11 +63,12 @@ func NewEdit(promptType, selectedTemplate, templateContent string, selectedFiles
 		Textarea:         ta,
 		Width:            width,
 		Height:           height,
+		session:          NewSession(),
 	}
 }
 
 func (e *Edit) Init() tea.Cmd {
-	return textarea.Blink
+	return tea.Batch(textarea.Blink, e.countTokens())
 }
 
 func (e *Edit) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -67,17 +90,106 @@ func (e *Edit) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		e.Textarea.SetWidth(boxWidth - 2)
 
+	case tokenCountMsg:
+		if msg.gen == e.counting {
+			e.counting = 0
+			e.tokens = msg.tokens
+		}
+		return e, nil
+
+	case checkDoneMsg:
+		if msg.text == e.checking {
+			e.checking = ""
+			e.check = &msg
+		}
+		return e, nil
+
 	case tea.KeyMsg:
 		if msg.Type == tea.KeyTab {
 			// Move to final step
 			return e, nil
 		}
+		if msg.Type == tea.KeyCtrlR && e.PromptType == "git" {
+			return e, e.startCheck()
+		}
 	}
 
+	before := e.Textarea.Value()
 	e.Textarea, cmd = e.Textarea.Update(msg)
+	if e.Textarea.Value() != before {
+		e.check = nil
+		return e, tea.Batch(cmd, e.countTokens())
+	}
 	return e, cmd
 }
 
+// countTokens counts the tokens of the text, plus the selected files for
+// file prompts, in the background
+func (e *Edit) countTokens() tea.Cmd {
+	e.counts++
+	e.counting = e.counts
+	gen, text := e.counts, e.Textarea.Value()
+	var files []*file.FileNode
+	if e.PromptType == "file" {
+		files = e.SelectedFiles
+	}
+	return func() tea.Msg {
+		b := tokens.Current()
+		n, _ := b.Count(text)
+		return tokenCountMsg{gen: gen, tokens: n + countFiles(b, files)}
+	}
+}
+
+// tokenView shows the token count of the prompt so far
+func (e *Edit) tokenView() string {
+	if e.counting != 0 && e.counts == 1 {
+		return helpStyle.Render("Counting tokens...")
+	}
+	view := RenderTokens(tokens.Current(), e.tokens)
+	if e.PromptType == "git" {
+		view += helpStyle.Render(" · before command output")
+	}
+	return view
+}
+
+// startCheck runs the template commands in the background to report the
+// ones that fail
+func (e *Edit) startCheck() tea.Cmd {
+	text := e.Textarea.Value()
+	e.checking = text
+	e.check = nil
+	return func() tea.Msg {
+		r, _ := utils.ExecuteGitCommandsContext(context.Background(), text, templates.PolicyPlaceholder, nil)
+		nodes, _ := templates.Parse(text)
+		return checkDoneMsg{text: text, total: len(templates.Substitutions(nodes)), errs: r.Errors}
+	}
+}
+
+// validation describes syntax errors and the result of the last command check
+func (e *Edit) validation() string {
+	if e.PromptType != "git" {
+		return ""
+	}
+	var syntax *templates.SyntaxError
+	if _, err := templates.Parse(e.Textarea.Value()); errors.As(err, &syntax) {
+		return RenderValidation("Template syntax:", []string{syntax.Error()})
+	}
+	switch {
+	case e.checking != "":
+		return "Checking template commands..."
+	case e.check == nil:
+		return ""
+	case len(e.check.errs) > 0:
+		return RenderValidation("Template commands failed:", commandProblems(e.check.errs))
+	default:
+		noun := "commands"
+		if e.check.total == 1 {
+			noun = "command"
+		}
+		return fmt.Sprintf("✓ %d template %s ran without errors", e.check.total, noun)
+	}
+}
+
 func (e *Edit) View() string {
 	if e.Height < 10 || e.Width < 20 {
 		return "Your terminal is too small."
@@ -90,8 +202,13 @@ func (e *Edit) View() string {
 		title = "Step 4: Review & Edit"
 	}
 
+	panel := e.validation()
+
 	// Update textarea dimensions for current view
-	textareaHeight := e.Height - 10
+	textareaHeight := e.Height - 11
+	if panel != "" {
+		textareaHeight -= lipgloss.Height(panel) + 1
+	}
 	if textareaHeight < 5 {
 		textareaHeight = 5
 	}
@@ -100,12 +217,20 @@ func (e *Edit) View() string {
 	boxWidth := e.Width - 4
 	e.Textarea.SetWidth(boxWidth - 2)
 
-	body := e.Textarea.View()
+	body := e.Textarea.View() + "\n" + e.tokenView()
+	if panel != "" {
+		body += "\n" + panel
+	}
+
+	help := "[↑↓←→ Type freely] [Tab: Next] [Esc: Back]"
+	if e.PromptType == "git" {
+		help += " [Ctrl+R: Check Commands]"
+	}
 
 	return RenderLayout(
 		title,
 		body,
-		"[↑↓←→ Type freely] [Tab: Next] [Esc: Back]",
+		help,
 		e.Width,
 		e.Height,
 	)
@@ -114,16 +239,15 @@ func (e *Edit) View() string {
 func (e *Edit) Next() (Component, tea.Cmd) {
 	finalPrompt := e.Textarea.Value()
 	// Note: WebSocket context will be injected by Root component
-	return NewFinal(e.PromptType, e.SelectedTemplate, finalPrompt, e.SelectedFiles, e.Width, e.Height, false, nil, nil), nil
+	final := NewFinal(e.PromptType, e.SelectedTemplate, finalPrompt, e.SelectedFiles, e.Width, e.Height, false, nil)
+	final.session = e.session
+	return final, final.Init()
 }
 
 func (e *Edit) Prev() (Component, tea.Cmd) {
-	// Go back to template selection
-	var templates []string
-	if e.PromptType == "git" {
-		templates = []string{"Code Review", "Commit Message", "Change Summary", "Custom..."}
-	} else {
-		templates = []string{"Code Review", "Documentation", "Custom..."}
-	}
-	return NewTemplateSelect(e.PromptType, templates, e.SelectedFiles, e.Width, e.Height), nil
+	// Go back to template selection, on the template being edited
+	ts := NewTemplateSelect(e.PromptType, templates.Names(e.PromptType), e.SelectedFiles, e.Width, e.Height)
+	ts.Cursor = max(slices.Index(ts.Templates, e.SelectedTemplate), 0)
+	ts.session = e.session
+	return ts, nil
 }
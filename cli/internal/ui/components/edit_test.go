@@ -90,6 +90,65 @@ func TestEdit(t *testing.T) {
 				assert.Equal(t, "Your terminal is too small.", view)
 			},
 		},
+		{
+			name: "View shows template syntax errors as you type",
+			test: func(t *testing.T) {
+				edit := NewEdit("git", "Template", "Diff: $(git diff", nil, 80, 24)
+
+				view := edit.View()
+
+				assert.Contains(t, view, "Template syntax:")
+				assert.Contains(t, view, "line 1, column 7")
+			},
+		},
+		{
+			name: "Ctrl+R checks the template commands",
+			test: func(t *testing.T) {
+				edit := NewEdit("git", "Template", "$(git rev-parse --sq-quote x)\n$(git rev-parse --verify nope)", nil, 80, 24)
+
+				_, cmd := edit.Update(tea.KeyMsg{Type: tea.KeyCtrlR})
+				assert.Contains(t, edit.View(), "Checking template commands...")
+				edit.Update(cmd())
+
+				view := edit.View()
+				assert.Contains(t, view, "Template commands failed:")
+				assert.Contains(t, view, "$(git rev-parse --verify nope) · exit 128")
+
+				// Editing the text clears the stale result
+				edit.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+				assert.NotContains(t, edit.View(), "Template commands failed:")
+			},
+		},
+		{
+			name: "Ctrl+R reports commands that ran",
+			test: func(t *testing.T) {
+				edit := NewEdit("git", "Template", "$(git rev-parse --sq-quote a)", nil, 80, 24)
+
+				_, cmd := edit.Update(tea.KeyMsg{Type: tea.KeyCtrlR})
+				edit.Update(cmd())
+
+				assert.Contains(t, edit.View(), "✓ 1 template command ran without errors")
+			},
+		},
+		{
+			name: "View shows the token count of the text",
+			test: func(t *testing.T) {
+				edit := NewEdit("git", "Template", "hello world", nil, 80, 24)
+				msg := edit.countTokens()()
+				edit.Update(msg)
+
+				view := edit.View()
+				assert.Contains(t, view, "2 / 128,000 tokens (gpt-4o) · before command output")
+
+				// Typing counts again; a stale count is ignored
+				edit.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("!")})
+				assert.NotZero(t, edit.counting)
+				edit.Update(msg)
+				assert.NotZero(t, edit.counting)
+				edit.Update(edit.countTokens()())
+				assert.Equal(t, 3, edit.tokens)
+			},
+		},
 		{
 			name: "Next returns Final component",
 			test: func(t *testing.T) {
@@ -132,7 +191,9 @@ func TestEdit(t *testing.T) {
 				assert.True(t, ok)
 				assert.Equal(t, "file", ts.PromptType)
 				assert.Contains(t, ts.Templates, "Documentation")
+				assert.Equal(t, "Documentation", ts.Templates[ts.Cursor])
 				assert.Equal(t, files, ts.SelectedFiles)
+				assert.Same(t, edit.session, ts.session)
 			},
 		},
 	}
@@ -0,0 +1,32 @@
+package components
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/trknhr/chatgpt-dev-utils/internal/hub"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+)
+
+// Extension is the connection to the Chrome extension used by the TUI.
+// *hub.Hub implements it.
+type Extension interface {
+	Count() int
+	Clients() []protocol.ClientInfo
+	Events() <-chan hub.Event
+	Send(msg protocol.Message) (int, error)
+	Track(id string) <-chan protocol.Message
+	Forget(id string)
+}
+
+// waitForConnection blocks until the extension connects or disconnects
+func waitForConnection(ext Extension) tea.Cmd {
+	if ext == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		e, ok := <-ext.Events()
+		if !ok {
+			return nil
+		}
+		return ConnectionMsg{Clients: e.Clients}
+	}
+}
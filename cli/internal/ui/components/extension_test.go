@@ -0,0 +1,74 @@
+package components
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trknhr/chatgpt-dev-utils/internal/hub"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+)
+
+// fakeExtension records sent messages instead of talking to a browser
+type fakeExtension struct {
+	clients int
+	infos   []protocol.ClientInfo
+	events  chan hub.Event
+	pending *protocol.Pending
+	sent    []protocol.Message
+	// reply, if set, answers each sent message
+	reply func(msg protocol.Message) []protocol.Message
+}
+
+func newFakeExtension(clients int) *fakeExtension {
+	return &fakeExtension{
+		clients: clients,
+		events:  make(chan hub.Event, 1),
+		pending: protocol.NewPending(),
+	}
+}
+
+func (f *fakeExtension) Count() int                     { return f.clients }
+func (f *fakeExtension) Clients() []protocol.ClientInfo { return f.infos }
+func (f *fakeExtension) Events() <-chan hub.Event       { return f.events }
+func (f *fakeExtension) Track(id string) <-chan protocol.Message {
+	return f.pending.Track(id)
+}
+func (f *fakeExtension) Forget(id string) { f.pending.Forget(id) }
+func (f *fakeExtension) Send(msg protocol.Message) (int, error) {
+	if msg.Target != "" && !slices.ContainsFunc(f.infos, func(c protocol.ClientInfo) bool { return c.ID == msg.Target }) {
+		return 0, hub.ErrUnknownTarget
+	}
+	if f.clients == 0 {
+		return 0, nil
+	}
+	f.sent = append(f.sent, msg)
+	if f.reply != nil {
+		for _, m := range f.reply(msg) {
+			f.pending.Deliver(m)
+		}
+	}
+	return 1, nil
+}
+
+func TestWaitForConnection(t *testing.T) {
+	t.Run("nil extension has no command", func(t *testing.T) {
+		assert.Nil(t, waitForConnection(nil))
+	})
+
+	t.Run("event becomes ConnectionMsg", func(t *testing.T) {
+		ext := newFakeExtension(0)
+		ext.events <- hub.Event{Connected: true, Clients: 2}
+
+		msg := waitForConnection(ext)()
+
+		assert.Equal(t, ConnectionMsg{Clients: 2}, msg)
+	})
+
+	t.Run("closed event channel", func(t *testing.T) {
+		ext := newFakeExtension(0)
+		close(ext.events)
+
+		assert.Nil(t, waitForConnection(ext)())
+	})
+}
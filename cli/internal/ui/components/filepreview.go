@@ -0,0 +1,314 @@
+package components
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/trknhr/chatgpt-dev-utils/internal/content"
+	"github.com/trknhr/chatgpt-dev-utils/internal/file"
+)
+
+// FilePreview shows a file of the file step to choose the lines of it the
+// prompt uses: ranges marked by hand or, for Go files, the lines of a
+// function, method or type
+type FilePreview struct {
+	Title    string
+	Node     *file.FileNode
+	Lines    []string
+	Cursor   int // line under the cursor, counted from 0
+	Top      int // first line on screen
+	Viewport viewport.Model
+	Message  string
+	Width    int
+	Height   int
+
+	// mark is the line a range being marked starts at, or -1
+	mark int
+	// symbols are the declarations of a Go file; picking is set while they
+	// are listed and symbol is the one under the cursor
+	symbols []file.Symbol
+	picking bool
+	symbol  int
+	// loaded is set once the file is read
+	loaded bool
+	// back is the file step, shown again on Esc and Tab
+	back *FileSelect
+}
+
+// NewFilePreview previews node, going back to the file step back. The file
+// is read by the command of Init.
+func NewFilePreview(node *file.FileNode, back *FileSelect) *FilePreview {
+	return &FilePreview{
+		Title:    "Preview: " + node.Path,
+		Node:     node,
+		Viewport: viewport.New(max(back.Width-4, 20), max(back.Height-8, 3)),
+		Message:  "Loading...",
+		Width:    back.Width,
+		Height:   back.Height,
+		mark:     -1,
+		back:     back,
+	}
+}
+
+func (p *FilePreview) Init() tea.Cmd {
+	path := p.Node.Path
+	return func() tea.Msg {
+		return readPreview(path)
+	}
+}
+
+// readPreview reads the file at path as the prompt holds it, converted to
+// UTF-8, with the declarations of a Go file
+func readPreview(path string) filePreviewMsg {
+	msg := filePreviewMsg{path: path}
+	whole, err := content.Current().ReadAll(path)
+	if err != nil {
+		msg.err = err
+		return msg
+	}
+	msg.lines = strings.Split(strings.TrimSuffix(whole.Text, "\n"), "\n")
+	if whole.Size > content.Current().MaxBytes {
+		msg.notes = append(msg.notes, "Large file ("+content.FormatBytes(whole.Size)+"): without ranges the prompt holds only its first and last lines")
+	}
+	if filepath.Ext(path) == ".go" {
+		if msg.symbols, err = file.GoSymbols(path, []byte(whole.Text)); err != nil {
+			msg.notes = append(msg.notes, "Symbols unavailable: "+err.Error())
+		}
+	}
+	return msg
+}
+
+// load shows the file read by readPreview, with the cursor on the first
+// range. The file may have shrunk since the ranges were chosen, so the
+// cursor is kept within it.
+func (p *FilePreview) load(msg filePreviewMsg) {
+	p.loaded = true
+	p.Lines = msg.lines
+	p.symbols = msg.symbols
+	p.Message = strings.Join(msg.notes, " · ")
+	if msg.err != nil {
+		p.Lines = []string{""}
+		p.Message = "Error: " + msg.err.Error()
+	}
+	if len(p.Node.Ranges) > 0 {
+		p.Cursor = p.Node.Ranges[0].From - 1
+	}
+	p.Cursor = min(max(p.Cursor, 0), len(p.Lines)-1)
+	p.Top = min(p.Top, p.Cursor)
+	p.ensureCursorVisible()
+	p.updateViewportContent()
+}
+
+func (p *FilePreview) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tokenCountMsg, dirLoadedMsg, dirChangedMsg, treeLoadedMsg, fileIndexMsg, gitStatusMsg, filePaneMsg:
+		// The file step keeps loading while the preview is shown
+		_, cmd := p.back.Update(msg)
+		return p, cmd
+
+	case filePreviewMsg:
+		if msg.path == p.Node.Path {
+			p.load(msg)
+		}
+
+	case tea.WindowSizeMsg:
+		p.Width, p.Height = msg.Width, msg.Height
+		p.Viewport.Width = max(msg.Width-4, 20)
+		p.Viewport.Height = max(msg.Height-8, 3)
+		p.back.Update(msg)
+		p.ensureCursorVisible()
+		p.updateViewportContent()
+
+	case tea.KeyMsg:
+		if !p.loaded {
+			break
+		}
+		if p.picking {
+			p.updatePicker(msg)
+			break
+		}
+		switch msg.String() {
+		case "up", "k":
+			p.move(-1)
+		case "down", "j":
+			p.move(1)
+		case "pgup":
+			p.move(-p.Viewport.Height)
+		case "pgdown":
+			p.move(p.Viewport.Height)
+		case "v":
+			// Start a range, or end the one being marked
+			if p.mark < 0 {
+				p.mark = p.Cursor
+			} else {
+				p.addRange(file.Range{From: p.mark + 1, To: p.Cursor + 1})
+			}
+		case "s":
+			if len(p.symbols) > 0 {
+				p.picking = true
+				p.symbol = 0
+				for i, s := range p.symbols {
+					if s.Range.Contains(p.Cursor + 1) {
+						p.symbol = i
+					}
+				}
+			}
+		case "x":
+			p.Node.RemoveRanges(p.Cursor + 1)
+		case "c":
+			p.Node.Ranges = nil
+		}
+		p.updateViewportContent()
+	}
+	return p, nil
+}
+
+// updatePicker handles the keys of the symbol list
+func (p *FilePreview) updatePicker(msg tea.KeyMsg) {
+	switch msg.String() {
+	case "up", "k":
+		if p.symbol > 0 {
+			p.symbol--
+		}
+	case "down", "j":
+		if p.symbol < len(p.symbols)-1 {
+			p.symbol++
+		}
+	case "enter":
+		p.picking = false
+		p.addRange(p.symbols[p.symbol].Range)
+		p.Cursor = p.symbols[p.symbol].Range.From - 1
+		p.ensureCursorVisible()
+	}
+}
+
+// move moves the cursor by delta lines
+func (p *FilePreview) move(delta int) {
+	p.Cursor = min(max(p.Cursor+delta, 0), len(p.Lines)-1)
+	p.ensureCursorVisible()
+}
+
+// addRange adds r to the parts of the file the prompt uses, selecting the
+// file
+func (p *FilePreview) addRange(r file.Range) {
+	p.mark = -1
+	p.Node.AddRange(r)
+	if !p.Node.Selected {
+		p.back.setSelected(p.Node, true)
+	}
+}
+
+func (p *FilePreview) ensureCursorVisible() {
+	if p.Cursor < p.Top {
+		p.Top = p.Cursor
+	} else if p.Cursor >= p.Top+p.Viewport.Height {
+		p.Top = p.Cursor - p.Viewport.Height + 1
+	}
+}
+
+func (p *FilePreview) updateViewportContent() {
+	if p.picking {
+		text := "Choose a declaration:\n"
+		for i, s := range p.symbols {
+			cursor := " "
+			line := fmt.Sprintf("%s (%s)", s.Name, file.Range{From: s.Range.From, To: s.Range.To})
+			if i == p.symbol {
+				cursor = ">"
+				line = selectedStyle.Render(line)
+			}
+			text += fmt.Sprintf("%s %s\n", cursor, line)
+		}
+		p.Viewport.SetContent(text)
+		p.Viewport.SetYOffset(max(p.symbol+1-p.Viewport.Height+1, 0))
+		return
+	}
+
+	// Only the lines on screen are rendered, as files can be long
+	width := len(fmt.Sprint(len(p.Lines)))
+	end := max(min(p.Top+p.Viewport.Height, len(p.Lines)), p.Top)
+	lines := make([]string, 0, end-p.Top)
+	for i := p.Top; i < end; i++ {
+		text := strings.ReplaceAll(p.Lines[i], "\t", "    ")
+		if runes := []rune(text); len(runes) > p.Viewport.Width-width-4 {
+			text = string(runes[:max(p.Viewport.Width-width-4, 0)])
+		}
+		gutter := fmt.Sprintf("%*d ", width, i+1)
+		marked := p.mark >= 0 && min(p.mark, p.Cursor) <= i && i <= max(p.mark, p.Cursor)
+		switch {
+		case marked:
+			gutter = warnStyle.Render(gutter + "▌")
+		case p.inRange(i + 1):
+			gutter = substitutionStyle.Render(gutter + "▌")
+		default:
+			gutter += " "
+		}
+		if i == p.Cursor {
+			text = selectedStyle.Render(text)
+		}
+		lines = append(lines, gutter+" "+text)
+	}
+	p.Viewport.SetContent(strings.Join(lines, "\n"))
+	p.Viewport.SetYOffset(0)
+}
+
+// inRange reports whether line is in one of the ranges of the file
+func (p *FilePreview) inRange(line int) bool {
+	for _, r := range p.Node.Ranges {
+		if r.Contains(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *FilePreview) View() string {
+	symbols := ""
+	if len(p.symbols) > 0 {
+		symbols = "[S: Symbols] "
+	}
+	help := "[↑↓ Navigate] [V: Mark lines] " + symbols + "[X: Unmark] [C: Whole file] [Esc: Back]"
+	switch {
+	case p.picking:
+		help = "[↑↓ Navigate] [Enter: Use declaration] [Esc: Cancel]"
+	case p.mark >= 0:
+		help = "[↑↓ Extend] [V: Add range] [Esc: Cancel]"
+	}
+	status := "Whole file"
+	if len(p.Node.Ranges) > 0 {
+		var parts []string
+		for _, r := range p.Node.Ranges {
+			parts = append(parts, r.String())
+		}
+		status = strings.Join(parts, "; ")
+	}
+	if p.Message != "" {
+		status += " · " + p.Message
+	}
+	return RenderLayout(
+		p.Title,
+		p.Viewport.View()+"\n"+helpStyle.Render(status),
+		help,
+		p.Width,
+		p.Height,
+	)
+}
+
+// Next goes back to the file step
+func (p *FilePreview) Next() (Component, tea.Cmd) {
+	return p.Prev()
+}
+
+func (p *FilePreview) Prev() (Component, tea.Cmd) {
+	// Esc closes the symbol list or cancels the range being marked first
+	if p.picking || p.mark >= 0 {
+		p.picking, p.mark = false, -1
+		p.updateViewportContent()
+		return p, nil
+	}
+	p.back.updateViewportContent()
+	return p.back, p.back.countTokens()
+}
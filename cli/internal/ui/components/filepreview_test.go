@@ -0,0 +1,211 @@
+package components
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trknhr/chatgpt-dev-utils/internal/config"
+	"github.com/trknhr/chatgpt-dev-utils/internal/content"
+	"github.com/trknhr/chatgpt-dev-utils/internal/file"
+	"github.com/trknhr/chatgpt-dev-utils/internal/tokens"
+)
+
+func TestFilePreview(t *testing.T) {
+	src := "package a\n\n// Foo does foo\nfunc Foo() {\n}\n\ntype T struct{}\n"
+	// preview opens the preview of a Go file from the file step
+	preview := func(t *testing.T) (*FileSelect, *FilePreview) {
+		t.Chdir(t.TempDir())
+		require.NoError(t, os.WriteFile("a.go", []byte(src), 0644))
+		fs := newFileBrowser(nil, 80, 24)
+		run(fs, fs.Init())
+		next, cmd := fs.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		p, ok := next.(*FilePreview)
+		require.True(t, ok, "Enter on a file opens the preview")
+		require.NotNil(t, cmd, "the file is read in the background")
+		p.Update(cmd())
+		return fs, p
+	}
+	key := func(p *FilePreview, keys ...string) {
+		for _, k := range keys {
+			msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+			switch k {
+			case "down":
+				msg = tea.KeyMsg{Type: tea.KeyDown}
+			case "enter":
+				msg = tea.KeyMsg{Type: tea.KeyEnter}
+			}
+			p.Update(msg)
+		}
+	}
+
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{
+			name: "marked lines select part of the file",
+			test: func(t *testing.T) {
+				fs, p := preview(t)
+				assert.Contains(t, p.View(), "Whole file")
+
+				key(p, "down", "down", "v", "down", "down")
+				assert.Contains(t, p.View(), "[V: Add range]")
+				key(p, "v")
+
+				node := fs.FlatFiles[0]
+				assert.Equal(t, []file.Range{{From: 3, To: 5}}, node.Ranges)
+				assert.Equal(t, []*file.FileNode{node}, fs.Selected)
+				assert.Contains(t, p.View(), "lines 3-5")
+
+				back, cmd := p.Prev()
+				assert.Same(t, fs, back)
+				run(fs, cmd)
+				assert.Contains(t, fs.View(), "a.go (lines 3-5)")
+				want, err := tokens.Count(tokens.Current().Model.Encoding, "// Foo does foo\nfunc Foo() {\n}\n")
+				require.NoError(t, err)
+				assert.Equal(t, want, fs.Tokens, "only the excerpt is counted")
+			},
+		},
+		{
+			name: "the symbol picker selects a declaration",
+			test: func(t *testing.T) {
+				fs, p := preview(t)
+
+				key(p, "s")
+				assert.Contains(t, p.View(), "func Foo (lines 3-5)")
+				key(p, "down", "enter")
+
+				assert.Equal(t, []file.Range{{From: 7, To: 7, Label: "type T"}}, fs.FlatFiles[0].Ranges)
+				assert.Equal(t, 6, p.Cursor)
+			},
+		},
+		{
+			name: "ranges are removed with x and c",
+			test: func(t *testing.T) {
+				fs, p := preview(t)
+				key(p, "v", "v", "down", "down", "v", "down", "v")
+				require.Len(t, fs.FlatFiles[0].Ranges, 2)
+
+				key(p, "x")
+				assert.Equal(t, []file.Range{{From: 1, To: 1}}, fs.FlatFiles[0].Ranges)
+				key(p, "c")
+				assert.Nil(t, fs.FlatFiles[0].Ranges)
+				assert.True(t, fs.FlatFiles[0].Selected, "the whole file stays selected")
+			},
+		},
+		{
+			name: "only the lines on screen are rendered",
+			test: func(t *testing.T) {
+				t.Chdir(t.TempDir())
+				var long strings.Builder
+				for i := 1; i <= 5000; i++ {
+					fmt.Fprintf(&long, "line %d\n", i)
+				}
+				require.NoError(t, os.WriteFile("long.txt", []byte(long.String()), 0644))
+				fs := newFileBrowser(nil, 80, 24)
+				run(fs, fs.Init())
+				next, cmd := fs.Update(tea.KeyMsg{Type: tea.KeyEnter})
+				p := next.(*FilePreview)
+				p.Update(cmd())
+
+				assert.Equal(t, p.Viewport.Height, p.Viewport.TotalLineCount())
+				assert.Contains(t, p.View(), "line 1 ")
+				for range 400 {
+					p.Update(tea.KeyMsg{Type: tea.KeyPgDown})
+				}
+				view := p.View()
+				assert.Equal(t, 4999, p.Cursor)
+				assert.Contains(t, view, "5000   line 5000")
+				assert.NotContains(t, view, "line 1 ")
+			},
+		},
+		{
+			name: "large files are flagged",
+			test: func(t *testing.T) {
+				reader, err := content.New(config.Files{MaxBytes: 16})
+				require.NoError(t, err)
+				previous := content.Current()
+				content.Configure(reader)
+				t.Cleanup(func() { content.Configure(previous) })
+
+				_, p := preview(t)
+
+				assert.Contains(t, p.View(), "Large file (")
+				assert.Len(t, p.Lines, 7, "the preview holds the whole file")
+			},
+		},
+		{
+			name: "the file is read in the background",
+			test: func(t *testing.T) {
+				t.Chdir(t.TempDir())
+				require.NoError(t, os.WriteFile("a.txt", []byte("one\ntwo\n"), 0644))
+				fs := newFileBrowser(nil, 80, 24)
+				run(fs, fs.Init())
+				next, cmd := fs.Update(tea.KeyMsg{Type: tea.KeyEnter})
+				p := next.(*FilePreview)
+
+				assert.Contains(t, p.View(), "Loading...")
+				key(p, "v", "down")
+				assert.Equal(t, -1, p.mark, "keys wait for the file")
+				p.Update(cmd())
+				assert.Equal(t, []string{"one", "two"}, p.Lines)
+				assert.NotContains(t, p.View(), "Loading...")
+			},
+		},
+		{
+			name: "ranges past the end of a shrunk file",
+			test: func(t *testing.T) {
+				t.Chdir(t.TempDir())
+				require.NoError(t, os.WriteFile("a.txt", []byte("only line\n"), 0644))
+				fs := newFileBrowser(nil, 80, 24)
+				node := &file.FileNode{Name: "a.txt", Path: "a.txt", Ranges: []file.Range{{From: 400, To: 450}}}
+				p := NewFilePreview(node, fs)
+
+				p.Update(p.Init()())
+
+				assert.Equal(t, 0, p.Cursor)
+				assert.Equal(t, 0, p.Top)
+				assert.Contains(t, p.View(), "only line")
+				key(p, "down")
+				assert.Equal(t, 0, p.Cursor)
+			},
+		},
+		{
+			name: "a file that cannot be read",
+			test: func(t *testing.T) {
+				t.Chdir(t.TempDir())
+				fs := newFileBrowser(nil, 80, 24)
+				node := &file.FileNode{Name: "gone.txt", Path: "gone.txt", Ranges: []file.Range{{From: 400, To: 450}}}
+				p := NewFilePreview(node, fs)
+
+				p.Update(p.Init()())
+
+				assert.Equal(t, 0, p.Cursor)
+				assert.Contains(t, p.View(), "Error: ")
+			},
+		},
+		{
+			name: "Prev cancels the range being marked first",
+			test: func(t *testing.T) {
+				fs, p := preview(t)
+				key(p, "v")
+
+				prev, _ := p.Prev()
+				assert.Same(t, p, prev)
+				prev, _ = p.Next()
+
+				assert.Same(t, fs, prev)
+				assert.Empty(t, fs.Selected)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, tt.test)
+	}
+}
@@ -0,0 +1,279 @@
+package components
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/trknhr/chatgpt-dev-utils/internal/file"
+	"github.com/trknhr/chatgpt-dev-utils/internal/fuzzy"
+)
+
+// maxSearchResults bounds the matches the finder keeps and renders, so
+// typing stays fast in large repositories
+const maxSearchResults = 200
+
+// fileSearch is the state of the fuzzy finder of the file step
+type fileSearch struct {
+	query string
+	// paths are every file below the root, nil until indexed with opts
+	paths []string
+	opts  file.Options
+	// matches are the best maxSearchResults paths that match query, best
+	// first, out of total
+	matches []fuzzy.Match
+	total   int
+	cursor  int
+}
+
+// openSearch starts the fuzzy finder and indexes the files in the
+// background. The folders are read through the cache, so only the ones that
+// changed since the last search are read again.
+func (f *FileSelect) openSearch() tea.Cmd {
+	root := f.findRoot()
+	if root == nil {
+		return nil
+	}
+	opts := file.Options{ShowIgnored: f.ShowIgnored}
+	f.search = &fileSearch{opts: opts}
+	dir := root.Snapshot()
+	return func() tea.Msg {
+		var paths []string
+		var walk func(node *file.FileNode)
+		walk = func(node *file.FileNode) {
+			children, err := file.DefaultCache().Load(node, opts)
+			if err != nil {
+				return
+			}
+			for _, child := range children {
+				if child.IsDir {
+					walk(child)
+				} else {
+					paths = append(paths, child.Path)
+				}
+			}
+		}
+		walk(dir)
+		return fileIndexMsg{opts: opts, paths: paths}
+	}
+}
+
+// Typing reports whether keys go to the query of the finder or to the glob
+// patterns
+func (f *FileSelect) Typing() bool {
+	return f.search != nil || f.glob != nil
+}
+
+// indexed lists the files the finder searches
+func (f *FileSelect) indexed(msg fileIndexMsg) {
+	if f.search == nil || msg.opts != f.search.opts {
+		return
+	}
+	if msg.paths == nil {
+		msg.paths = []string{}
+	}
+	f.search.paths = msg.paths
+	f.filter()
+}
+
+// filter ranks the indexed files against the query
+func (f *FileSelect) filter() {
+	s := f.search
+	s.matches = fuzzy.Rank(s.query, s.paths)
+	s.total = len(s.matches)
+	s.matches = s.matches[:min(s.total, maxSearchResults)]
+	s.cursor = min(s.cursor, max(len(s.matches)-1, 0))
+	f.updateViewportContent()
+	f.ensureCursorVisible()
+}
+
+// updateSearch handles the keys of the finder: typing filters, up and down
+// move through the results, space selects and enter shows the file in the
+// tree
+func (f *FileSelect) updateSearch(msg tea.KeyMsg) tea.Cmd {
+	s := f.search
+	switch msg.String() {
+	case "up", "ctrl+p":
+		if s.cursor > 0 {
+			s.cursor--
+		}
+	case "down", "ctrl+n":
+		if s.cursor < len(s.matches)-1 {
+			s.cursor++
+		}
+	case " ":
+		if s.cursor < len(s.matches) {
+			f.toggleSelected(s.matches[s.cursor].Text)
+			return f.countTokens()
+		}
+	case "enter":
+		if s.cursor < len(s.matches) {
+			path := s.matches[s.cursor].Text
+			f.search = nil
+			return f.reveal(path)
+		}
+		f.search = nil
+	case "backspace":
+		if s.query != "" {
+			runes := []rune(s.query)
+			s.query = string(runes[:len(runes)-1])
+			s.cursor = 0
+			if s.paths != nil {
+				f.filter()
+			}
+		}
+	default:
+		if msg.Type == tea.KeyRunes {
+			s.query += string(msg.Runes)
+			s.cursor = 0
+			if s.paths != nil {
+				f.filter()
+			}
+		}
+	}
+	f.updateViewportContent()
+	f.ensureCursorVisible()
+	return nil
+}
+
+// toggleSelected selects or unselects the file at path. Files in folders
+// that are not loaded yet are selected by path, with their size read from
+// disk, and replaced by their nodes as the folders load.
+func (f *FileSelect) toggleSelected(path string) {
+	if i := slices.IndexFunc(f.Selected, func(n *file.FileNode) bool { return n.Path == path }); i >= 0 {
+		f.setSelected(f.Selected[i], false)
+		return
+	}
+	node := f.findNode(path)
+	if node == nil {
+		node = &file.FileNode{Name: filepath.Base(path), Path: path}
+		if info, err := os.Stat(path); err == nil {
+			node.Size = info.Size()
+		}
+	}
+	f.setSelected(node, true)
+}
+
+// findNode returns the loaded node at path, if it is in the tree
+func (f *FileSelect) findNode(path string) *file.FileNode {
+	node := f.findRoot()
+	for node != nil && node.Path != path {
+		i := slices.IndexFunc(node.Children, func(n *file.FileNode) bool {
+			return n.Path == path || strings.HasPrefix(path, n.Path+string(filepath.Separator))
+		})
+		if i < 0 {
+			return nil
+		}
+		node = node.Children[i]
+	}
+	return node
+}
+
+// reveal opens the folders down to path and moves the cursor to it, loading
+// the folders that are not loaded yet
+func (f *FileSelect) reveal(path string) tea.Cmd {
+	root := f.findRoot()
+	var dirs []string
+	for dir := filepath.Dir(path); dir != "." && dir != root.Path && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	slices.Reverse(dirs)
+
+	var cmd tea.Cmd
+	if f.reopen == nil {
+		f.reopen = map[string]bool{}
+	}
+	node := root
+	for i, dir := range dirs {
+		j := slices.IndexFunc(node.Children, func(n *file.FileNode) bool { return n.Path == dir })
+		if !node.Loaded || j < 0 {
+			// Open the rest as they load
+			for _, rest := range dirs[i:] {
+				f.reopen[rest] = true
+			}
+			break
+		}
+		node = node.Children[j]
+		node.IsOpen = true
+		if !node.Loaded {
+			cmd = f.loadDir(node)
+			for _, rest := range dirs[i+1:] {
+				f.reopen[rest] = true
+			}
+			break
+		}
+	}
+
+	f.FlatFiles = file.FlattenFileTree(root)
+	if i := slices.IndexFunc(f.FlatFiles, func(n *file.FileNode) bool { return n.Path == path }); i >= 0 {
+		f.Cursor = i
+	} else {
+		f.follow = path
+	}
+	f.updateViewportContent()
+	f.ensureCursorVisible()
+	return cmd
+}
+
+// searchView lists the files that match the query with the matched
+// characters highlighted
+func (f *FileSelect) searchView() (string, int) {
+	s := f.search
+	content := fmt.Sprintf("/ %s█", s.query)
+	if s.total > len(s.matches) {
+		content += helpStyle.Render(fmt.Sprintf("  best %d of %d, type to narrow down", len(s.matches), s.total))
+	}
+	content += "\n\n"
+	switch {
+	case s.paths == nil:
+		return content + "Indexing files...\n", 0
+	case len(s.matches) == 0:
+		return content + "No matching files\n", 0
+	}
+	selected := make(map[string]bool, len(f.Selected))
+	for _, n := range f.Selected {
+		selected[n.Path] = true
+	}
+	for i, m := range s.matches {
+		cursor := " "
+		if i == s.cursor {
+			cursor = ">"
+		}
+		mark := "[ ]"
+		if selected[m.Text] {
+			mark = "[x]"
+		}
+		line := highlightMatch(m)
+		if i == s.cursor {
+			line = selectedStyle.Render(line)
+		}
+		content += fmt.Sprintf("%s %s %s\n", cursor, mark, line)
+	}
+
+	// The query takes the first two lines
+	return content, s.cursor + 2
+}
+
+// highlightMatch renders the text of m with the matched characters in color
+func highlightMatch(m fuzzy.Match) string {
+	var b strings.Builder
+	runes := []rune(m.Text)
+	for i := 0; i < len(runes); {
+		j := i + 1
+		matched := slices.Contains(m.Positions, i)
+		for j < len(runes) && slices.Contains(m.Positions, j) == matched {
+			j++
+		}
+		if matched {
+			b.WriteString(substitutionStyle.Render(string(runes[i:j])))
+		} else {
+			b.WriteString(string(runes[i:j]))
+		}
+		i = j
+	}
+	return b.String()
+}
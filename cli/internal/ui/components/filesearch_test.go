@@ -0,0 +1,139 @@
+package components
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSearch(t *testing.T) {
+	// browse opens a file browser on a repository with nested files
+	browse := func(t *testing.T) *FileSelect {
+		dir := t.TempDir()
+		for _, name := range []string{"main.go", "internal/ui/fileselect.go", "internal/file/filetree.go", "docs/usage.md"} {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			require.NoError(t, os.WriteFile(path, []byte("package x"), 0644))
+		}
+		t.Chdir(dir)
+		fs := newFileBrowser(nil, 80, 40)
+		run(fs, fs.Init())
+		return fs
+	}
+	typeText := func(fs *FileSelect, text string) {
+		for _, r := range text {
+			fs.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		}
+	}
+
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{
+			name: "slash ranks every file against the query",
+			test: func(t *testing.T) {
+				fs := browse(t)
+
+				_, cmd := fs.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("/")})
+				assert.Contains(t, fs.View(), "Indexing files...")
+				run(fs, cmd)
+				typeText(fs, "ft")
+
+				require.NotEmpty(t, fs.search.matches)
+				assert.Equal(t, filepath.Join("internal", "file", "filetree.go"), fs.search.matches[0].Text)
+				view := fs.View()
+				assert.Contains(t, view, "/ ft")
+				assert.Contains(t, view, "[Esc: Close search]")
+				assert.NotContains(t, view, "usage.md")
+
+				typeText(fs, "zzz")
+				assert.Contains(t, fs.View(), "No matching files")
+				for range 3 {
+					fs.Update(tea.KeyMsg{Type: tea.KeyBackspace})
+				}
+				assert.Equal(t, "ft", fs.search.query)
+			},
+		},
+		{
+			name: "space selects files in folders that are not loaded",
+			test: func(t *testing.T) {
+				fs := browse(t)
+				run(fs, fs.openSearch())
+				typeText(fs, "fsel")
+
+				_, cmd := fs.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(" ")})
+				run(fs, cmd)
+
+				path := filepath.Join("internal", "ui", "fileselect.go")
+				require.Len(t, fs.Selected, 1)
+				assert.Equal(t, path, fs.Selected[0].Path)
+				assert.Equal(t, int64(len("package x")), fs.selectedSize(), "the size is read from disk")
+				assert.Equal(t, 2, fs.Tokens)
+				assert.Contains(t, fs.View(), "[x]")
+
+				_, cmd = fs.Update(tea.KeyMsg{Type: tea.KeyEnter})
+				run(fs, cmd)
+
+				assert.Nil(t, fs.search)
+				assert.Equal(t, []string{"docs", "internal", "file", "ui", "fileselect.go", "main.go"}, names(fs))
+				assert.Equal(t, path, fs.FlatFiles[fs.Cursor].Path)
+				assert.Same(t, fs.FlatFiles[fs.Cursor], fs.Selected[0], "the loaded node replaces the path")
+				assert.True(t, fs.Selected[0].Selected)
+
+				run(fs, fs.openSearch())
+				typeText(fs, "fsel")
+				fs.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(" ")})
+				assert.Empty(t, fs.Selected)
+				assert.False(t, fs.FlatFiles[fs.Cursor].Selected)
+			},
+		},
+		{
+			name: "only the best results are kept",
+			test: func(t *testing.T) {
+				fs := browse(t)
+				run(fs, fs.openSearch())
+				paths := make([]string, 500)
+				for i := range paths {
+					paths[i] = fmt.Sprintf("gen/file%03d.go", i)
+				}
+				fs.indexed(fileIndexMsg{opts: fs.search.opts, paths: paths})
+				typeText(fs, "file")
+
+				assert.Len(t, fs.search.matches, maxSearchResults)
+				assert.Equal(t, 500, fs.search.total)
+				assert.Contains(t, fs.View(), "best 200 of 500")
+				for range maxSearchResults + 10 {
+					fs.Update(tea.KeyMsg{Type: tea.KeyDown})
+				}
+				assert.Equal(t, maxSearchResults-1, fs.search.cursor)
+			},
+		},
+		{
+			name: "Prev closes the finder and keys go to the query",
+			test: func(t *testing.T) {
+				fs := browse(t)
+				run(fs, fs.openSearch())
+				assert.True(t, fs.Typing())
+				typeText(fs, ".")
+				assert.False(t, fs.ShowIgnored)
+
+				prev, _ := fs.Prev()
+
+				assert.Same(t, fs, prev)
+				assert.Nil(t, fs.search)
+				assert.False(t, fs.Typing())
+				assert.Contains(t, fs.View(), "[/: Search]")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, tt.test)
+	}
+}
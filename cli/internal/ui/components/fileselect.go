@@ -2,11 +2,16 @@ package components
 
 import (
 	"fmt"
+	"path/filepath"
+	"slices"
 
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 
+	"github.com/trknhr/chatgpt-dev-utils/internal/content"
 	"github.com/trknhr/chatgpt-dev-utils/internal/file"
+	"github.com/trknhr/chatgpt-dev-utils/internal/templates"
+	"github.com/trknhr/chatgpt-dev-utils/internal/tokens"
 )
 
 type FileSelect struct {
@@ -18,6 +23,42 @@ type FileSelect struct {
 	Cursor    int
 	FlatFiles []*file.FileNode
 	Selected  []*file.FileNode
+	// Tokens is the token count of the selected files
+	Tokens int
+	// ShowIgnored lists hidden files and files matched by ignore rules
+	ShowIgnored bool
+	// Preview shows the file under the cursor next to the tree when
+	// ShowPreview is set and the terminal is wide enough
+	Preview     viewport.Model
+	ShowPreview bool
+
+	// counts numbers the token counts; counting is the one in progress
+	counts   int
+	counting int
+
+	// root is the tree being browsed; directories load when expanded
+	root *file.FileNode
+	// loading are the directories being read, and queued the selection
+	// changes asked for while they were, applied in order once they load
+	loading map[*file.FileNode]bool
+	queued  map[*file.FileNode][]queuedSelect
+	// reopen are directories to expand again once they are loaded, and
+	// follow the path the cursor moves to once it is shown
+	reopen map[string]bool
+	follow string
+	// search is the fuzzy finder, while it is open
+	search *fileSearch
+	// glob are the patterns typed for the glob selector, while it is open
+	glob *string
+	// session is the state shared with the other steps
+	session *Session
+	// pane is the file in the preview pane
+	pane filePane
+	// git is the state of the changed files, or gitErr why it is unknown;
+	// gitRuns numbers the git status runs
+	git     file.GitStatus
+	gitErr  error
+	gitRuns int
 }
 
 func NewFileSelect(flat []*file.FileNode, selected []*file.FileNode, vp viewport.Model, cursor, w, h int, msg string) *FileSelect {
@@ -30,33 +71,131 @@ func NewFileSelect(flat []*file.FileNode, selected []*file.FileNode, vp viewport
 		Width:     w,
 		Height:    h,
 		Message:   msg,
+		loading:   map[*file.FileNode]bool{},
+		session:   NewSession(),
+		// Sized by layout
+		Preview:     viewport.New(0, 0),
+		ShowPreview: true,
+	}
+}
+
+// newFileBrowser browses the working directory, loading directories as
+// they are expanded. The tree, selection, cursor and scroll position are
+// those the file step had when session was last saved.
+func newFileBrowser(session *Session, w, h int) *FileSelect {
+	if session == nil {
+		session = NewSession()
+	}
+	vp := viewport.New(max(w-4, 20), max(h-8, 3))
+	f := NewFileSelect(nil, nil, vp, 0, w, h, "")
+	f.session = session
+	f.ShowIgnored = session.ShowIgnored
+	f.ShowPreview = !session.HidePreview
+	f.layout()
+	f.root = session.Tree
+	if f.root == nil {
+		f.root = file.NewTree(".")
+	}
+	// Files in folders that are not loaded are replaced by their nodes as
+	// the folders load
+	for _, path := range session.Selected {
+		node := f.findNode(path)
+		if node == nil || node.IsDir {
+			node = &file.FileNode{Name: filepath.Base(path), Path: path}
+		}
+		node.Selected = true
+		node.Ranges = session.Ranges[path]
+		f.Selected = append(f.Selected, node)
+	}
+	f.FlatFiles = file.FlattenFileTree(f.root)
+	if i := slices.IndexFunc(f.FlatFiles, func(n *file.FileNode) bool { return n.Path == session.Cursor }); i >= 0 {
+		f.Cursor = i
 	}
+	f.updateViewportContent()
+	f.Viewport.SetYOffset(session.Offset)
+	return f
 }
 
-func (f *FileSelect) Init() tea.Cmd { return nil }
+// Init loads the top of the tree, or reads the folders loaded earlier again
+// in case they changed, and counts the tokens of files selected earlier
+func (f *FileSelect) Init() tea.Cmd {
+	var load, count tea.Cmd
+	if f.root != nil {
+		load = f.reloadDirs()
+	}
+	if len(f.Selected) > 0 {
+		count = f.countTokens()
+	}
+	f.updateViewportContent()
+	return tea.Batch(load, count, f.readGitStatus(), f.previewCursor())
+}
 
+// Update handles msg, then previews the file the cursor ends up on
 func (f *FileSelect) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	var cmd tea.Cmd
+	model, cmd := f.update(msg)
+	if model != tea.Model(f) {
+		// The preview step was opened
+		return model, cmd
+	}
+	return f, tea.Batch(cmd, f.previewCursor())
+}
+
+func (f *FileSelect) update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd, count tea.Cmd
 
 	switch msg := msg.(type) {
+	case tokenCountMsg:
+		if msg.gen == f.counting {
+			f.counting = 0
+			f.Tokens = msg.tokens
+			f.updateViewportContent()
+		}
+		return f, nil
+
+	case dirLoadedMsg:
+		if msg.dir.Path == f.pane.path {
+			// Preview the folder again with its files
+			f.pane = filePane{}
+		}
+		return f, f.loaded(msg)
+
+	case treeLoadedMsg:
+		return f, f.treeLoaded(msg)
+
+	case fileIndexMsg:
+		f.indexed(msg)
+		return f, nil
+
+	case filePaneMsg:
+		f.paneLoaded(msg)
+		return f, nil
+
+	case gitStatusMsg:
+		f.gitStatusLoaded(msg)
+		return f, nil
+
+	case dirChangedMsg:
+		if node := f.findDir(msg.dir); node != nil {
+			return f, tea.Batch(f.loadDir(node), f.readGitStatus())
+		}
+		return f, nil
+
 	case tea.WindowSizeMsg:
 		f.Width = msg.Width
 		f.Height = msg.Height
 		// Update viewport dimensions
-		headerHeight := 4
-		footerHeight := 4
-		viewportHeight := f.Height - headerHeight - footerHeight
-		if viewportHeight < 3 {
-			viewportHeight = 3
-		}
-		viewportWidth := f.Width - 4
-		if viewportWidth < 20 {
-			viewportWidth = 20
-		}
-		f.Viewport.Width = viewportWidth
-		f.Viewport.Height = viewportHeight
+		f.layout()
 
 	case tea.KeyMsg:
+		if f.search != nil {
+			return f, f.updateSearch(msg)
+		}
+		if f.glob != nil {
+			return f, f.updateGlob(msg)
+		}
+		if f.scrollPane(msg.String()) {
+			return f, nil
+		}
 		switch msg.String() {
 		case "up", "k":
 			if f.Cursor > 0 {
@@ -71,80 +210,344 @@ func (f *FileSelect) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				f.ensureCursorVisible()
 			}
 		case "enter":
-			// Toggle folder open/close
+			// Toggle folder open/close, or preview a file
 			if f.Cursor < len(f.FlatFiles) {
 				node := f.FlatFiles[f.Cursor]
+				if !node.IsDir {
+					p := NewFilePreview(node, f)
+					return p, p.Init()
+				}
 				if node.IsDir {
 					node.IsOpen = !node.IsOpen
+					if node.IsOpen && !node.Loaded && node.Children == nil {
+						count = f.loadDir(node)
+					}
 					// Rebuild the flattened list
 					root := f.findRoot()
 					f.FlatFiles = file.FlattenFileTree(root)
 					f.updateViewportContent()
 				}
 			}
+		case "/":
+			count = f.openSearch()
+			f.updateViewportContent()
+		case ".":
+			f.ShowIgnored = !f.ShowIgnored
+			count = f.rebuild()
+			f.updateViewportContent()
+			f.ensureCursorVisible()
 		case " ":
-			// Toggle file selection
+			// Toggle file selection, or that of every file in a folder
 			if f.Cursor < len(f.FlatFiles) {
 				node := f.FlatFiles[f.Cursor]
-				if !node.IsDir {
-					node.Selected = !node.Selected
-					if node.Selected {
-						f.Selected = append(f.Selected, node)
-					} else {
-						// Remove from selected files
-						for i, selectedFile := range f.Selected {
-							if selectedFile == node {
-								f.Selected = append(f.Selected[:i], f.Selected[i+1:]...)
-								break
-							}
-						}
-					}
+				if node.IsDir {
+					count = f.selectTree(node, selectToggle, "")
+				} else {
+					f.setSelected(node, !node.Selected)
+					count = f.countTokens()
 					f.updateViewportContent()
 				}
 			}
+		case "a":
+			if root := f.findRoot(); root != nil {
+				count = f.selectTree(root, selectAll, "")
+			}
+		case "i":
+			if root := f.findRoot(); root != nil {
+				count = f.selectTree(root, selectInvert, "")
+			}
+		case "n":
+			count = f.clearSelection()
+		case "c":
+			count = f.selectChanged()
+		case "p":
+			f.ShowPreview = !f.ShowPreview
+			f.pane = filePane{}
+			f.layout()
+		case "g":
+			f.glob = new(string)
+			f.Message = ""
+			f.updateViewportContent()
 		}
 	}
 
 	// Update viewport
 	f.Viewport, cmd = f.Viewport.Update(msg)
-	return f, cmd
+	return f, tea.Batch(cmd, count)
+}
+
+// countTokens counts the tokens of the selected files in the background
+func (f *FileSelect) countTokens() tea.Cmd {
+	f.counts++
+	f.counting = f.counts
+	gen, selected := f.counts, slices.Clone(f.Selected)
+	return func() tea.Msg {
+		return tokenCountMsg{gen: gen, tokens: countFiles(tokens.Current(), selected)}
+	}
+}
+
+// countFiles returns the token count of the files; unreadable files count
+// as empty
+func countFiles(b tokens.Budget, files []*file.FileNode) int {
+	total := 0
+	for _, f := range files {
+		if len(f.Ranges) > 0 {
+			total += countRanges(b, f)
+		} else if n, err := tokens.CountFile(b.Model.Encoding, f.Path); err == nil {
+			total += n
+		}
+	}
+	return total
+}
+
+// countRanges returns the token count of the excerpts of a file selected
+// in part
+func countRanges(b tokens.Budget, f *file.FileNode) int {
+	whole, err := content.Current().ReadAll(f.Path)
+	if err != nil || whole.Binary {
+		return 0
+	}
+	total := 0
+	for _, r := range f.Ranges {
+		if n, err := tokens.Count(b.Model.Encoding, file.Excerpt(whole.Text, r)); err == nil {
+			total += n
+		}
+	}
+	return total
+}
+
+// rebuild reads the tree again with the current ShowIgnored setting. Open
+// folders, the selection and the cursor are restored as the tree loads.
+func (f *FileSelect) rebuild() tea.Cmd {
+	root := f.findRoot()
+	if root == nil {
+		return nil
+	}
+	f.reopen = map[string]bool{}
+	var walk func(node *file.FileNode)
+	walk = func(node *file.FileNode) {
+		if node.IsDir && node.IsOpen {
+			f.reopen[node.Path] = true
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+	if f.Cursor < len(f.FlatFiles) {
+		f.follow = f.FlatFiles[f.Cursor].Path
+	}
+
+	f.root = file.NewTree(root.Path)
+	f.FlatFiles = nil
+	f.loading = map[*file.FileNode]bool{}
+	f.queued = nil
+	return f.loadDir(f.root)
+}
+
+// reloadDirs reads the root and every loaded folder below it
+func (f *FileSelect) reloadDirs() tea.Cmd {
+	var cmds []tea.Cmd
+	var walk func(node *file.FileNode)
+	walk = func(node *file.FileNode) {
+		if node != f.root && !node.Loaded {
+			return
+		}
+		cmds = append(cmds, f.loadDir(node))
+		for _, child := range node.Children {
+			if child.IsDir {
+				walk(child)
+			}
+		}
+	}
+	walk(f.root)
+	return tea.Batch(cmds...)
+}
+
+// loadDir reads the children of dir in the background
+func (f *FileSelect) loadDir(dir *file.FileNode) tea.Cmd {
+	if f.loading[dir] {
+		return nil
+	}
+	f.loading[dir] = true
+	opts, snapshot := file.Options{ShowIgnored: f.ShowIgnored}, dir.Snapshot()
+	return func() tea.Msg {
+		children, err := file.DefaultCache().Load(snapshot, opts)
+		return dirLoadedMsg{dir: dir, opts: opts, children: children, err: err}
+	}
+}
+
+// loaded adds the children of a directory to the tree, selecting files
+// selected earlier and loading directories to reopen
+func (f *FileSelect) loaded(msg dirLoadedMsg) tea.Cmd {
+	if !f.loading[msg.dir] {
+		// From a tree that was replaced
+		return nil
+	}
+	delete(f.loading, msg.dir)
+	if msg.opts.ShowIgnored != f.ShowIgnored {
+		return f.loadDir(msg.dir)
+	}
+	if msg.err != nil {
+		f.Message = "Error: " + msg.err.Error()
+	}
+	msg.dir.SetChildren(msg.children)
+	f.git.Decorate(msg.dir)
+
+	f.adopt(msg.dir)
+	var cmds []tea.Cmd
+	for _, child := range msg.dir.Children {
+		if f.reopen[child.Path] {
+			delete(f.reopen, child.Path)
+			child.IsOpen = true
+			cmds = append(cmds, f.loadDir(child))
+		}
+	}
+
+	var cursor string
+	if f.Cursor < len(f.FlatFiles) {
+		cursor = f.FlatFiles[f.Cursor].Path
+	}
+	f.FlatFiles = file.FlattenFileTree(f.findRoot())
+	f.Cursor = min(f.Cursor, max(len(f.FlatFiles)-1, 0))
+	for _, path := range []string{cursor, f.follow} {
+		if i := slices.IndexFunc(f.FlatFiles, func(n *file.FileNode) bool { return n.Path == path }); path != "" && i >= 0 {
+			f.Cursor = i
+			if path == f.follow {
+				f.follow = ""
+			}
+		}
+	}
+	f.updateViewportContent()
+	f.ensureCursorVisible()
+	return tea.Batch(append(cmds, f.dequeue(msg.dir))...)
+}
+
+// findDir returns the loaded directory at the absolute path dir, if it is
+// in the tree
+func (f *FileSelect) findDir(dir string) *file.FileNode {
+	var find func(node *file.FileNode) *file.FileNode
+	find = func(node *file.FileNode) *file.FileNode {
+		if !node.IsDir || !node.Loaded {
+			return nil
+		}
+		if abs, err := filepath.Abs(node.Path); err == nil && abs == dir {
+			return node
+		}
+		for _, child := range node.Children {
+			if found := find(child); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	if root := f.findRoot(); root != nil {
+		return find(root)
+	}
+	return nil
 }
 
 func (f *FileSelect) View() string {
+	if f.search != nil {
+		return RenderLayout(
+			f.Title,
+			f.body(),
+			"[Type: Filter] [↑↓ Navigate] [Space: Select file] [Enter: Show in tree] [Esc: Close search]",
+			f.Width,
+			f.Height,
+		)
+	}
+	if f.glob != nil {
+		return RenderLayout(
+			f.Title,
+			f.body(),
+			"[Type: Patterns] [Enter: Select matching files] [Esc: Cancel]",
+			f.Width,
+			f.Height,
+		)
+	}
+	ignored := "[.: Show ignored]"
+	if f.ShowIgnored {
+		ignored = "[.: Hide ignored]"
+	}
+	preview, scroll := "[P: Show preview]", ""
+	if f.ShowPreview {
+		preview = "[P: Hide preview]"
+	}
+	if f.showPane() {
+		scroll = " [J/K: Scroll preview]"
+	}
 	return RenderLayout(
 		f.Title,
-		f.Viewport.View(),
-		"[↑↓ Navigate] [Enter: Toggle folder] [Space: Select file] [Tab: Next]",
+		f.body(),
+		"[↑↓ Navigate] [Enter: Open] [Space: Select] [Tab: Next]"+scroll+"\n[A: All] [N: None] [I: Invert] [G: Glob] [C: Changed] [/: Search] "+ignored+" "+preview,
 		f.Width,
 		f.Height,
 	)
 }
 
+// body is the tree, with the preview pane when it is shown
+func (f *FileSelect) body() string {
+	if f.showPane() {
+		return f.paneView(f.Viewport.View())
+	}
+	return f.Viewport.View()
+}
+
 func (f *FileSelect) updateViewportContent() {
-	content := ""
+	text := ""
+	if len(f.FlatFiles) == 0 && len(f.loading) > 0 {
+		text = "Loading files...\n"
+	}
+	var checks map[*file.FileNode]file.Check
+	if f.search != nil {
+		text, _ = f.searchView()
+	} else {
+		checks = file.Checks(f.findRoot())
+	}
 	for i, node := range f.FlatFiles {
+		if f.search != nil {
+			break
+		}
 		cursor := " "
 		if i == f.Cursor {
 			cursor = ">"
 		}
 
-		line := file.RenderFileNode(node)
+		line := file.RenderFileNodeWith(node, checks)
+		if f.loading[node] {
+			line += " (loading...)"
+		}
 		if i == f.Cursor {
 			line = selectedStyle.Render(line)
 		}
-		content += fmt.Sprintf("%s %s\n", cursor, line)
+		text += fmt.Sprintf("%s %s\n", cursor, line)
 	}
 
-	selectedInfo := fmt.Sprintf("\nSelected: %d files", len(f.Selected))
-	content += selectedInfo
+	selectedInfo := fmt.Sprintf("\nSelected: %d files (%s)", len(f.Selected), content.FormatBytes(f.selectedSize()))
+	switch {
+	case f.counting != 0:
+		selectedInfo += " · counting tokens..."
+	case len(f.Selected) > 0:
+		selectedInfo += " · " + RenderTokens(tokens.Current(), f.Tokens)
+	}
+	text += selectedInfo
+	if f.glob != nil {
+		text += fmt.Sprintf("\nSelect files matching (gitignore patterns, ! excludes): %s█", *f.glob)
+	} else if f.Message != "" {
+		text += "\n" + f.Message
+	}
 
-	f.Viewport.SetContent(content)
+	f.Viewport.SetContent(text)
 }
 
 func (f *FileSelect) ensureCursorVisible() {
 	// Calculate cursor position in viewport
 	lineHeight := 1
 	cursorPosition := f.Cursor * lineHeight
+	if f.search != nil {
+		_, cursorPosition = f.searchView()
+	}
 
 	// Scroll to make cursor visible
 	if cursorPosition < f.Viewport.YOffset {
@@ -155,6 +558,9 @@ func (f *FileSelect) ensureCursorVisible() {
 }
 
 func (f *FileSelect) findRoot() *file.FileNode {
+	if f.root != nil {
+		return f.root
+	}
 	// Find the root node by traversing up from any flat file
 	if len(f.FlatFiles) > 0 {
 		node := f.FlatFiles[0]
@@ -169,13 +575,33 @@ func (f *FileSelect) findRoot() *file.FileNode {
 func (f *FileSelect) Next() (Component, tea.Cmd) {
 	if len(f.Selected) > 0 {
 		// Create file template selection component with current dimensions
-		templates := []string{"Code Review", "Documentation", "Custom..."}
-		return NewTemplateSelect("file", templates, f.Selected, f.Width, f.Height), nil
+		f.session.save(f)
+		ts := NewTemplateSelect("file", templates.Names("file"), f.Selected, f.Width, f.Height)
+		ts.session = f.session
+		return ts, nil
 	}
 	return f, nil
 }
 
 func (f *FileSelect) Prev() (Component, tea.Cmd) {
+	// Esc while typing glob patterns closes the prompt
+	if f.glob != nil {
+		f.glob = nil
+		f.updateViewportContent()
+		return f, nil
+	}
+
+	// Esc while searching closes the finder
+	if f.search != nil {
+		f.search = nil
+		f.updateViewportContent()
+		f.ensureCursorVisible()
+		return f, nil
+	}
+
 	// Return to prompt type with current dimensions
-	return NewPromptType(f.Width, f.Height), nil
+	f.session.save(f)
+	prompt := NewPromptType(f.Width, f.Height)
+	prompt.session = f.session
+	return prompt, nil
 }
@@ -1,14 +1,43 @@
 package components
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/trknhr/chatgpt-dev-utils/internal/file"
 )
 
+// run runs cmd and the commands that follow from it to completion,
+// feeding their messages to f
+func run(f *FileSelect, cmd tea.Cmd) {
+	for queue := []tea.Cmd{cmd}; len(queue) > 0; queue = queue[1:] {
+		if queue[0] == nil {
+			continue
+		}
+		msg := queue[0]()
+		if batch, ok := msg.(tea.BatchMsg); ok {
+			queue = append(queue, batch...)
+			continue
+		}
+		_, next := f.Update(msg)
+		queue = append(queue, next)
+	}
+}
+
+// names lists the names of the rows f shows
+func names(f *FileSelect) []string {
+	var out []string
+	for _, n := range f.FlatFiles {
+		out = append(out, n.Name)
+	}
+	return out
+}
+
 func TestFileSelect(t *testing.T) {
 	// Create test file nodes
 	createTestFileNodes := func() []*file.FileNode {
@@ -66,8 +95,10 @@ func TestFileSelect(t *testing.T) {
 
 				assert.Equal(t, 100, updated.Width)
 				assert.Equal(t, 30, updated.Height)
-				assert.Equal(t, 96, updated.Viewport.Width) // 100 - 4
+				assert.Equal(t, 48, updated.Viewport.Width)  // half of 100 - 4
 				assert.Equal(t, 22, updated.Viewport.Height) // 30 - 8
+				assert.Equal(t, 45, updated.Preview.Width)   // the rest but the separator
+				assert.Equal(t, 21, updated.Preview.Height)  // below the header
 			},
 		},
 		{
@@ -113,6 +144,22 @@ func TestFileSelect(t *testing.T) {
 				assert.True(t, updated.FlatFiles[1].Selected)
 			},
 		},
+		{
+			name: "Update counts the tokens of the selected files",
+			test: func(t *testing.T) {
+				dir := t.TempDir()
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello world"), 0644))
+				flat := []*file.FileNode{{Name: "a.txt", Path: filepath.Join(dir, "a.txt"), Size: 11}}
+				fs := NewFileSelect(flat, nil, viewport.New(80, 20), 0, 80, 24, "")
+
+				_, cmd := fs.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(" ")})
+				assert.Contains(t, fs.View(), "Selected: 1 files (11 B) · counting tokens...")
+				fs.Update(cmd())
+
+				assert.Equal(t, 2, fs.Tokens)
+				assert.Contains(t, fs.View(), "Selected: 1 files (11 B) · 2 / 128,000 tokens (gpt-4o)")
+			},
+		},
 		{
 			name: "Update toggles folder open/close with enter",
 			test: func(t *testing.T) {
@@ -128,6 +175,91 @@ func TestFileSelect(t *testing.T) {
 				assert.False(t, flat[0].IsOpen)
 			},
 		},
+		{
+			name: "Init loads the tree and Enter loads folders as they open",
+			test: func(t *testing.T) {
+				dir := t.TempDir()
+				deep := filepath.Join(dir, "a", "b", "c", "d", "e")
+				require.NoError(t, os.MkdirAll(deep, 0755))
+				require.NoError(t, os.WriteFile(filepath.Join(deep, "deep.go"), nil, 0644))
+				t.Chdir(dir)
+
+				fs := newFileBrowser(nil, 80, 24)
+				cmd := fs.Init()
+				assert.Contains(t, fs.View(), "Loading files...")
+				run(fs, cmd)
+				assert.Equal(t, []string{"a"}, names(fs))
+
+				for range 5 {
+					_, cmd := fs.Update(tea.KeyMsg{Type: tea.KeyEnter})
+					assert.Contains(t, fs.View(), "(loading...)")
+					run(fs, cmd)
+					fs.Update(tea.KeyMsg{Type: tea.KeyDown})
+				}
+
+				assert.Equal(t, []string{"a", "b", "c", "d", "e", "deep.go"}, names(fs))
+			},
+		},
+		{
+			name: "Update reloads folders that change on disk",
+			test: func(t *testing.T) {
+				dir := t.TempDir()
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), nil, 0644))
+				t.Chdir(dir)
+				fs := newFileBrowser(nil, 80, 24)
+				run(fs, fs.Init())
+				cmd := waitForDirChange(file.DefaultCache())
+				if cmd == nil {
+					t.Skip("fsnotify is not available")
+				}
+
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "b.go"), nil, 0644))
+				// Skip changes to the directories of earlier tests
+				msg := cmd()
+				for msg != (dirChangedMsg{dir: dir}) {
+					msg = waitForDirChange(file.DefaultCache())()
+				}
+				_, cmd = fs.Update(msg)
+				run(fs, cmd)
+
+				assert.Equal(t, []string{"a.go", "b.go"}, names(fs))
+			},
+		},
+		{
+			name: "Update shows and hides ignored files with dot",
+			test: func(t *testing.T) {
+				dir := t.TempDir()
+				require.NoError(t, os.Mkdir(filepath.Join(dir, "src"), 0755))
+				require.NoError(t, os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.log\n"), 0644))
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "main.go"), nil, 0644))
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "src", "debug.log"), nil, 0644))
+				t.Chdir(dir)
+				fs := newFileBrowser(nil, 80, 24)
+				run(fs, fs.Init())
+				_, cmd := fs.Update(tea.KeyMsg{Type: tea.KeyEnter})
+				run(fs, cmd)
+				fs.Update(tea.KeyMsg{Type: tea.KeyDown})
+				fs.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(" ")})
+				require.Equal(t, []string{"src", "main.go"}, names(fs))
+
+				_, cmd = fs.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(".")})
+				run(fs, cmd)
+
+				assert.Equal(t, []string{"src", "debug.log", "main.go", ".gitignore"}, names(fs))
+				assert.Equal(t, "main.go", fs.FlatFiles[fs.Cursor].Name, "cursor stays on the file")
+				require.Len(t, fs.Selected, 1)
+				assert.Same(t, fs.FlatFiles[2], fs.Selected[0])
+				assert.True(t, fs.Selected[0].Selected)
+				view := fs.View()
+				assert.Contains(t, view, "debug.log (ignored)")
+				assert.Contains(t, view, "[.: Hide ignored]")
+
+				_, cmd = fs.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(".")})
+				run(fs, cmd)
+
+				assert.Equal(t, []string{"src", "main.go"}, names(fs))
+			},
+		},
 		{
 			name: "View renders correctly",
 			test: func(t *testing.T) {
@@ -137,7 +269,7 @@ func TestFileSelect(t *testing.T) {
 
 				view := fs.View()
 				assert.Contains(t, view, "Step 2: Select Files")
-				assert.Contains(t, view, "[↑↓ Navigate] [Enter: Toggle folder] [Space: Select file] [Tab: Next]")
+				assert.Contains(t, view, "[↑↓ Navigate] [Enter: Open] [Space: Select] [Tab: Next]")
 			},
 		},
 		{
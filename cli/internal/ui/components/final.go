@@ -1,12 +1,25 @@
 package components
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 
-	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/trknhr/chatgpt-dev-utils/internal/chunk"
 	"github.com/trknhr/chatgpt-dev-utils/internal/file"
+	"github.com/trknhr/chatgpt-dev-utils/internal/hub"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+	"github.com/trknhr/chatgpt-dev-utils/internal/redact"
+	"github.com/trknhr/chatgpt-dev-utils/internal/sink"
+	"github.com/trknhr/chatgpt-dev-utils/internal/templates"
+	"github.com/trknhr/chatgpt-dev-utils/internal/tokens"
 	"github.com/trknhr/chatgpt-dev-utils/internal/utils"
 )
 
@@ -19,11 +32,77 @@ type Final struct {
 	Height             int
 	Message            string
 	ExtensionConnected bool
-	BroadcastChan      chan<- string
-	ClientsCount       func() int
+	Extension          Extension
+	// Target is the ID of the client prompts are sent to; empty means the
+	// first available client
+	Target string
+	// Sink is the name of the output Enter delivers the prompt to
+	Sink string
+	// Policy decides what happens when a template command fails
+	Policy templates.Policy
+	// Problems are the failed commands of the last render
+	Problems utils.CommandErrors
+
+	// render is the template run in progress, if any
+	render  *renderRun
+	runs    int
+	spinner spinner.Model
+
+	// preview is the prompt as it will be sent; nil until rendered
+	preview *utils.Rendered
+	// original is the preview before redaction
+	original utils.Rendered
+	// findings are the secrets found in the prompt; kept are the secrets
+	// the user chose to send anyway, and secret is the selected finding
+	findings []redact.Finding
+	kept     map[string]bool
+	secret   int
+	// blocked is set when the fail policy stops the preview from being sent
+	blocked bool
+	// tokens is the token count of the preview
+	tokens int
+	// parts is the preview split into messages when it is too long for
+	// one; part is the selected part
+	parts []promptPart
+	part  int
+	// sending is the sequence of parts being sent, if any
+	sending  *partsRun
+	viewport viewport.Model
+	// wrapped is the width the viewport content was last wrapped to
+	wrapped int
+	// session is the state shared with the other steps
+	session *Session
+}
+
+// promptPart is one message of a split prompt
+type promptPart struct {
+	Text   string
+	Tokens int
+}
+
+// partsRun sends the parts of a split prompt in the background
+type partsRun struct {
+	id       int
+	cancel   context.CancelFunc
+	progress chan partsProgressMsg
+	done     chan partsDoneMsg
+	finished int
+	total    int
 }
 
-func NewFinal(promptType, selectedTemplate, finalPrompt string, selectedFiles []*file.FileNode, width, height int, extensionConnected bool, broadcastChan chan<- string, clientsCount func() int) *Final {
+// renderRun renders the prompt in the background for delivery to sink, or
+// only for the preview if sink is nil
+type renderRun struct {
+	id       int
+	sink     sink.Sink
+	cancel   context.CancelFunc
+	progress chan renderProgressMsg
+	done     chan renderDoneMsg
+	finished int
+	total    int
+}
+
+func NewFinal(promptType, selectedTemplate, finalPrompt string, selectedFiles []*file.FileNode, width, height int, extensionConnected bool, extension Extension) *Final {
 	return &Final{
 		PromptType:         promptType,
 		SelectedTemplate:   selectedTemplate,
@@ -32,13 +111,19 @@ func NewFinal(promptType, selectedTemplate, finalPrompt string, selectedFiles []
 		Width:              width,
 		Height:             height,
 		ExtensionConnected: extensionConnected,
-		BroadcastChan:      broadcastChan,
-		ClientsCount:       clientsCount,
+		Extension:          extension,
+		Sink:               sink.DefaultName(),
+		Policy:             templates.OnError(promptType, selectedTemplate),
+		kept:               map[string]bool{},
+		spinner:            spinner.New(spinner.WithSpinner(spinner.Dot)),
+		viewport:           viewport.New(width, 0),
+		session:            NewSession(),
 	}
 }
 
+// Init renders the preview in the background
 func (f *Final) Init() tea.Cmd {
-	return nil
+	return f.startRender(nil)
 }
 
 func (f *Final) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -47,55 +132,127 @@ func (f *Final) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		f.Width = msg.Width
 		f.Height = msg.Height
 
+	case spinner.TickMsg:
+		if f.render == nil && f.sending == nil {
+			return f, nil
+		}
+		var cmd tea.Cmd
+		f.spinner, cmd = f.spinner.Update(msg)
+		return f, cmd
+
+	case renderProgressMsg:
+		if f.render == nil || msg.run != f.render.id {
+			return f, nil
+		}
+		f.render.finished, f.render.total = msg.done, msg.total
+		return f, waitForRender(f.render)
+
+	case renderDoneMsg:
+		if f.render == nil || msg.run != f.render.id {
+			return f, nil
+		}
+		run := f.render
+		f.render = nil
+		var failed utils.CommandErrors
+		if msg.err != nil && !errors.As(msg.err, &failed) {
+			f.Message = "Error: " + msg.err.Error()
+			return f, nil
+		}
+		f.Problems = msg.rendered.Errors
+		f.original = msg.original
+		f.findings, f.secret = msg.findings, 0
+		f.preview = &msg.rendered
+		f.tokens = msg.tokens
+		f.parts, f.part = msg.parts, 0
+		f.blocked = failed != nil
+		f.wrapped = 0
+		if run.sink == nil {
+			return f, nil
+		}
+		return f.deliverPreview(run.sink)
+
+	case partsProgressMsg:
+		if f.sending == nil || msg.run != f.sending.id {
+			return f, nil
+		}
+		f.sending.finished, f.sending.total = msg.done, msg.total
+		return f, waitForParts(f.sending)
+
+	case partsDoneMsg:
+		if f.sending == nil || msg.run != f.sending.id {
+			return f, nil
+		}
+		f.sending = nil
+		return f.show(msg.sink, msg.delivery, msg.err)
+
 	case tea.KeyMsg:
+		if f.sending != nil || f.render != nil && f.render.sink != nil {
+			// Esc cancels through Prev; other keys wait for the run
+			return f, nil
+		}
 		switch msg.String() {
 		case "c":
-			var finalContent string
-			if f.PromptType == "file" {
-				// Generate file prompt with actual content
-				finalContent = utils.GenerateFilePrompt(f.FinalPrompt, f.SelectedFiles)
-			} else {
-				// Execute git commands
-				finalContent = utils.ExecuteGitCommands(f.FinalPrompt)
+			return f.send(sink.Clipboard{})
+		case "t":
+			f.cycleTarget()
+		case "s":
+			f.cycleSink()
+		case "[":
+			if f.part > 0 {
+				f.part--
+			}
+		case "]":
+			if f.part < len(f.parts)-1 {
+				f.part++
+			}
+		case "y":
+			if f.parts != nil {
+				return f.deliver(sink.Clipboard{}, f.parts[f.part].Text)
+			}
+		case ",":
+			if f.secret > 0 {
+				f.secret--
+			}
+		case ".":
+			if f.secret < len(f.findings)-1 {
+				f.secret++
+			}
+		case "x":
+			if f.preview != nil && f.findings != nil {
+				f.toggleSecret()
+			}
+		case "r":
+			if f.render == nil {
+				f.preview = nil
+				return f, f.startRender(nil)
+			}
+		case "enter":
+			if s, ok := sink.Find(f.sinks(), f.Sink); ok {
+				return f.send(s)
 			}
-			clipboard.WriteAll(finalContent)
-			f.Message = "Copied to clipboard!"
 		case "e":
-			if f.ExtensionConnected && f.BroadcastChan != nil {
-				var finalContent string
-				if f.PromptType == "file" {
-					// Generate file prompt with actual content
-					finalContent = utils.GenerateFilePrompt(f.FinalPrompt, f.SelectedFiles)
-				} else {
-					// Execute git commands
-					finalContent = utils.ExecuteGitCommands(f.FinalPrompt)
-				}
-
-				payload := map[string]string{
-					"type":   "chatgpt-prompt",
-					"prompt": finalContent,
-				}
-
-				jsonBytes, err := json.Marshal(payload)
-
-				if err != nil {
-					f.Message = "Error marshaling JSON"
-					return f, nil
-				}
-				// Send to extension via WebSocket
-				select {
-				case f.BroadcastChan <- string(jsonBytes):
-					f.Message = "Sent to extension!"
-				default:
-					f.Message = "Extension not connected"
-				}
+			if f.ExtensionConnected && f.Extension != nil {
+				return f.send(sink.ExtensionSink{Ext: f.Extension, Target: f.Target})
 			}
+		case "home":
+			f.viewport.GotoTop()
+		case "end":
+			f.viewport.GotoBottom()
+		default:
+			// Scroll the preview
+			var cmd tea.Cmd
+			f.viewport, cmd = f.viewport.Update(msg)
+			return f, cmd
 		}
-	case CheckConnectionMsg:
+
+	case tea.MouseMsg:
+		var cmd tea.Cmd
+		f.viewport, cmd = f.viewport.Update(msg)
+		return f, cmd
+
+	case ConnectionMsg:
 		// Update extension connection status
-		if f.ClientsCount != nil {
-			f.ExtensionConnected = f.ClientsCount() > 0
-		}
+		f.ExtensionConnected = msg.Clients > 0
 	}
 	return f, nil
 }
@@ -108,37 +265,64 @@ func (f *Final) View() string {
 		title = "Step 4: Copy Prompt"
 	}
 
-	var content string
-	if f.PromptType == "file" {
-		// Show template with selected files list
-		template := f.FinalPrompt
-		if template == "" {
-			template = "Please analyze these files:\n\n$(files)"
+	var header string
+	switch {
+	case f.render != nil:
+		header = f.renderStatus()
+	case f.preview != nil:
+		header = fmt.Sprintf("Ready to copy: %s · %d lines, %d bytes",
+			f.SelectedTemplate, strings.Count(f.preview.Prompt, "\n")+1, len(f.preview.Prompt))
+	default:
+		header = "Not rendered yet · press R to run the template commands"
+	}
+
+	footer := "Output: " + f.sinkLabel()
+	if f.findings != nil && f.preview != nil {
+		footer = f.redactionView() + "\n\n" + footer
+	}
+	if panel := RenderValidation("Template commands failed:", commandProblems(f.Problems)); panel != "" {
+		footer += "\n\n" + panel
+	}
+	if f.preview != nil {
+		if panel := RenderValidation("Files not included in full:", fileProblems(f.preview.Files)); panel != "" {
+			footer += "\n\n" + panel
 		}
+	}
 
-		// Build selected files list
-		filesList := "Selected files:\n"
-		for _, file := range f.SelectedFiles {
-			filesList += fmt.Sprintf("- %s\n", file.Path)
+	helpStr := "[C: Copy with Content] [Esc: Back] [S: Change Output] [Enter: Send to Output] [R: Refresh]"
+	if f.render != nil && f.render.sink != nil {
+		helpStr = "[Esc: Cancel]"
+	} else if f.ExtensionConnected {
+		helpStr += " [E: Send to Extension]"
+		if len(f.clients()) > 1 || f.Target != "" {
+			helpStr += " [T: Change Target]"
 		}
+		footer += "\n\n" + f.targetView()
+	}
 
-		content = fmt.Sprintf("Template: %s\n\n%s\n\n%s",
-			f.SelectedTemplate,
-			template,
-			filesList)
-	} else {
-		// Git-based: show the prompt as before
-		preview := f.FinalPrompt
-		if len(preview) > 500 {
-			preview = preview[:500] + "..."
+	idle := f.sending == nil && (f.render == nil || f.render.sink == nil)
+	if f.findings != nil && f.preview != nil && idle {
+		helpStr += " [, .: Choose Secret] [X: Keep/Redact]"
+	}
+	if f.parts != nil {
+		footer = f.partsView() + "\n\n" + footer
+		if idle {
+			helpStr += " [[ ]: Choose Part] [Y: Copy Part]"
 		}
-		content = fmt.Sprintf("Ready to copy:\n\n%s", preview)
+	}
+	if f.sending != nil {
+		header = f.sendingStatus()
+		helpStr = "[Esc: Cancel]"
 	}
 
-	helpStr := "[C: Copy with Content] [Esc: Back]"
-	if f.ExtensionConnected {
-		helpStr += " [E: Send to Extension]"
+	content := header
+	if f.preview != nil {
+		content += "\n" + RenderTokens(tokens.Current(), f.tokens)
+		// The preview gets the height the rest of the layout leaves
+		height := f.Height - lipgloss.Height(header) - lipgloss.Height(footer) - 10
+		content += "\n\n" + f.previewView(max(height, 3))
 	}
+	content += "\n\n" + footer
 
 	return RenderLayoutWithMessage(
 		title,
@@ -150,30 +334,456 @@ func (f *Final) View() string {
 	)
 }
 
+// previewView shows the rendered prompt in a scrollable viewport with the
+// substituted parts highlighted
+func (f *Final) previewView(height int) string {
+	width := max(f.Width-6, 20)
+	if f.wrapped != width {
+		// Wrap for display only; the prompt is sent as rendered
+		f.viewport.SetContent(lipgloss.NewStyle().Width(width).Render(highlight(*f.preview)))
+		f.wrapped = width
+	}
+	f.viewport.Width = width
+	f.viewport.Height = height
+	view := f.viewport.View()
+	if f.viewport.TotalLineCount() > height {
+		view += "\n" + helpStyle.Render(fmt.Sprintf("↑↓ scroll · %3.f%%", f.viewport.ScrollPercent()*100))
+	}
+	return view
+}
+
+// highlight styles the substituted parts of the prompt, line by line so
+// the styles survive wrapping
+func highlight(r utils.Rendered) string {
+	var sb strings.Builder
+	last := 0
+	for _, span := range r.Spans {
+		sb.WriteString(r.Prompt[last:span.Start])
+		style := substitutionStyle
+		if span.Failed {
+			style = errorStyle
+		}
+		for i, line := range strings.Split(r.Prompt[span.Start:span.End], "\n") {
+			if i > 0 {
+				sb.WriteString("\n")
+			}
+			if line != "" {
+				sb.WriteString(style.Render(line))
+			}
+		}
+		last = span.End
+	}
+	sb.WriteString(r.Prompt[last:])
+	return sb.String()
+}
+
+// startRender runs the template commands in the background and, unless s
+// is nil, delivers the prompt to s once they finish
+func (f *Final) startRender(s sink.Sink) tea.Cmd {
+	ctx, cancel := context.WithCancel(context.Background())
+	f.runs++
+	run := &renderRun{
+		id:       f.runs,
+		sink:     s,
+		cancel:   cancel,
+		progress: make(chan renderProgressMsg, 1),
+		done:     make(chan renderDoneMsg, 1),
+	}
+	f.render = run
+	f.Message = ""
+
+	promptType, text, files, policy := f.PromptType, f.FinalPrompt, f.SelectedFiles, f.Policy
+	kept := maps.Clone(f.kept)
+	go func() {
+		rendered, err := utils.BuildPromptContext(ctx, promptType, text, files, policy, func(done, total int) {
+			// Keep only the latest progress if the UI falls behind
+			msg := renderProgressMsg{run: run.id, done: done, total: total}
+			select {
+			case run.progress <- msg:
+			default:
+				select {
+				case <-run.progress:
+				default:
+				}
+				run.progress <- msg
+			}
+		})
+		findings := redact.Current().Find(rendered.Prompt)
+		redacted, n, parts := prepare(rendered, findings, kept)
+		run.done <- renderDoneMsg{run: run.id, original: rendered, findings: findings, rendered: redacted, tokens: n, parts: parts, err: err}
+	}()
+
+	return tea.Batch(f.spinner.Tick, waitForRender(run))
+}
+
+// prepare redacts the findings in r that are not kept, then counts the
+// tokens of the result and splits it if it is too long for one message
+func prepare(r utils.Rendered, findings []redact.Finding, kept map[string]bool) (utils.Rendered, int, []promptPart) {
+	var redacted []redact.Finding
+	for _, f := range findings {
+		if !kept[f.Secret] {
+			redacted = append(redacted, f)
+		}
+	}
+	if redacted != nil {
+		spans := make([]utils.Span, len(r.Spans))
+		for i, span := range r.Spans {
+			spans[i] = utils.Span{Start: redact.Offset(redacted, span.Start), End: redact.Offset(redacted, span.End), Failed: span.Failed}
+		}
+		r.Prompt, r.Spans = redact.Apply(r.Prompt, redacted), spans
+	}
+
+	b := tokens.Current()
+	n, _ := b.Count(r.Prompt)
+	var parts []promptPart
+	if n > b.Part {
+		for _, p := range chunk.Parts(r.Prompt, b.Part, b.Counter()) {
+			count, _ := b.Count(p)
+			parts = append(parts, promptPart{Text: p, Tokens: count})
+		}
+	}
+	return r, n, parts
+}
+
+// toggleSecret keeps the selected secret in the prompt, or redacts it
+// again, and updates the preview
+func (f *Final) toggleSecret() {
+	secret := f.findings[f.secret].Secret
+	if f.kept[secret] {
+		delete(f.kept, secret)
+	} else {
+		f.kept[secret] = true
+	}
+	rendered, n, parts := prepare(f.original, f.findings, f.kept)
+	f.preview = &rendered
+	f.tokens = n
+	f.parts, f.part = parts, min(f.part, max(len(parts)-1, 0))
+	f.wrapped = 0
+}
+
+// redactionView reports the secrets found in the prompt and marks the
+// selected one
+func (f *Final) redactionView() string {
+	view := fmt.Sprintf("Found %d secret(s); redacted before the prompt leaves the machine:\n", len(f.findings))
+	for i, finding := range f.findings {
+		mark := "○"
+		if i == f.secret {
+			mark = "●"
+		}
+		line := fmt.Sprintf("%s · line %d · %s · ", finding.Rule, finding.Line, redact.Mask(finding.Secret))
+		if f.kept[finding.Secret] {
+			line += warnStyle.Render("kept, sent as is")
+		} else {
+			line += "redacted"
+		}
+		view += fmt.Sprintf("  %s %s\n", mark, line)
+	}
+	return strings.TrimSuffix(view, "\n")
+}
+
+// waitForRender blocks until the run reports progress or finishes
+func waitForRender(run *renderRun) tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case msg := <-run.progress:
+			return msg
+		case msg := <-run.done:
+			return msg
+		}
+	}
+}
+
+// renderStatus describes the run in progress
+func (f *Final) renderStatus() string {
+	status := f.spinner.View() + " Running template commands..."
+	if f.render.total > 0 {
+		status = fmt.Sprintf("%s Running template commands (%d/%d)...", f.spinner.View(), f.render.finished, f.render.total)
+	}
+	return status
+}
+
+// fileProblems describes the files left out or cut for a validation panel
+func fileProblems(notes []utils.FileNote) []string {
+	problems := make([]string, len(notes))
+	for i, n := range notes {
+		problems[i] = n.Path + " · " + n.Note
+	}
+	return problems
+}
+
+// commandProblems describes failed commands for a validation panel
+func commandProblems(errs utils.CommandErrors) []string {
+	problems := make([]string, 0, len(errs))
+	for _, e := range errs {
+		head := "$(" + e.Command + ")"
+		if e.ExitCode >= 0 {
+			head += fmt.Sprintf(" · exit %d", e.ExitCode)
+		}
+		problem := head + " · " + e.Summary()
+		if e.Stderr != "" {
+			lines := strings.Split(e.Stderr, "\n")
+			if len(lines) > 3 {
+				lines = append(lines[:3], "...")
+			}
+			problem += "\n" + strings.Join(lines, "\n")
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+// send delivers the previewed prompt to s, rendering it first if the
+// preview is not ready
+func (f *Final) send(s sink.Sink) (tea.Model, tea.Cmd) {
+	switch {
+	case f.preview != nil:
+		return f.deliverPreview(s)
+	case f.render != nil:
+		// Deliver once the preview run finishes
+		f.render.sink = s
+		return f, nil
+	}
+	return f, f.startRender(s)
+}
+
+// deliverPreview delivers the previewed prompt unless the fail policy
+// stopped it
+func (f *Final) deliverPreview(s sink.Sink) (tea.Model, tea.Cmd) {
+	if f.blocked {
+		f.Message = "Not sent: a template command failed"
+		return f, nil
+	}
+	// A prompt over the budget may still go to the extension in parts
+	ext, inParts := s.(sink.ExtensionSink)
+	inParts = inParts && f.parts != nil
+	if b := tokens.Current(); b.Block && b.Check(f.tokens) == tokens.Over && !(inParts && f.partsFit(b.Part)) {
+		f.Message = "Not sent: the prompt is over the token budget (" + b.Describe(f.tokens) + ")"
+		return f, nil
+	}
+	if inParts {
+		return f, f.startParts(ext)
+	}
+	return f.deliver(s, f.preview.Prompt)
+}
+
+// partsFit reports whether every part of the prompt is within max tokens
+func (f *Final) partsFit(max int) bool {
+	for _, p := range f.parts {
+		if p.Tokens > max {
+			return false
+		}
+	}
+	return true
+}
+
+// deliver sends the rendered prompt to s. Replies are streamed in the
+// result view.
+func (f *Final) deliver(s sink.Sink, prompt string) (tea.Model, tea.Cmd) {
+	delivery, err := s.Deliver(prompt)
+	return f.show(s, delivery, err)
+}
+
+// show reports the delivery to s and opens the result view if a reply
+// follows
+func (f *Final) show(s sink.Sink, delivery sink.Delivery, err error) (tea.Model, tea.Cmd) {
+	switch {
+	case errors.Is(err, hub.ErrUnknownTarget):
+		f.Message = "Selected browser is no longer connected"
+		return f, nil
+	case errors.Is(err, sink.ErrNotConnected):
+		f.Message = "Extension not connected"
+		return f, nil
+	case err != nil:
+		f.Message = "Error: " + err.Error()
+		return f, nil
+	}
+	f.Message = delivery.Status
+
+	if delivery.Quit {
+		return f, tea.Quit
+	}
+	if delivery.Replies == nil {
+		return f, nil
+	}
+	result := NewResult(f, delivery.RequestID, delivery.Replies)
+	result.Cancel = delivery.Cancel
+	if delivery.Waiting != "" {
+		result.Status = delivery.Waiting
+	}
+	if s.Name() != sink.NameExtension {
+		result.Title = "Reply · " + s.Label()
+	}
+	return result, result.Init()
+}
+
+// startParts sends the parts of the preview through the extension, each
+// after the previous one was answered
+func (f *Final) startParts(ext sink.ExtensionSink) tea.Cmd {
+	ctx, cancel := context.WithCancel(context.Background())
+	f.runs++
+	run := &partsRun{
+		id:       f.runs,
+		cancel:   cancel,
+		progress: make(chan partsProgressMsg, 1),
+		done:     make(chan partsDoneMsg, 1),
+		total:    len(f.parts),
+	}
+	f.sending = run
+	f.Message = ""
+
+	texts := make([]string, len(f.parts))
+	for i, p := range f.parts {
+		texts[i] = p.Text
+	}
+	go func() {
+		delivery, err := ext.SendParts(ctx, texts, func(done, total int) {
+			// Keep only the latest progress if the UI falls behind
+			msg := partsProgressMsg{run: run.id, done: done, total: total}
+			select {
+			case run.progress <- msg:
+			default:
+				select {
+				case <-run.progress:
+				default:
+				}
+				run.progress <- msg
+			}
+		})
+		run.done <- partsDoneMsg{run: run.id, sink: ext, delivery: delivery, err: err}
+	}()
+
+	return tea.Batch(f.spinner.Tick, waitForParts(run))
+}
+
+// waitForParts blocks until the run reports progress or finishes
+func waitForParts(run *partsRun) tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case msg := <-run.progress:
+			return msg
+		case msg := <-run.done:
+			return msg
+		}
+	}
+}
+
+// sendingStatus describes the parts being sent
+func (f *Final) sendingStatus() string {
+	return fmt.Sprintf("%s Sending part %d/%d, waiting for ChatGPT to answer...",
+		f.spinner.View(), f.sending.finished+1, f.sending.total)
+}
+
+// partsView lists the parts of a prompt too long for one message and marks
+// the selected one
+func (f *Final) partsView() string {
+	view := fmt.Sprintf("Too long for one message: split into %d parts of at most %s tokens\n",
+		len(f.parts)-1, tokens.Format(tokens.Current().Part))
+	for i, p := range f.parts {
+		mark := "○"
+		if i == f.part {
+			mark = "●"
+		}
+		name := fmt.Sprintf("Part %d/%d", i+1, len(f.parts)-1)
+		if i == len(f.parts)-1 {
+			name = "Final instruction"
+		}
+		view += fmt.Sprintf("  %s %s · %s tokens\n", mark, name, tokens.Format(p.Tokens))
+	}
+	return strings.TrimSuffix(view, "\n")
+}
+
+// sinks returns the outputs the prompt can be delivered to
+func (f *Final) sinks() []sink.Sink {
+	var ext sink.Extension
+	if f.Extension != nil {
+		ext = f.Extension
+	}
+	return sink.Available(ext, f.Target)
+}
+
+// cycleSink selects the next output
+func (f *Final) cycleSink() {
+	sinks := f.sinks()
+	i := slices.IndexFunc(sinks, func(s sink.Sink) bool { return s.Name() == f.Sink })
+	f.Sink = sinks[(i+1)%len(sinks)].Name()
+}
+
+// sinkLabel describes the selected output
+func (f *Final) sinkLabel() string {
+	if s, ok := sink.Find(f.sinks(), f.Sink); ok {
+		return s.Label()
+	}
+	return f.Sink + " (not available)"
+}
+
+// clients returns the connected extension clients
+func (f *Final) clients() []protocol.ClientInfo {
+	if f.Extension == nil {
+		return nil
+	}
+	return f.Extension.Clients()
+}
+
+// cycleTarget moves to the next client, wrapping around to first available
+func (f *Final) cycleTarget() {
+	ids := []string{""}
+	for _, c := range f.clients() {
+		ids = append(ids, c.ID)
+	}
+	// An unknown (disconnected) target moves back to first available
+	f.Target = ids[(slices.Index(ids, f.Target)+1)%len(ids)]
+}
+
+// targetView lists the connected clients and marks the selected target
+func (f *Final) targetView() string {
+	mark := func(selected bool) string {
+		if selected {
+			return "●"
+		}
+		return "○"
+	}
+	view := "Send to:\n"
+	view += fmt.Sprintf("  %s First available\n", mark(f.Target == ""))
+	found := f.Target == ""
+	for _, c := range f.clients() {
+		view += fmt.Sprintf("  %s %s\n", mark(c.ID == f.Target), c.Label())
+		found = found || c.ID == f.Target
+	}
+	if !found {
+		view += fmt.Sprintf("  ● [%s] (disconnected)\n", f.Target)
+	}
+	return view
+}
+
 func (f *Final) Next() (Component, tea.Cmd) {
 	// Final step, no next
 	return f, nil
 }
 
 func (f *Final) Prev() (Component, tea.Cmd) {
-	// Go back to edit step
-	var templateContent string
-	if f.PromptType == "git" {
-		gitTemplates := map[string]string{
-			"Code Review":    "Please review this diff and provide feedback:\n\n$(git diff --cached)\n\nFocus on:\n- Code quality\n- Security issues\n- Performance considerations",
-			"Commit Message": "Generate a concise commit message for the following staged changes:\n```\n$(git diff --cached)\n```\n\nFollow the format used in recent commits:\n```\n$(git log -n 3 --pretty=format:%s)\n```\n\nFormat: type(scope): description\n\nOnly return the commit message in plain text. Do not include explanations or comments.",
-			"Change Summary": "Summarize the changes in this commit:\n\n$(git log --oneline -1)\n$(git diff HEAD~1)",
-			"Custom...":      "$(git diff --cached)",
-		}
-		templateContent = gitTemplates[f.SelectedTemplate]
-	} else {
-		fileTemplates := map[string]string{
-			"Code Review":   "Please review this code and provide feedback:\n\n$(files)\n\nFocus on:\n- Code quality\n- Best practices\n- Potential issues",
-			"Documentation": "Generate documentation for this code:\n\n$(files)\n\nInclude:\n- Function descriptions\n- Usage examples\n- Parameters and return values",
-			"Custom...":     "Please add your prompt with $(files)",
+	// Esc while parts are being sent stops the sequence
+	if f.sending != nil {
+		f.sending.cancel()
+		f.sending = nil
+		f.Message = "Cancelled"
+		return f, nil
+	}
+
+	// Esc while the template commands run for a delivery cancels them
+	if f.render != nil {
+		run := f.render
+		run.cancel()
+		f.render = nil
+		if run.sink != nil {
+			f.Message = "Cancelled"
+			return f, nil
 		}
-		templateContent = fileTemplates[f.SelectedTemplate]
 	}
 
-	return NewEdit(f.PromptType, f.SelectedTemplate, templateContent, f.SelectedFiles, f.Width, f.Height), nil
+	// Go back to edit step
+	templateContent, _ := templates.Body(f.PromptType, f.SelectedTemplate)
+
+	edit := NewEdit(f.PromptType, f.SelectedTemplate, templateContent, f.SelectedFiles, f.Width, f.Height)
+	edit.session = f.session
+	return edit, edit.Init()
 }
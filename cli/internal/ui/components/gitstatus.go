@@ -0,0 +1,67 @@
+package components
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/trknhr/chatgpt-dev-utils/internal/file"
+)
+
+// readGitStatus runs git status in the background to mark the changed
+// files of the tree
+func (f *FileSelect) readGitStatus() tea.Cmd {
+	root := f.findRoot()
+	if root == nil {
+		return nil
+	}
+	f.gitRuns++
+	run, dir := f.gitRuns, root.Path
+	return func() tea.Msg {
+		status, err := file.ReadGitStatus(dir)
+		return gitStatusMsg{run: run, status: status, err: err}
+	}
+}
+
+// gitStatusLoaded marks the changed files of the tree, unless a newer git
+// status is on its way
+func (f *FileSelect) gitStatusLoaded(msg gitStatusMsg) {
+	if msg.run != f.gitRuns {
+		return
+	}
+	f.git, f.gitErr = msg.status, msg.err
+	if root := f.findRoot(); root != nil {
+		f.git.Decorate(root)
+	}
+	f.updateViewportContent()
+}
+
+// selectChanged selects every changed, staged and untracked file that is
+// not ignored, loading only the folders that have some
+func (f *FileSelect) selectChanged() tea.Cmd {
+	root := f.findRoot()
+	switch {
+	case root == nil:
+		return nil
+	case f.gitErr != nil:
+		f.Message = "Error: " + f.gitErr.Error()
+	case len(f.git) == 0:
+		f.Message = "No changed files"
+	default:
+		return f.selectTree(root, selectChanged, "")
+	}
+	f.updateViewportContent()
+	return nil
+}
+
+// changedSelected applies selectChanged to files
+func (f *FileSelect) changedSelected(files []*file.FileNode) {
+	n := 0
+	for _, node := range files {
+		if node.Git != file.GitClean {
+			f.setSelected(node, true)
+			n++
+		}
+	}
+	f.Message = fmt.Sprintf("%d changed files selected", n)
+}
@@ -0,0 +1,117 @@
+package components
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitStatus(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	// repo sets up a repository with a changed file, a staged one and an
+	// untracked one below folders, and makes it the working directory
+	repo := func(t *testing.T) {
+		t.Chdir(t.TempDir())
+		git := func(args ...string) {
+			cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+			out, err := cmd.CombinedOutput()
+			require.NoError(t, err, string(out))
+		}
+		write := func(name, content string) {
+			require.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+			require.NoError(t, os.WriteFile(name, []byte(content), 0644))
+		}
+		git("init", "-q")
+		write("main.go", "package main\n")
+		write("pkg/a/a.go", "package a\n")
+		write("pkg/b.go", "package pkg\n")
+		write("docs/readme.md", "# docs\n")
+		git("add", ".")
+		git("commit", "-q", "-m", "initial")
+		write("main.go", "package main // changed\n")
+		write("pkg/a/new.go", "package a\n")
+		write("pkg/staged.go", "package pkg\n")
+		git("add", "pkg/staged.go")
+	}
+	key := func(fs *FileSelect, k string) {
+		_, cmd := fs.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)})
+		run(fs, cmd)
+	}
+
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{
+			name: "marks changed files and counts them on folders",
+			test: func(t *testing.T) {
+				repo(t)
+				fs := newFileBrowser(nil, 80, 30)
+				run(fs, fs.Init())
+
+				view := fs.Viewport.View()
+				assert.Contains(t, view, "main.go [M]")
+				assert.Contains(t, view, "pkg/ [2 changed]")
+				assert.NotContains(t, view, "docs/ [")
+			},
+		},
+		{
+			name: "C selects the changed files, loading their folders",
+			test: func(t *testing.T) {
+				repo(t)
+				fs := newFileBrowser(nil, 80, 30)
+				run(fs, fs.Init())
+				key(fs, "c")
+
+				var selected []string
+				for _, node := range fs.Selected {
+					selected = append(selected, filepath.ToSlash(node.Path))
+				}
+				assert.ElementsMatch(t, []string{"main.go", "pkg/a/new.go", "pkg/staged.go"}, selected)
+				assert.Equal(t, "3 changed files selected", fs.Message)
+				docs := fs.findNode("docs")
+				require.NotNil(t, docs)
+				assert.False(t, docs.Loaded, "folders without changes are not read")
+			},
+		},
+		{
+			name: "the marks follow changes on disk",
+			test: func(t *testing.T) {
+				repo(t)
+				fs := newFileBrowser(nil, 80, 30)
+				run(fs, fs.Init())
+				require.NoError(t, os.WriteFile("main.go", []byte("package main\n"), 0644))
+
+				abs, err := filepath.Abs(".")
+				require.NoError(t, err)
+				_, cmd := fs.Update(dirChangedMsg{dir: abs})
+				run(fs, cmd)
+				assert.NotContains(t, fs.Viewport.View(), "main.go [M]")
+			},
+		},
+		{
+			name: "outside a repository",
+			test: func(t *testing.T) {
+				t.Chdir(t.TempDir())
+				require.NoError(t, os.WriteFile("a.txt", []byte("a"), 0644))
+				fs := newFileBrowser(nil, 80, 30)
+				run(fs, fs.Init())
+				key(fs, "c")
+
+				assert.Empty(t, fs.Selected)
+				assert.Contains(t, fs.Message, "Error: git status")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, tt.test)
+	}
+}
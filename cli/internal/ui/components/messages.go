@@ -1,8 +1,138 @@
 package components
 
+import (
+	"github.com/trknhr/chatgpt-dev-utils/internal/file"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+	"github.com/trknhr/chatgpt-dev-utils/internal/redact"
+	"github.com/trknhr/chatgpt-dev-utils/internal/sink"
+	"github.com/trknhr/chatgpt-dev-utils/internal/utils"
+)
+
 // Navigation messages for component transitions
 type nextMsg struct{}
 type prevMsg struct{}
 
-// WebSocket connection status message
-type CheckConnectionMsg struct{}
\ No newline at end of file
+// Extension connection status change
+type ConnectionMsg struct {
+	Clients int
+}
+
+// Reply from the extension for a prompt sent from the Final step
+type replyMsg struct {
+	id      string
+	message protocol.Message
+	closed  bool
+}
+
+// Progress of the template commands run before delivering a prompt
+type renderProgressMsg struct {
+	run         int
+	done, total int
+}
+
+// Rendered prompt with the secrets found in it, and the prompt as it will
+// be sent with its token count and, if it is too long for one message, its
+// parts; or the error that stopped the run
+type renderDoneMsg struct {
+	run      int
+	original utils.Rendered
+	findings []redact.Finding
+	rendered utils.Rendered
+	tokens   int
+	parts    []promptPart
+	err      error
+}
+
+// Progress of sending the parts of a split prompt
+type partsProgressMsg struct {
+	run         int
+	done, total int
+}
+
+// Delivery of the last part of a split prompt, or the error that stopped
+// the sequence
+type partsDoneMsg struct {
+	run      int
+	sink     sink.Sink
+	delivery sink.Delivery
+	err      error
+}
+
+// Children of a directory read in the background with opts
+type dirLoadedMsg struct {
+	dir      *file.FileNode
+	opts     file.Options
+	children []*file.FileNode
+	err      error
+}
+
+// Files below the root of the tree, listed in the background with opts for
+// the fuzzy finder
+type fileIndexMsg struct {
+	opts  file.Options
+	paths []string
+}
+
+// Folders below dir read in the background with opts, keyed by path, to
+// apply op to the selection of the files in them
+type treeLoadedMsg struct {
+	dir      *file.FileNode
+	opts     file.Options
+	children map[string][]*file.FileNode
+	op       selectOp
+	globs    string
+	err      error
+}
+
+// File read in the background for the preview pane as a prompt holds it,
+// colored line by line, with its size, line count and tokens; note says how
+// it differs from the file on disk and partial is set when it goes on past
+// the lines shown
+type filePaneMsg struct {
+	path    string
+	text    []string
+	size    int64
+	lines   int
+	tokens  int
+	note    string
+	partial bool
+	binary  bool
+	err     error
+}
+
+// File read in the background for the full preview, as a prompt holds it,
+// split into lines, with the declarations of a Go file; notes say how the
+// prompt uses it
+type filePreviewMsg struct {
+	path    string
+	lines   []string
+	symbols []file.Symbol
+	notes   []string
+	err     error
+}
+
+// Changed files of the repository read in the background; run identifies
+// the request
+type gitStatusMsg struct {
+	run    int
+	status file.GitStatus
+	err    error
+}
+
+// Directory that changed on disk, as an absolute path
+type dirChangedMsg struct {
+	dir string
+}
+
+// Token count computed in the background; gen identifies the request
+type tokenCountMsg struct {
+	gen    int
+	tokens int
+}
+
+// Result of checking the template commands from the Edit step
+type checkDoneMsg struct {
+	text  string
+	total int
+	errs  utils.CommandErrors
+}
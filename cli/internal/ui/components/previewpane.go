@@ -0,0 +1,197 @@
+package components
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/trknhr/chatgpt-dev-utils/internal/content"
+	"github.com/trknhr/chatgpt-dev-utils/internal/file"
+	"github.com/trknhr/chatgpt-dev-utils/internal/syntax"
+	"github.com/trknhr/chatgpt-dev-utils/internal/tokens"
+)
+
+const (
+	// paneMinWidth is the terminal width from which the preview pane is
+	// shown next to the tree
+	paneMinWidth = 100
+	// paneMaxLines bounds the part of a file the pane shows
+	paneMaxLines = 1000
+)
+
+// filePane is the preview of the file under the cursor of the file step
+type filePane struct {
+	// path is the file shown or being read
+	path   string
+	loaded bool
+	// header describes the file: its size, lines and tokens
+	header string
+}
+
+// showPane reports whether the preview pane fits next to the tree
+func (f *FileSelect) showPane() bool {
+	return f.ShowPreview && f.Width >= paneMinWidth
+}
+
+// layout sizes the tree and the preview pane to the terminal
+func (f *FileSelect) layout() {
+	width := max(f.Width-4, 20)
+	height := max(f.Height-8, 3)
+	f.Viewport.Width, f.Viewport.Height = width, height
+	if f.showPane() {
+		// The tree takes half the box and a separator sits between them
+		f.Viewport.Width = width / 2
+		f.Preview.Width = width - f.Viewport.Width - 3
+		f.Preview.Height = height - 1
+	}
+}
+
+// cursorNode is the node the preview pane shows: the one under the cursor
+// of the tree, or the file under the cursor of the finder
+func (f *FileSelect) cursorNode() *file.FileNode {
+	if f.search != nil {
+		if s := f.search; s.cursor < len(s.matches) {
+			path := s.matches[s.cursor].Text
+			if node := f.findNode(path); node != nil {
+				return node
+			}
+			return &file.FileNode{Path: path}
+		}
+		return nil
+	}
+	if f.Cursor < len(f.FlatFiles) {
+		return f.FlatFiles[f.Cursor]
+	}
+	return nil
+}
+
+// previewCursor starts reading the file under the cursor for the preview
+// pane in the background, if it is not the one shown already
+func (f *FileSelect) previewCursor() tea.Cmd {
+	if !f.showPane() {
+		return nil
+	}
+	node := f.cursorNode()
+	if node == nil {
+		if f.pane.path != "" {
+			f.pane = filePane{}
+			f.Preview.SetContent("")
+		}
+		return nil
+	}
+	if node.Path == f.pane.path {
+		return nil
+	}
+	f.pane = filePane{path: node.Path}
+	f.Preview.GotoTop()
+	if node.IsDir {
+		f.pane.loaded = true
+		f.pane.header = node.Name + "/"
+		if !node.Loaded {
+			f.Preview.SetContent(helpStyle.Render("Press Enter to list its files"))
+			return nil
+		}
+		var names []string
+		checks := file.Checks(node)
+		for _, child := range node.Children {
+			names = append(names, strings.TrimPrefix(file.RenderFileNodeWith(child, checks), strings.Repeat("  ", file.GetNodeDepth(child))))
+		}
+		f.Preview.SetContent(strings.Join(names, "\n"))
+		return nil
+	}
+	f.Preview.SetContent("Loading preview...")
+	path, encoding := node.Path, tokens.Current().Model.Encoding
+	return func() tea.Msg {
+		return readPane(path, encoding)
+	}
+}
+
+// readPane reads and colors the file at path as the prompt would hold it
+func readPane(path, encoding string) filePaneMsg {
+	msg := filePaneMsg{path: path}
+	f, err := content.Current().Read(path)
+	if err != nil {
+		msg.err = err
+		return msg
+	}
+	msg.size, msg.binary, msg.note = f.Size, f.Binary, f.Note()
+	if f.Binary {
+		return msg
+	}
+	text := strings.TrimSuffix(strings.ReplaceAll(f.Text, "\t", "    "), "\n")
+	msg.lines = strings.Count(text, "\n") + 1
+	if n, err := tokens.CountFile(encoding, path); err == nil {
+		msg.tokens = n
+	}
+	lines := strings.SplitN(text, "\n", paneMaxLines+1)
+	if len(lines) > paneMaxLines {
+		lines = lines[:paneMaxLines]
+		msg.partial = true
+	}
+	msg.text = syntax.Highlight(path, strings.Join(lines, "\n"))
+	return msg
+}
+
+// paneLoaded shows a file read by readPane, unless the cursor moved on
+func (f *FileSelect) paneLoaded(msg filePaneMsg) {
+	if msg.path != f.pane.path {
+		return
+	}
+	f.pane.loaded = true
+	switch {
+	case msg.err != nil:
+		f.pane.header = "Error: " + msg.err.Error()
+		f.Preview.SetContent("")
+		return
+	case msg.binary:
+		f.pane.header = msg.note
+		f.Preview.SetContent("")
+		return
+	}
+	lines := fmt.Sprintf("%d lines", msg.lines)
+	if msg.note != "" {
+		// Cut like in the prompt
+		lines = msg.note
+	}
+	f.pane.header = fmt.Sprintf("%s · %s · ~%d tokens", content.FormatBytes(msg.size), lines, msg.tokens)
+	if msg.partial {
+		msg.text = append(msg.text, helpStyle.Render("…"))
+	}
+	f.Preview.SetContent(strings.Join(msg.text, "\n"))
+}
+
+// paneView renders the tree with the preview pane on its right
+func (f *FileSelect) paneView(tree string) string {
+	header := f.pane.header
+	if !f.pane.loaded && f.pane.path != "" {
+		header = "Loading..."
+	}
+	pane := lipgloss.JoinVertical(lipgloss.Left,
+		helpStyle.Render(lipgloss.NewStyle().MaxWidth(f.Preview.Width).Render(header)),
+		f.Preview.View(),
+	)
+	separator := helpStyle.Render(strings.TrimSuffix(strings.Repeat(" │ \n", f.Viewport.Height), "\n"))
+	return lipgloss.JoinHorizontal(lipgloss.Top, tree, separator, pane)
+}
+
+// scrollPane scrolls the preview pane for the keys that do so
+func (f *FileSelect) scrollPane(key string) bool {
+	if !f.showPane() {
+		return false
+	}
+	switch key {
+	case "J":
+		f.Preview.ScrollDown(1)
+	case "K":
+		f.Preview.ScrollUp(1)
+	case "ctrl+d":
+		f.Preview.HalfPageDown()
+	case "ctrl+u":
+		f.Preview.HalfPageUp()
+	default:
+		return false
+	}
+	return true
+}
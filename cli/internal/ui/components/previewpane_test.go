@@ -0,0 +1,184 @@
+package components
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trknhr/chatgpt-dev-utils/internal/config"
+	"github.com/trknhr/chatgpt-dev-utils/internal/content"
+	"github.com/trknhr/chatgpt-dev-utils/internal/tokens"
+)
+
+func TestPreviewPane(t *testing.T) {
+	var long strings.Builder
+	for i := range 100 {
+		fmt.Fprintf(&long, "line %d\n", i+1)
+	}
+	// browse opens the file step on a folder with a Go file, a long file and
+	// a binary file, on a terminal of the given width
+	browse := func(t *testing.T, width int) *FileSelect {
+		t.Chdir(t.TempDir())
+		require.NoError(t, os.WriteFile("a.go", []byte("package a\n\nfunc A() {}\n"), 0644))
+		require.NoError(t, os.WriteFile("b.txt", []byte(long.String()), 0644))
+		require.NoError(t, os.WriteFile("c.bin", []byte{0x7f, 'E', 'L', 'F', 0, 1}, 0644))
+		fs := newFileBrowser(nil, width, 30)
+		run(fs, fs.Init())
+		return fs
+	}
+	down := func(fs *FileSelect) {
+		_, cmd := fs.Update(tea.KeyMsg{Type: tea.KeyDown})
+		run(fs, cmd)
+	}
+
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{
+			name: "shows the file under the cursor",
+			test: func(t *testing.T) {
+				fs := browse(t, 120)
+				n, err := tokens.CountFile(tokens.Current().Model.Encoding, "a.go")
+				require.NoError(t, err)
+
+				view := ansi.Strip(fs.View())
+				assert.Contains(t, view, fmt.Sprintf("23 B · 3 lines · ~%d tokens", n))
+				assert.Contains(t, view, "│ func A() {}")
+				assert.Contains(t, view, "[J/K: Scroll preview]")
+				assert.Contains(t, view, "[P: Hide preview]")
+			},
+		},
+		{
+			name: "follows the cursor",
+			test: func(t *testing.T) {
+				fs := browse(t, 120)
+				down(fs)
+				assert.Contains(t, ansi.Strip(fs.View()), "100 lines")
+				down(fs)
+				assert.Contains(t, ansi.Strip(fs.View()), "skipped: binary file, 6 B")
+			},
+		},
+		{
+			name: "shows files as the prompt holds them",
+			test: func(t *testing.T) {
+				reader, err := content.New(config.Files{MaxBytes: 64})
+				require.NoError(t, err)
+				previous := content.Current()
+				content.Configure(reader)
+				t.Cleanup(func() { content.Configure(previous) })
+
+				t.Chdir(t.TempDir())
+				require.NoError(t, os.WriteFile("a.txt", []byte("caf\xe9\n"), 0644))
+				require.NoError(t, os.WriteFile("b.txt", []byte(long.String()), 0644))
+				fs := newFileBrowser(nil, 120, 30)
+				run(fs, fs.Init())
+				assert.Contains(t, ansi.Strip(fs.View()), "│ café")
+
+				down(fs)
+				view := ansi.Strip(fs.View())
+				assert.Contains(t, view, "truncated: first and last lines of")
+				assert.Contains(t, view, "│ // ... ")
+				assert.Contains(t, view, "│ line 100")
+			},
+		},
+		{
+			name: "ignores a file read after the cursor moved on",
+			test: func(t *testing.T) {
+				fs := browse(t, 120)
+				_, cmd := fs.Update(tea.KeyMsg{Type: tea.KeyDown})
+				require.NotNil(t, cmd)
+				fs.Update(readPane("a.go", tokens.Current().Model.Encoding))
+				assert.Equal(t, "", fs.pane.header)
+				assert.False(t, fs.pane.loaded)
+				run(fs, cmd)
+				assert.Contains(t, fs.pane.header, "100 lines")
+			},
+		},
+		{
+			name: "a file read while the full preview is open shows on return",
+			test: func(t *testing.T) {
+				fs := browse(t, 120)
+				_, read := fs.Update(tea.KeyMsg{Type: tea.KeyDown})
+				require.NotNil(t, read)
+				next, _ := fs.Update(tea.KeyMsg{Type: tea.KeyEnter})
+				p, ok := next.(*FilePreview)
+				require.True(t, ok)
+
+				// The file is read while the preview is shown
+				var deliver func(cmd tea.Cmd)
+				deliver = func(cmd tea.Cmd) {
+					if cmd == nil {
+						return
+					}
+					msg := cmd()
+					if batch, ok := msg.(tea.BatchMsg); ok {
+						for _, c := range batch {
+							deliver(c)
+						}
+						return
+					}
+					p.Update(msg)
+				}
+				deliver(read)
+				back, _ := p.Prev()
+				require.Same(t, fs, back)
+				assert.Contains(t, ansi.Strip(fs.View()), "100 lines")
+			},
+		},
+		{
+			name: "J and K scroll the preview",
+			test: func(t *testing.T) {
+				fs := browse(t, 120)
+				down(fs)
+				for _, k := range []string{"J", "J", "J"} {
+					fs.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)})
+				}
+				assert.Equal(t, 3, fs.Preview.YOffset)
+				fs.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("K")})
+				assert.Equal(t, 2, fs.Preview.YOffset)
+				fs.Update(tea.KeyMsg{Type: tea.KeyCtrlD})
+				assert.Equal(t, 2+fs.Preview.Height/2, fs.Preview.YOffset)
+				assert.Equal(t, 1, fs.Cursor, "the cursor of the tree stays")
+			},
+		},
+		{
+			name: "P hides and shows the preview",
+			test: func(t *testing.T) {
+				fs := browse(t, 120)
+				_, cmd := fs.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("p")})
+				run(fs, cmd)
+				view := ansi.Strip(fs.View())
+				assert.NotContains(t, view, "func A() {}")
+				assert.Contains(t, view, "[P: Show preview]")
+				assert.Equal(t, 116, fs.Viewport.Width)
+
+				_, cmd = fs.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("p")})
+				run(fs, cmd)
+				assert.Contains(t, ansi.Strip(fs.View()), "func A() {}")
+				assert.Equal(t, 58, fs.Viewport.Width)
+			},
+		},
+		{
+			name: "a narrow terminal has no preview",
+			test: func(t *testing.T) {
+				fs := browse(t, 80)
+				view := ansi.Strip(fs.View())
+				assert.NotContains(t, view, "func A() {}")
+				assert.NotContains(t, view, "Scroll preview")
+
+				fs.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("J")})
+				assert.Equal(t, 0, fs.Preview.YOffset)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, tt.test)
+	}
+}
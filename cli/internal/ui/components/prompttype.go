@@ -3,17 +3,20 @@ package components
 import (
 	"fmt"
 
-	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/trknhr/chatgpt-dev-utils/internal/file"
+	"github.com/trknhr/chatgpt-dev-utils/internal/templates"
 )
 
 type PromptTypeModel struct {
 	cursor        int
 	width, height int
+	// session is the state shared with the other steps
+	session *Session
 }
 
-func NewPromptType(w, h int) *PromptTypeModel { return &PromptTypeModel{width: w, height: h} }
+func NewPromptType(w, h int) *PromptTypeModel {
+	return &PromptTypeModel{width: w, height: h, session: NewSession()}
+}
 
 func (m PromptTypeModel) Init() tea.Cmd { return nil }
 
@@ -61,40 +64,14 @@ func (m PromptTypeModel) View() string {
 
 func (m PromptTypeModel) Next() (Component, tea.Cmd) {
 	if m.cursor == 0 {
-		// File selection path
-		root := file.BuildFileTree(".")
-		flat := file.FlattenFileTree(root)
-
-		// Create viewport with proper dimensions
-		headerHeight := 4
-		footerHeight := 4
-		viewportHeight := m.height - headerHeight - footerHeight
-		if viewportHeight < 3 {
-			viewportHeight = 3
-		}
-		viewportWidth := m.width - 4
-		if viewportWidth < 20 {
-			viewportWidth = 20
-		}
-
-		vp := viewport.New(viewportWidth, viewportHeight)
-		// Initialize content
-		content := ""
-		for i, node := range flat {
-			prefix := " "
-			if i == 0 {
-				prefix = ">"
-			}
-			content += fmt.Sprintf("%s %s\n", prefix, file.RenderFileNode(node))
-		}
-		vp.SetContent(content)
-
-		selectPage := NewFileSelect(flat, []*file.FileNode{}, vp, 0, m.width, m.height, "")
-		return selectPage, nil
+		// File selection path; the tree loads in the background
+		selectPage := newFileBrowser(m.session, m.width, m.height)
+		return selectPage, selectPage.Init()
 	}
 
 	// Git template selection path
-	templates := []string{"Code Review", "Commit Message", "Change Summary", "Custom..."}
-	return NewTemplateSelect("git", templates, nil, m.width, m.height), nil
+	ts := NewTemplateSelect("git", templates.Names("git"), nil, m.width, m.height)
+	ts.session = m.session
+	return ts, nil
 }
 func (m PromptTypeModel) Prev() (Component, tea.Cmd) { return m, nil }
@@ -0,0 +1,157 @@
+package components
+
+import (
+	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+)
+
+// Result streams ChatGPT's reply to a prompt sent from the Final step
+type Result struct {
+	final     *Final
+	Title     string
+	RequestID string
+	Replies   <-chan protocol.Message
+	// Cancel stops waiting for the reply when leaving the view
+	Cancel   func()
+	Response string
+	Status   string
+	Done     bool
+	Message  string
+	Viewport viewport.Model
+	Width    int
+	Height   int
+}
+
+func NewResult(final *Final, requestID string, replies <-chan protocol.Message) *Result {
+	r := &Result{
+		final:     final,
+		Title:     "ChatGPT Reply",
+		RequestID: requestID,
+		Replies:   replies,
+		Status:    "Waiting for the extension...",
+		Width:     final.Width,
+		Height:    final.Height,
+	}
+	r.Viewport = viewport.New(r.viewportSize())
+	return r
+}
+
+func (r *Result) Init() tea.Cmd {
+	return waitForReply(r.RequestID, r.Replies)
+}
+
+// waitForReply blocks until the next message for the request arrives
+func waitForReply(id string, replies <-chan protocol.Message) tea.Cmd {
+	if replies == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		m, ok := <-replies
+		return replyMsg{id: id, message: m, closed: !ok}
+	}
+}
+
+func (r *Result) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		r.Width = msg.Width
+		r.Height = msg.Height
+		r.Viewport.Width, r.Viewport.Height = r.viewportSize()
+
+	case ConnectionMsg:
+		// Keep the Final step in sync for when we go back
+		r.final.Update(msg)
+		return r, nil
+
+	case replyMsg:
+		if msg.id != r.RequestID || r.Done {
+			return r, nil
+		}
+		if msg.closed {
+			// A final message marks the reply done before the channel closes
+			r.Done = true
+			r.Status = "Connection closed before the reply finished"
+			return r, nil
+		}
+		switch msg.message.Type {
+		case protocol.TypeAck:
+			r.Status = "ChatGPT is answering..."
+		case protocol.TypeResponseChunk:
+			r.Status = "ChatGPT is answering..."
+			r.Response += msg.message.Text
+		case protocol.TypeResponseDone:
+			r.Status = "Done"
+			r.Done = true
+			if msg.message.Text != "" {
+				r.Response = msg.message.Text
+			}
+		case protocol.TypeError:
+			r.Status = "Error: " + msg.message.Error
+			r.Done = true
+		}
+		r.Viewport.SetContent(r.Response)
+		r.Viewport.GotoBottom()
+		if r.Done {
+			return r, nil
+		}
+		return r, waitForReply(r.RequestID, r.Replies)
+
+	case tea.KeyMsg:
+		if msg.String() == "c" && r.Response != "" {
+			clipboard.WriteAll(r.Response)
+			r.Message = "Copied reply to clipboard!"
+			return r, nil
+		}
+	}
+
+	r.Viewport, cmd = r.Viewport.Update(msg)
+	return r, cmd
+}
+
+func (r *Result) View() string {
+	body := r.Viewport.View()
+	if r.Response == "" {
+		body = r.Status
+	} else {
+		body = r.Status + "\n\n" + body
+	}
+
+	return RenderLayoutWithMessage(
+		r.Title,
+		body,
+		"[↑↓ Scroll] [C: Copy reply] [Esc: Back]",
+		r.Message,
+		r.Width,
+		r.Height,
+	)
+}
+
+func (r *Result) viewportSize() (int, int) {
+	width := r.Width - 4
+	if width < 20 {
+		width = 20
+	}
+	height := r.Height - 10
+	if height < 3 {
+		height = 3
+	}
+	return width, height
+}
+
+func (r *Result) Next() (Component, tea.Cmd) {
+	// Final step, no next
+	return r, nil
+}
+
+func (r *Result) Prev() (Component, tea.Cmd) {
+	// Stop listening and go back to the Final step
+	if !r.Done && r.Cancel != nil {
+		r.Cancel()
+	}
+	r.final.Width, r.final.Height = r.Width, r.Height
+	return r.final, nil
+}
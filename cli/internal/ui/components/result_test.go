@@ -0,0 +1,122 @@
+package components
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trknhr/chatgpt-dev-utils/internal/protocol"
+)
+
+func TestResult(t *testing.T) {
+	newResult := func() (*Result, *protocol.Pending) {
+		ext := newFakeExtension(1)
+		final := NewFinal("git", "Template", "Prompt", nil, 80, 24, true, ext)
+		r := NewResult(final, "req", ext.Track("req"))
+		r.Cancel = func() { ext.Forget("req") }
+		return r, ext.pending
+	}
+
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{
+			name: "Init waits for the next reply",
+			test: func(t *testing.T) {
+				r, pending := newResult()
+				pending.Deliver(protocol.Message{Type: protocol.TypeAck, ID: "req"})
+
+				msg := r.Init()()
+				reply, ok := msg.(replyMsg)
+				require.True(t, ok)
+				assert.Equal(t, "req", reply.id)
+				assert.Equal(t, protocol.TypeAck, reply.message.Type)
+			},
+		},
+		{
+			name: "Update appends chunks and finishes on done",
+			test: func(t *testing.T) {
+				r, _ := newResult()
+
+				_, cmd := r.Update(replyMsg{id: "req", message: protocol.Message{Type: protocol.TypeResponseChunk, Text: "Hello"}})
+				assert.NotNil(t, cmd)
+				r.Update(replyMsg{id: "req", message: protocol.Message{Type: protocol.TypeResponseChunk, Text: " world"}})
+				assert.Equal(t, "Hello world", r.Response)
+
+				r.Update(replyMsg{id: "req", message: protocol.Message{Type: protocol.TypeResponseDone, Text: "Hello world!"}})
+				r.Update(replyMsg{id: "req", closed: true})
+
+				assert.True(t, r.Done)
+				assert.Equal(t, "Done", r.Status)
+				assert.Equal(t, "Hello world!", r.Response)
+				assert.Contains(t, r.View(), "Hello world!")
+			},
+		},
+		{
+			name: "Update shows extension errors",
+			test: func(t *testing.T) {
+				r, _ := newResult()
+
+				r.Update(replyMsg{id: "req", message: protocol.Message{Type: protocol.TypeError, Error: "tab did not load"}})
+				// The channel closes after the final message
+				r.Update(replyMsg{id: "req", closed: true})
+
+				assert.True(t, r.Done)
+				assert.Equal(t, "Error: tab did not load", r.Status)
+				assert.Contains(t, r.View(), "Error: tab did not load")
+			},
+		},
+		{
+			name: "Update reports a connection closed mid-reply",
+			test: func(t *testing.T) {
+				r, _ := newResult()
+
+				r.Update(replyMsg{id: "req", message: protocol.Message{Type: protocol.TypeResponseChunk, Text: "Hel"}})
+				r.Update(replyMsg{id: "req", closed: true})
+
+				assert.True(t, r.Done)
+				assert.Equal(t, "Connection closed before the reply finished", r.Status)
+			},
+		},
+		{
+			name: "Update ignores replies for other requests",
+			test: func(t *testing.T) {
+				r, _ := newResult()
+
+				_, cmd := r.Update(replyMsg{id: "other", message: protocol.Message{Type: protocol.TypeResponseChunk, Text: "x"}})
+
+				assert.Nil(t, cmd)
+				assert.Empty(t, r.Response)
+			},
+		},
+		{
+			name: "Prev returns to Final and stops tracking",
+			test: func(t *testing.T) {
+				r, pending := newResult()
+
+				prev, _ := r.Prev()
+				_, ok := prev.(*Final)
+
+				assert.True(t, ok)
+				assert.False(t, pending.Deliver(protocol.Message{Type: protocol.TypeAck, ID: "req"}))
+			},
+		},
+		{
+			name: "View renders waiting state",
+			test: func(t *testing.T) {
+				r, _ := newResult()
+				r.Update(tea.WindowSizeMsg{Width: 100, Height: 30})
+
+				view := r.View()
+				assert.Contains(t, view, "ChatGPT Reply")
+				assert.Contains(t, view, "Waiting for the extension...")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, tt.test)
+	}
+}
@@ -1,26 +1,35 @@
 package components
 
-import tea "github.com/charmbracelet/bubbletea"
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/trknhr/chatgpt-dev-utils/internal/file"
+)
 
 type Root struct {
 	child              Component
 	width, height      int
-	broadcastChan      chan<- string
-	clientsCount       func() int
+	extension          Extension
 	extensionConnected bool
+	pairingToken       string
+	// watching is set once the file tree is shown and directory changes
+	// are listened for
+	watching bool
 }
 
-func NewRoot(w, h int, broadcastChan chan<- string, clientsCount func() int) *Root {
+func NewRoot(w, h int, extension Extension, pairingToken string) *Root {
 	return &Root{
-		child:         NewPromptType(w, h),
-		width:         w,
-		height:        h,
-		broadcastChan: broadcastChan,
-		clientsCount:  clientsCount,
+		child:              NewPromptType(w, h),
+		width:              w,
+		height:             h,
+		extension:          extension,
+		extensionConnected: extension != nil && extension.Count() > 0,
+		pairingToken:       pairingToken,
 	}
 }
 
-func (r *Root) Init() tea.Cmd { return r.child.Init() }
+func (r *Root) Init() tea.Cmd {
+	return tea.Batch(r.child.Init(), waitForConnection(r.extension))
+}
 
 func (r *Root) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
@@ -28,12 +37,22 @@ func (r *Root) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		r.width, r.height = msg.Width, msg.Height
 		// Let the message propagate to child components
 		
-	case CheckConnectionMsg:
-		// Update extension connection status
-		if r.clientsCount != nil {
-			r.extensionConnected = r.clientsCount() > 0
+	case ConnectionMsg:
+		// Update extension connection status and keep listening
+		r.extensionConnected = msg.Clients > 0
+		updated, cmd := r.child.Update(msg)
+		if updated != nil {
+			r.child = updated.(Component)
+		}
+		return r, tea.Batch(cmd, waitForConnection(r.extension))
+
+	case dirChangedMsg:
+		// Let the file tree reload the directory and keep listening
+		updated, cmd := r.child.Update(msg)
+		if updated != nil {
+			r.child = updated.(Component)
 		}
-		return r, nil
+		return r, tea.Batch(cmd, waitForDirChange(file.DefaultCache()))
 
 	case tea.KeyMsg:
 		switch msg.String() {
@@ -44,19 +63,18 @@ func (r *Root) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				// Pass WebSocket context to Final component
 				if final, ok := nextChild.(*Final); ok {
 					final.ExtensionConnected = r.extensionConnected
-					final.BroadcastChan = r.broadcastChan
-					final.ClientsCount = r.clientsCount
+					final.Extension = r.extension
 				}
 				r.child = nextChild
 			}
-			return r, cmd
+			return r, tea.Batch(cmd, r.watchFiles())
 		case "esc":
 			// Navigate backward
 			prevChild, cmd := r.child.Prev()
 			if prevChild != nil {
 				r.child = prevChild
 			}
-			return r, cmd
+			return r, tea.Batch(cmd, r.watchFiles())
 		}
 	}
 
@@ -68,7 +86,14 @@ func (r *Root) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return r, cmd
 }
 
-func (r *Root) View() string { return r.child.View() }
+func (r *Root) View() string {
+	view := r.child.View()
+	if !r.extensionConnected && r.pairingToken != "" {
+		// Remind how to pair until an extension connects
+		view += "\n" + helpStyle.Render("Extension not connected · pairing token: "+r.pairingToken)
+	}
+	return view
+}
 
 func (r *Root) Next() (Component, tea.Cmd) {
 	// Root doesn't navigate, it manages child navigation
@@ -79,3 +104,35 @@ func (r *Root) Prev() (Component, tea.Cmd) {
 	// Root doesn't navigate, it manages child navigation
 	return r, nil
 }
+
+// Typing reports whether the current step reads typed text, so that keys
+// such as q are not taken as commands
+func (r *Root) Typing() bool {
+	t, ok := r.child.(interface{ Typing() bool })
+	return ok && t.Typing()
+}
+
+// watchFiles starts listening for directory changes the first time the
+// file tree is shown
+func (r *Root) watchFiles() tea.Cmd {
+	if _, ok := r.child.(*FileSelect); !ok || r.watching {
+		return nil
+	}
+	r.watching = true
+	return waitForDirChange(file.DefaultCache())
+}
+
+// waitForDirChange waits for a directory of the file tree to change on disk
+func waitForDirChange(cache *file.Cache) tea.Cmd {
+	changes := cache.Changes()
+	if changes == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		dir, ok := <-changes
+		if !ok {
+			return nil
+		}
+		return dirChangedMsg{dir: dir}
+	}
+}
@@ -3,8 +3,10 @@ package components
 import (
 	"testing"
 
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/stretchr/testify/assert"
+	"github.com/trknhr/chatgpt-dev-utils/internal/file"
 )
 
 func TestRoot(t *testing.T) {
@@ -15,15 +17,14 @@ func TestRoot(t *testing.T) {
 		{
 			name: "NewRoot creates root with PromptType child",
 			test: func(t *testing.T) {
-				broadcastChan := make(chan<- string)
-				clientsCount := func() int { return 0 }
-				root := NewRoot(80, 24, broadcastChan, clientsCount)
+				ext := newFakeExtension(0)
+				root := NewRoot(80, 24, ext, "")
 
 				assert.Equal(t, 80, root.width)
 				assert.Equal(t, 24, root.height)
 				assert.NotNil(t, root.child)
-				assert.NotNil(t, root.broadcastChan)
-				assert.NotNil(t, root.clientsCount)
+				assert.Equal(t, ext, root.extension)
+				assert.False(t, root.extensionConnected)
 
 				_, ok := root.child.(*PromptTypeModel)
 				assert.True(t, ok)
@@ -32,7 +33,7 @@ func TestRoot(t *testing.T) {
 		{
 			name: "Init delegates to child",
 			test: func(t *testing.T) {
-				root := NewRoot(80, 24, nil, nil)
+				root := NewRoot(80, 24, nil, "")
 				cmd := root.Init()
 				// Child's Init returns nil, so root should too
 				assert.Nil(t, cmd)
@@ -41,7 +42,7 @@ func TestRoot(t *testing.T) {
 		{
 			name: "Update handles window resize",
 			test: func(t *testing.T) {
-				root := NewRoot(80, 24, nil, nil)
+				root := NewRoot(80, 24, nil, "")
 
 				msg := tea.WindowSizeMsg{Width: 100, Height: 30}
 				newModel, _ := root.Update(msg)
@@ -52,22 +53,31 @@ func TestRoot(t *testing.T) {
 			},
 		},
 		{
-			name: "Update handles CheckConnectionMsg",
+			name: "Update handles ConnectionMsg",
 			test: func(t *testing.T) {
-				clientsCount := func() int { return 3 }
-				root := NewRoot(80, 24, nil, clientsCount)
+				ext := newFakeExtension(0)
+				root := NewRoot(80, 24, ext, "")
 
-				msg := CheckConnectionMsg{}
-				newModel, _ := root.Update(msg)
+				msg := ConnectionMsg{Clients: 3}
+				newModel, cmd := root.Update(msg)
 				updated := newModel.(*Root)
 
 				assert.True(t, updated.extensionConnected)
+				assert.NotNil(t, cmd, "root keeps listening for connection events")
+			},
+		},
+		{
+			name: "NewRoot picks up an existing connection",
+			test: func(t *testing.T) {
+				root := NewRoot(80, 24, newFakeExtension(1), "")
+
+				assert.True(t, root.extensionConnected)
 			},
 		},
 		{
 			name: "Update handles tab navigation forward",
 			test: func(t *testing.T) {
-				root := NewRoot(80, 24, nil, nil)
+				root := NewRoot(80, 24, nil, "")
 				// Set up root with a mock component that has Next
 				mockChild := &mockComponent{
 					nextComponent: NewPromptType(80, 24),
@@ -86,7 +96,7 @@ func TestRoot(t *testing.T) {
 		{
 			name: "Update handles esc navigation backward",
 			test: func(t *testing.T) {
-				root := NewRoot(80, 24, nil, nil)
+				root := NewRoot(80, 24, nil, "")
 				// Set up root with a mock component that has Prev
 				mockChild := &mockComponent{
 					prevComponent: NewPromptType(80, 24),
@@ -102,16 +112,42 @@ func TestRoot(t *testing.T) {
 				assert.True(t, ok)
 			},
 		},
+		{
+			name: "Update listens for directory changes once the file tree is shown",
+			test: func(t *testing.T) {
+				root := NewRoot(80, 24, nil, "")
+				fs := NewFileSelect(nil, nil, viewport.New(80, 20), 0, 80, 24, "")
+				root.child = &mockComponent{nextComponent: fs}
+
+				_, cmd := root.Update(tea.KeyMsg{Type: tea.KeyTab})
+
+				assert.Equal(t, file.DefaultCache().Changes() != nil, cmd != nil)
+				assert.True(t, root.watching)
+				assert.Nil(t, root.watchFiles(), "listens only once")
+			},
+		},
+		{
+			name: "Typing follows the file finder",
+			test: func(t *testing.T) {
+				root := NewRoot(80, 24, nil, "")
+				fs := NewFileSelect(nil, nil, viewport.New(80, 20), 0, 80, 24, "")
+				root.child = fs
+				assert.False(t, root.Typing())
+
+				fs.search = &fileSearch{}
+
+				assert.True(t, root.Typing())
+			},
+		},
 		{
 			name: "Update injects WebSocket context to Final component",
 			test: func(t *testing.T) {
-				broadcastChan := make(chan<- string)
-				clientsCount := func() int { return 1 }
-				root := NewRoot(80, 24, broadcastChan, clientsCount)
+				ext := newFakeExtension(1)
+				root := NewRoot(80, 24, ext, "")
 				root.extensionConnected = true
 
 				// Set up with mock that returns Final component
-				finalComp := NewFinal("git", "Template", "Prompt", nil, 80, 24, false, nil, nil)
+				finalComp := NewFinal("git", "Template", "Prompt", nil, 80, 24, false, nil)
 				mockChild := &mockComponent{
 					nextComponent: finalComp,
 				}
@@ -125,24 +161,35 @@ func TestRoot(t *testing.T) {
 				final, ok := updated.child.(*Final)
 				assert.True(t, ok)
 				assert.True(t, final.ExtensionConnected)
-				assert.NotNil(t, final.BroadcastChan)
-				assert.NotNil(t, final.ClientsCount)
+				assert.Equal(t, ext, final.Extension)
 			},
 		},
 		{
 			name: "View delegates to child",
 			test: func(t *testing.T) {
-				root := NewRoot(80, 24, nil, nil)
+				root := NewRoot(80, 24, nil, "")
 				view := root.View()
 
 				// Should contain content from PromptType view
 				assert.Contains(t, view, "Step 1: Choose Prompt Type")
 			},
 		},
+		{
+			name: "View shows pairing token until connected",
+			test: func(t *testing.T) {
+				ext := newFakeExtension(0)
+				root := NewRoot(80, 24, ext, "K7QP-3MZD-9XTR-WB2H")
+
+				assert.Contains(t, root.View(), "pairing token: K7QP-3MZD-9XTR-WB2H")
+
+				root.Update(ConnectionMsg{Clients: 1})
+				assert.NotContains(t, root.View(), "K7QP-3MZD-9XTR-WB2H")
+			},
+		},
 		{
 			name: "Next returns self",
 			test: func(t *testing.T) {
-				root := NewRoot(80, 24, nil, nil)
+				root := NewRoot(80, 24, nil, "")
 				next, cmd := root.Next()
 
 				assert.Equal(t, root, next)
@@ -152,7 +199,7 @@ func TestRoot(t *testing.T) {
 		{
 			name: "Prev returns self",
 			test: func(t *testing.T) {
-				root := NewRoot(80, 24, nil, nil)
+				root := NewRoot(80, 24, nil, "")
 				prev, cmd := root.Prev()
 
 				assert.Equal(t, root, prev)
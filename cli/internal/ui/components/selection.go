@@ -0,0 +1,228 @@
+package components
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/trknhr/chatgpt-dev-utils/internal/file"
+)
+
+// selectOp is a change to the selection of the files below a folder,
+// applied once the whole folder is loaded
+type selectOp int
+
+const (
+	// selectToggle selects the files, or unselects them if all of them are
+	// selected
+	selectToggle selectOp = iota
+	selectAll
+	selectInvert
+	// selectGlob selects the files that match the patterns
+	selectGlob
+	// selectChanged selects the files git reports as changed
+	selectChanged
+)
+
+// queuedSelect is a selection change waiting for its folder to load
+type queuedSelect struct {
+	op    selectOp
+	globs string
+}
+
+// setSelected selects or unselects node, keeping Selected in order. An
+// unselected file loses its line ranges.
+func (f *FileSelect) setSelected(node *file.FileNode, selected bool) {
+	i := slices.IndexFunc(f.Selected, func(n *file.FileNode) bool { return n.Path == node.Path })
+	switch {
+	case selected && i < 0:
+		f.Selected = append(f.Selected, node)
+	case !selected && i >= 0:
+		f.Selected = slices.Delete(f.Selected, i, i+1)
+	}
+	node.Selected = selected
+	if !selected {
+		node.Ranges = nil
+	}
+}
+
+// clearSelection unselects every file
+func (f *FileSelect) clearSelection() tea.Cmd {
+	for _, node := range f.Selected {
+		node.Selected, node.Ranges = false, nil
+	}
+	f.Selected = nil
+	f.Message = ""
+	f.updateViewportContent()
+	return f.countTokens()
+}
+
+// selectTree loads every folder below dir that is not ignored, then applies
+// op to the files in them. While dir is being read the change is queued.
+func (f *FileSelect) selectTree(dir *file.FileNode, op selectOp, globs string) tea.Cmd {
+	if f.loading[dir] {
+		if f.queued == nil {
+			f.queued = map[*file.FileNode][]queuedSelect{}
+		}
+		f.queued[dir] = append(f.queued[dir], queuedSelect{op: op, globs: globs})
+		return nil
+	}
+	f.loading[dir] = true
+	f.updateViewportContent()
+	opts, git := file.Options{ShowIgnored: f.ShowIgnored}, f.git
+	root := dir.Snapshot()
+	return func() tea.Msg {
+		children := map[string][]*file.FileNode{}
+		var walk func(node *file.FileNode) error
+		walk = func(node *file.FileNode) error {
+			list, err := file.DefaultCache().Load(node, opts)
+			if err != nil {
+				return err
+			}
+			children[node.Path] = list
+			for _, child := range list {
+				if child.IsDir && !child.Ignored && (op != selectChanged || git.Changes(child) > 0) {
+					if err := walk(child); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+		err := walk(root)
+		return treeLoadedMsg{dir: dir, opts: opts, children: children, op: op, globs: globs, err: err}
+	}
+}
+
+// dequeue starts the first selection change queued for dir; the others wait
+// for it to finish
+func (f *FileSelect) dequeue(dir *file.FileNode) tea.Cmd {
+	queue := f.queued[dir]
+	if len(queue) == 0 || f.loading[dir] {
+		return nil
+	}
+	if len(queue) == 1 {
+		delete(f.queued, dir)
+	} else {
+		f.queued[dir] = queue[1:]
+	}
+	return f.selectTree(dir, queue[0].op, queue[0].globs)
+}
+
+// treeLoaded adds the folders read by selectTree to the tree and changes
+// the selection of the files in them
+func (f *FileSelect) treeLoaded(msg treeLoadedMsg) tea.Cmd {
+	if !f.loading[msg.dir] {
+		// From a tree that was replaced
+		return nil
+	}
+	delete(f.loading, msg.dir)
+	if msg.opts.ShowIgnored != f.ShowIgnored {
+		return f.selectTree(msg.dir, msg.op, msg.globs)
+	}
+	if msg.err != nil {
+		f.Message = "Error: " + msg.err.Error()
+		f.updateViewportContent()
+		return f.dequeue(msg.dir)
+	}
+
+	var files []*file.FileNode
+	var walk func(node *file.FileNode)
+	walk = func(node *file.FileNode) {
+		if children, ok := msg.children[node.Path]; ok {
+			node.SetChildren(children)
+			f.adopt(node)
+			f.git.Decorate(node)
+		}
+		for _, child := range node.Children {
+			switch {
+			case child.IsDir:
+				walk(child)
+			case !child.Ignored:
+				files = append(files, child)
+			}
+		}
+	}
+	walk(msg.dir)
+
+	switch msg.op {
+	case selectToggle:
+		all := !slices.ContainsFunc(files, func(n *file.FileNode) bool { return !n.Selected })
+		for _, node := range files {
+			f.setSelected(node, !all)
+		}
+	case selectAll:
+		for _, node := range files {
+			f.setSelected(node, true)
+		}
+	case selectInvert:
+		for _, node := range files {
+			f.setSelected(node, !node.Selected)
+		}
+	case selectGlob:
+		globs := file.ParseIgnore("", strings.Join(strings.Fields(msg.globs), "\n"))
+		matched := 0
+		for _, node := range files {
+			rel, err := filepath.Rel(msg.dir.Path, node.Path)
+			if err == nil && globs.Match(filepath.ToSlash(rel), false) {
+				f.setSelected(node, true)
+				matched++
+			}
+		}
+		f.Message = fmt.Sprintf("%d files match %s", matched, msg.globs)
+	case selectChanged:
+		f.changedSelected(files)
+	}
+
+	f.FlatFiles = file.FlattenFileTree(f.findRoot())
+	f.updateViewportContent()
+	return tea.Batch(f.countTokens(), f.dequeue(msg.dir))
+}
+
+// adopt replaces files selected by path with the nodes of dir's children
+func (f *FileSelect) adopt(dir *file.FileNode) {
+	for _, child := range dir.Children {
+		if i := slices.IndexFunc(f.Selected, func(n *file.FileNode) bool { return n.Path == child.Path }); i >= 0 && !child.IsDir {
+			child.Selected = true
+			child.Ranges = f.Selected[i].Ranges
+			f.Selected[i] = child
+		}
+	}
+}
+
+// updateGlob handles the keys of the glob prompt: typing edits the
+// patterns and enter selects the files that match them
+func (f *FileSelect) updateGlob(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "enter":
+		globs := strings.TrimSpace(*f.glob)
+		f.glob = nil
+		if globs == "" {
+			f.updateViewportContent()
+			return nil
+		}
+		return f.selectTree(f.findRoot(), selectGlob, globs)
+	case "backspace":
+		if runes := []rune(*f.glob); len(runes) > 0 {
+			*f.glob = string(runes[:len(runes)-1])
+		}
+	default:
+		if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+			*f.glob += string(msg.Runes)
+		}
+	}
+	f.updateViewportContent()
+	return nil
+}
+
+// selectedSize is the size in bytes of the selected files
+func (f *FileSelect) selectedSize() int64 {
+	var size int64
+	for _, node := range f.Selected {
+		size += node.Size
+	}
+	return size
+}
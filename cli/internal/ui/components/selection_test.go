@@ -0,0 +1,198 @@
+package components
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelection(t *testing.T) {
+	// browse opens a file browser on a repository with a package, a
+	// nested package and an ignored file
+	browse := func(t *testing.T) *FileSelect {
+		dir := t.TempDir()
+		files := map[string]string{
+			".gitignore":           "*.log\n",
+			"main.go":              "package main",
+			"pkg/a.go":             "package pkg",
+			"pkg/a_test.go":        "package pkg",
+			"pkg/debug.log":        "log",
+			"pkg/sub/b.go":         "package sub",
+			"pkg/sub/README.md":    "# sub",
+			"docs/usage.md":        "# usage",
+			"docs/examples/ex.go":  "package ex",
+			"docs/examples/ex.txt": "ex",
+		}
+		for name, content := range files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		}
+		t.Chdir(dir)
+		fs := newFileBrowser(nil, 80, 40)
+		run(fs, fs.Init())
+		return fs
+	}
+	key := func(fs *FileSelect, k string) {
+		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+		if k == " " {
+			msg = tea.KeyMsg{Type: tea.KeySpace, Runes: []rune(k)}
+		}
+		_, cmd := fs.Update(msg)
+		run(fs, cmd)
+	}
+	paths := func(fs *FileSelect) []string {
+		var out []string
+		for _, n := range fs.Selected {
+			out = append(out, filepath.ToSlash(n.Path))
+		}
+		return out
+	}
+
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{
+			name: "space on a folder selects every file below it",
+			test: func(t *testing.T) {
+				fs := browse(t)
+				require.Equal(t, []string{"docs", "pkg", "main.go"}, names(fs))
+				fs.Update(tea.KeyMsg{Type: tea.KeyDown})
+
+				key(fs, " ")
+
+				assert.ElementsMatch(t, []string{"pkg/a.go", "pkg/a_test.go", "pkg/sub/README.md", "pkg/sub/b.go"}, paths(fs))
+				assert.Contains(t, fs.View(), "◉ pkg/")
+				assert.Contains(t, fs.View(), "Selected: 4 files (38 B)")
+				assert.Equal(t, []string{"docs", "pkg", "main.go"}, names(fs), "the folder stays closed")
+
+				fs.Update(tea.KeyMsg{Type: tea.KeyEnter})
+				fs.Update(tea.KeyMsg{Type: tea.KeyDown})
+				fs.Update(tea.KeyMsg{Type: tea.KeyDown})
+				key(fs, " ")
+				assert.Contains(t, fs.View(), "◐ pkg/")
+
+				fs.Update(tea.KeyMsg{Type: tea.KeyUp})
+				fs.Update(tea.KeyMsg{Type: tea.KeyUp})
+				key(fs, " ")
+				assert.Len(t, fs.Selected, 4, "a partly selected folder is selected")
+			},
+		},
+		{
+			name: "space selects a whole folder once all of it is selected",
+			test: func(t *testing.T) {
+				fs := browse(t)
+				fs.Update(tea.KeyMsg{Type: tea.KeyDown})
+				key(fs, " ")
+
+				key(fs, " ")
+
+				assert.Empty(t, fs.Selected)
+				assert.Contains(t, fs.View(), "◯ pkg/")
+			},
+		},
+		{
+			name: "glob patterns select the matching files",
+			test: func(t *testing.T) {
+				fs := browse(t)
+
+				key(fs, "g")
+				assert.True(t, fs.Typing())
+				for _, k := range "*.go !*_test.go" {
+					key(fs, string(k))
+				}
+				assert.Contains(t, fs.View(), "! excludes): *.go !*_test.go")
+				_, cmd := fs.Update(tea.KeyMsg{Type: tea.KeyEnter})
+				run(fs, cmd)
+
+				assert.ElementsMatch(t, []string{"main.go", "pkg/a.go", "pkg/sub/b.go", "docs/examples/ex.go"}, paths(fs))
+				assert.Contains(t, fs.View(), "4 files match *.go !*_test.go")
+				assert.False(t, fs.Typing())
+			},
+		},
+		{
+			name: "all, none and invert",
+			test: func(t *testing.T) {
+				fs := browse(t)
+
+				key(fs, "a")
+				assert.Len(t, fs.Selected, 8, "every file but the ignored one")
+				key(fs, "n")
+				assert.Empty(t, fs.Selected)
+
+				fs.Update(tea.KeyMsg{Type: tea.KeyDown})
+				fs.Update(tea.KeyMsg{Type: tea.KeyDown})
+				key(fs, " ")
+				key(fs, "i")
+
+				assert.Len(t, fs.Selected, 7)
+				assert.NotContains(t, paths(fs), "main.go")
+			},
+		},
+		{
+			name: "a folder is read apart from the tree changing meanwhile",
+			test: func(t *testing.T) {
+				fs := browse(t)
+				pkg := fs.findNode("pkg")
+				require.NotNil(t, pkg)
+				cmd := fs.selectTree(pkg, selectToggle, "")
+				read := make(chan tea.Msg)
+				go func() { read <- cmd() }()
+
+				// The tree is read again, as after a change on disk
+				abs, err := filepath.Abs(".")
+				require.NoError(t, err)
+				_, reload := fs.Update(dirChangedMsg{dir: abs})
+				run(fs, reload)
+				_, cmd = fs.Update(<-read)
+				run(fs, cmd)
+
+				assert.ElementsMatch(t, []string{"pkg/a.go", "pkg/a_test.go", "pkg/sub/README.md", "pkg/sub/b.go"}, paths(fs))
+				for _, node := range fs.Selected {
+					assert.Same(t, fs.findNode(filepath.ToSlash(filepath.Dir(node.Path))), node.Parent)
+				}
+			},
+		},
+		{
+			name: "a selection asked for while the folder loads waits for it",
+			test: func(t *testing.T) {
+				fs := browse(t)
+				pkg := fs.findNode("pkg")
+				require.NotNil(t, pkg)
+				load := fs.loadDir(pkg)
+				require.NotNil(t, load)
+
+				fs.Update(tea.KeyMsg{Type: tea.KeyDown})
+				_, cmd := fs.Update(tea.KeyMsg{Type: tea.KeySpace, Runes: []rune(" ")})
+				assert.Nil(t, cmd, "the folder is still loading")
+				assert.Empty(t, fs.Selected)
+
+				run(fs, load)
+
+				assert.ElementsMatch(t, []string{"pkg/a.go", "pkg/a_test.go", "pkg/sub/README.md", "pkg/sub/b.go"}, paths(fs))
+				assert.Empty(t, fs.queued)
+			},
+		},
+		{
+			name: "Prev closes the glob prompt",
+			test: func(t *testing.T) {
+				fs := browse(t)
+				key(fs, "g")
+
+				prev, _ := fs.Prev()
+
+				assert.Same(t, fs, prev)
+				assert.False(t, fs.Typing())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, tt.test)
+	}
+}
@@ -0,0 +1,48 @@
+package components
+
+import "github.com/trknhr/chatgpt-dev-utils/internal/file"
+
+// Session is the state the steps share. Each step hands it to the step it
+// moves to, so the file tree looks the same when the user comes back to it.
+type Session struct {
+	// Tree is the file tree as last browsed, with its open and loaded
+	// folders; nil until the file step is left
+	Tree        *file.FileNode
+	ShowIgnored bool
+	HidePreview bool
+	// Selected are the paths of the selected files, in selection order, and
+	// Ranges the parts of those selected in part
+	Selected []string
+	Ranges   map[string][]file.Range
+	// Cursor is the path under the cursor of the file step, and Offset the
+	// first line it shows
+	Cursor string
+	Offset int
+	// Confirmed are the sources of the project templates whose commands the
+	// user agreed to run
+	Confirmed []string
+}
+
+// NewSession returns the state of a new run through the steps
+func NewSession() *Session {
+	return &Session{}
+}
+
+// save records the state of the file step
+func (s *Session) save(f *FileSelect) {
+	s.Tree = f.findRoot()
+	s.ShowIgnored = f.ShowIgnored
+	s.HidePreview = !f.ShowPreview
+	s.Selected, s.Ranges = nil, map[string][]file.Range{}
+	for _, node := range f.Selected {
+		s.Selected = append(s.Selected, node.Path)
+		if node.Ranges != nil {
+			s.Ranges[node.Path] = node.Ranges
+		}
+	}
+	s.Cursor = ""
+	if f.Cursor < len(f.FlatFiles) {
+		s.Cursor = f.FlatFiles[f.Cursor].Path
+	}
+	s.Offset = f.Viewport.YOffset
+}
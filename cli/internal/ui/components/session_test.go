@@ -0,0 +1,90 @@
+package components
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSession(t *testing.T) {
+	// browse opens the file step on a folder of many files, with the
+	// folder open and its last file selected
+	browse := func(t *testing.T) *FileSelect {
+		dir := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "pkg"), 0755))
+		for i := range 30 {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "pkg", fmt.Sprintf("f%02d.go", i)), []byte("package pkg"), 0644))
+		}
+		t.Chdir(dir)
+		prompt := NewPromptType(80, 24)
+		next, cmd := prompt.Next()
+		fs := next.(*FileSelect)
+		run(fs, cmd)
+		_, cmd = fs.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		run(fs, cmd)
+		for range 30 {
+			fs.Update(tea.KeyMsg{Type: tea.KeyDown})
+		}
+		_, cmd = fs.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(" ")})
+		run(fs, cmd)
+		return fs
+	}
+
+	t.Run("the file step is restored after going forward and back", func(t *testing.T) {
+		fs := browse(t)
+		selected := fs.Selected[0]
+		offset := fs.Viewport.YOffset
+		require.Positive(t, offset)
+
+		next, _ := fs.Next()
+		next, _ = next.(*TemplateSelect).Next()
+		prev, _ := next.(*Edit).Prev()
+		prev, cmd := prev.(*TemplateSelect).Prev()
+		back := prev.(*FileSelect)
+		run(back, cmd)
+
+		assert.NotSame(t, fs, back)
+		assert.Same(t, fs.session, back.session)
+		assert.Same(t, fs.root, back.root)
+		assert.Len(t, back.FlatFiles, 31, "the folder stays open")
+		require.Len(t, back.Selected, 1)
+		assert.Same(t, selected, back.Selected[0])
+		assert.Equal(t, "f29.go", back.FlatFiles[back.Cursor].Name)
+		assert.Equal(t, offset, back.Viewport.YOffset)
+		assert.Equal(t, 2, back.Tokens)
+
+		back.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(" ")})
+
+		assert.Empty(t, back.Selected, "space unselects the file instead of adding it again")
+		assert.False(t, selected.Selected)
+	})
+
+	t.Run("the file step is restored after going back to the first step", func(t *testing.T) {
+		fs := browse(t)
+
+		prev, _ := fs.Prev()
+		next, cmd := prev.(*PromptTypeModel).Next()
+		back := next.(*FileSelect)
+		run(back, cmd)
+
+		assert.Equal(t, fs.session.Selected, []string{filepath.Join("pkg", "f29.go")})
+		assert.Len(t, back.Selected, 1)
+		assert.Equal(t, "f29.go", back.FlatFiles[back.Cursor].Name)
+	})
+
+	t.Run("selected files in folders that are not loaded are kept by path", func(t *testing.T) {
+		t.Chdir(t.TempDir())
+		session := &Session{Selected: []string{filepath.Join("pkg", "a.go")}}
+
+		fs := newFileBrowser(session, 80, 24)
+
+		require.Len(t, fs.Selected, 1)
+		assert.Equal(t, filepath.Join("pkg", "a.go"), fs.Selected[0].Path)
+		assert.True(t, fs.Selected[0].Selected)
+	})
+}
@@ -1,7 +1,10 @@
 package components
 
 import (
+	"strings"
+
 	"github.com/charmbracelet/lipgloss"
+	"github.com/trknhr/chatgpt-dev-utils/internal/tokens"
 )
 
 // Shared styles used across components
@@ -19,6 +22,16 @@ var (
 			Foreground(lipgloss.Color("241")).
 			Padding(0, 0).
 			Margin(0, 0)
+
+	errorStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("203")).
+			Bold(true)
+
+	substitutionStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("114"))
+
+	warnStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("214"))
 )
 
 // RenderLayout renders a standard layout with title, content box, and help text
@@ -52,3 +65,28 @@ func RenderLayoutWithMessage(title, content, help, message string, width, height
 	}
 	return base
 }
+
+// RenderValidation renders a titled list of problems, or nothing if there are none
+func RenderValidation(title string, problems []string) string {
+	if len(problems) == 0 {
+		return ""
+	}
+	lines := []string{errorStyle.Render(title)}
+	for _, p := range problems {
+		lines = append(lines, "  "+strings.ReplaceAll(p, "\n", "\n    "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// RenderTokens shows a token count against the budget, flagged when it is
+// close to or over the limit
+func RenderTokens(b tokens.Budget, n int) string {
+	text := b.Describe(n)
+	switch b.Check(n) {
+	case tokens.Warn:
+		return warnStyle.Render("⚠ " + text)
+	case tokens.Over:
+		return errorStyle.Render("✗ " + text + " · over budget")
+	}
+	return text
+}
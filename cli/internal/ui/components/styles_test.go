@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/trknhr/chatgpt-dev-utils/internal/tokens"
 )
 
 func TestStyles(t *testing.T) {
@@ -62,6 +63,35 @@ func TestStyles(t *testing.T) {
 				assert.False(t, strings.HasSuffix(result, "\n\n"))
 			},
 		},
+		{
+			name: "RenderValidation lists problems under the title",
+			test: func(t *testing.T) {
+				result := RenderValidation("Template commands", []string{"$(git foo) exit 1\nfatal: bad", "$(ls) did not run"})
+
+				lines := strings.Split(result, "\n")
+				assert.Len(t, lines, 4)
+				assert.Contains(t, lines[0], "Template commands")
+				assert.Equal(t, "  $(git foo) exit 1", lines[1])
+				assert.Equal(t, "    fatal: bad", lines[2])
+				assert.Equal(t, "  $(ls) did not run", lines[3])
+			},
+		},
+		{
+			name: "RenderValidation renders nothing without problems",
+			test: func(t *testing.T) {
+				assert.Empty(t, RenderValidation("Template commands", nil))
+			},
+		},
+		{
+			name: "RenderTokens flags counts close to or over the budget",
+			test: func(t *testing.T) {
+				b := tokens.Budget{Model: tokens.Model{Name: "gpt-4"}, Limit: 100, WarnAt: 0.8}
+
+				assert.Equal(t, "10 / 100 tokens (gpt-4)", RenderTokens(b, 10))
+				assert.Contains(t, RenderTokens(b, 90), "⚠ 90 / 100 tokens (gpt-4)")
+				assert.Contains(t, RenderTokens(b, 101), "✗ 101 / 100 tokens (gpt-4) · over budget")
+			},
+		},
 		{
 			name: "Styles are properly initialized",
 			test: func(t *testing.T) {
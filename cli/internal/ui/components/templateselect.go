@@ -2,10 +2,12 @@ package components
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 
-	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/trknhr/chatgpt-dev-utils/internal/file"
+	"github.com/trknhr/chatgpt-dev-utils/internal/templates"
 )
 
 type TemplateSelect struct {
@@ -15,6 +17,11 @@ type TemplateSelect struct {
 	SelectedFiles []*file.FileNode // Only used for file prompts
 	Width         int
 	Height        int
+	// confirming is set while the user is asked to run the commands of a
+	// project template
+	confirming bool
+	// session is the state shared with the other steps
+	session *Session
 }
 
 func NewTemplateSelect(promptType string, templates []string, selectedFiles []*file.FileNode, width, height int) *TemplateSelect {
@@ -25,6 +32,7 @@ func NewTemplateSelect(promptType string, templates []string, selectedFiles []*f
 		SelectedFiles: selectedFiles,
 		Width:         width,
 		Height:        height,
+		session:       NewSession(),
 	}
 }
 
@@ -39,6 +47,18 @@ func (t *TemplateSelect) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		t.Height = msg.Height
 
 	case tea.KeyMsg:
+		if t.confirming {
+			switch msg.String() {
+			case "y":
+				t.confirming = false
+				tmpl, _ := templates.Default().Get(t.PromptType, t.Templates[t.Cursor])
+				t.session.Confirmed = append(t.session.Confirmed, tmpl.Source)
+				return t.Next()
+			case "n":
+				t.confirming = false
+			}
+			return t, nil
+		}
 		switch msg.String() {
 		case "up", "k":
 			if t.Cursor > 0 {
@@ -61,6 +81,10 @@ func (t *TemplateSelect) View() string {
 		title = "Step 3: Choose Prompt Template"
 	}
 
+	if t.confirming {
+		return t.confirmView(title)
+	}
+
 	content := ""
 	for i, template := range t.Templates {
 		cursor := " "
@@ -68,7 +92,16 @@ func (t *TemplateSelect) View() string {
 			cursor = ">"
 			template = selectedStyle.Render(template)
 		}
-		content += fmt.Sprintf("%s ◯ %s\n", cursor, template)
+		line := fmt.Sprintf("%s ◯ %s", cursor, template)
+		if tmpl, ok := templates.Default().Get(t.PromptType, t.Templates[i]); ok {
+			if tmpl.Description != "" {
+				line += helpStyle.Render(" — " + tmpl.Description)
+			}
+			if origin := templateOrigin(tmpl); origin != "" {
+				line += warnStyle.Render(" [" + origin + "]")
+			}
+		}
+		content += line + "\n"
 	}
 
 	return RenderLayout(
@@ -80,40 +113,73 @@ func (t *TemplateSelect) View() string {
 	)
 }
 
+// confirmView lists the commands of the selected project template before
+// they run
+func (t *TemplateSelect) confirmView(title string) string {
+	tmpl, _ := templates.Default().Get(t.PromptType, t.Templates[t.Cursor])
+	content := warnStyle.Render(fmt.Sprintf("%q comes from %s in this repository and runs:", tmpl.Name, tmpl.Source)) + "\n\n"
+	for _, command := range tmpl.Commands() {
+		content += "  $(" + command + ")\n"
+	}
+	content += "\nRun these commands?\n"
+
+	return RenderLayout(
+		title,
+		content,
+		"[y: Run] [n/Esc: Cancel]",
+		t.Width,
+		t.Height,
+	)
+}
+
+// templateOrigin says where a template comes from when it is not simply a
+// built-in or the user's own: templates from the repository run commands
+// chosen by whoever committed them
+func templateOrigin(tmpl templates.Template) string {
+	var parts []string
+	if tmpl.FromProject() {
+		parts = append(parts, "project")
+	}
+	switch tmpl.Overrides {
+	case "":
+	case "built-in":
+		parts = append(parts, "overrides built-in")
+	default:
+		parts = append(parts, "overrides "+tmpl.Overrides)
+	}
+	return strings.Join(parts, ", ")
+}
+
 func (t *TemplateSelect) Next() (Component, tea.Cmd) {
 	selectedTemplate := t.Templates[t.Cursor]
 
-	// Get the appropriate template content
-	var templateContent string
-	if t.PromptType == "git" {
-		gitTemplates := map[string]string{
-			"Code Review":    "Please review this diff and provide feedback:\n\n$(git diff --cached)\n\nFocus on:\n- Code quality\n- Security issues\n- Performance considerations",
-			"Commit Message": "Generate a concise commit message for the following staged changes:\n```\n$(git diff --cached)\n```\n\nFollow the format used in recent commits:\n```\n$(git log -n 3 --pretty=format:%s)\n```\n\nFormat: type(scope): description\n\nOnly return the commit message in plain text. Do not include explanations or comments.",
-			"Change Summary": "Summarize the changes in this commit:\n\n$(git log --oneline -1)\n$(git diff HEAD~1)",
-			"Custom...":      "$(git diff --cached)",
-		}
-		templateContent = gitTemplates[selectedTemplate]
-	} else {
-		fileTemplates := map[string]string{
-			"Code Review":   "Please review this code and provide feedback:\n\n$(files)\n\nFocus on:\n- Code quality\n- Best practices\n- Potential issues",
-			"Documentation": "Generate documentation for this code:\n\n$(files)\n\nInclude:\n- Function descriptions\n- Usage examples\n- Parameters and return values",
-			"Custom...":     "Please add your prompt with $(files)",
-		}
-		templateContent = fileTemplates[selectedTemplate]
+	// Commands from the repository only run once the user agrees
+	if tmpl, ok := templates.Default().Get(t.PromptType, selectedTemplate); ok && tmpl.NeedsConfirmation() && !slices.Contains(t.session.Confirmed, tmpl.Source) {
+		t.confirming = true
+		return nil, nil
 	}
 
+	// Get the appropriate template content
+	templateContent, _ := templates.Body(t.PromptType, selectedTemplate)
+
 	// Create edit component with WebSocket context placeholder
-	return NewEdit(t.PromptType, selectedTemplate, templateContent, t.SelectedFiles, t.Width, t.Height), nil
+	edit := NewEdit(t.PromptType, selectedTemplate, templateContent, t.SelectedFiles, t.Width, t.Height)
+	edit.session = t.session
+	return edit, edit.Init()
 }
 
 func (t *TemplateSelect) Prev() (Component, tea.Cmd) {
+	if t.confirming {
+		t.confirming = false
+		return nil, nil
+	}
 	if t.PromptType == "file" {
 		// Go back to file selection
-		root := file.BuildFileTree(".")
-		flat := file.FlattenFileTree(root)
-		vp := viewport.New(t.Width-4, t.Height-8)
-		return NewFileSelect(flat, t.SelectedFiles, vp, 0, t.Width, t.Height, ""), nil
+		fs := newFileBrowser(t.session, t.Width, t.Height)
+		return fs, fs.Init()
 	}
 	// Go back to prompt type selection
-	return NewPromptType(t.Width, t.Height), nil
+	prompt := NewPromptType(t.Width, t.Height)
+	prompt.session = t.session
+	return prompt, nil
 }
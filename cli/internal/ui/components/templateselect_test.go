@@ -1,11 +1,15 @@
 package components
 
 import (
+	"path/filepath"
 	"testing"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trknhr/chatgpt-dev-utils/internal/config"
 	"github.com/trknhr/chatgpt-dev-utils/internal/file"
+	"github.com/trknhr/chatgpt-dev-utils/internal/templates"
 )
 
 func TestTemplateSelect(t *testing.T) {
@@ -74,6 +78,7 @@ func TestTemplateSelect(t *testing.T) {
 
 				assert.Contains(t, view, "Step 2: Choose Prompt Template")
 				assert.Contains(t, view, "Code Review")
+				assert.Contains(t, view, "Review the staged diff")
 			},
 		},
 		{
@@ -86,6 +91,73 @@ func TestTemplateSelect(t *testing.T) {
 				assert.Contains(t, view, "Documentation")
 			},
 		},
+		{
+			name: "View marks project templates and overrides",
+			test: func(t *testing.T) {
+				r := templates.NewRegistry()
+				r.Add(templates.Template{Kind: "git", Name: "Code Review", Body: "$(git diff)", Source: filepath.Join(config.ProjectDir, "templates", "review.md")})
+				r.Add(templates.Template{Kind: "git", Name: "Mine", Body: "$(git status)", Source: "/home/me/.config/cdev/templates/mine.md"})
+				previous := templates.Default()
+				templates.SetDefault(r)
+				t.Cleanup(func() { templates.SetDefault(previous) })
+
+				ts := NewTemplateSelect("git", r.Names("git"), nil, 120, 24)
+				view := ts.View()
+
+				assert.Contains(t, view, "Code Review [project, overrides built-in]")
+				assert.NotContains(t, view, "Mine [")
+				assert.NotContains(t, view, "Commit Message [")
+			},
+		},
+		{
+			name: "Next asks before running the commands of a project template",
+			test: func(t *testing.T) {
+				r := templates.NewRegistry()
+				r.Add(templates.Template{Kind: "git", Name: "Team", Body: "$(git diff)\n$(git status)", Source: filepath.Join(config.ProjectDir, "templates", "team.md")})
+				previous := templates.Default()
+				templates.SetDefault(r)
+				t.Cleanup(func() { templates.SetDefault(previous) })
+				ts := NewTemplateSelect("git", []string{"Team"}, nil, 120, 24)
+
+				next, _ := ts.Next()
+				assert.Nil(t, next)
+				view := ts.View()
+				assert.Contains(t, view, "$(git diff)")
+				assert.Contains(t, view, "$(git status)")
+				assert.Contains(t, view, "Run these commands?")
+
+				// n cancels, and the next Tab asks again
+				ts.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("n")})
+				assert.NotContains(t, ts.View(), "Run these commands?")
+				next, _ = ts.Next()
+				assert.Nil(t, next)
+
+				// y moves on and is remembered for the session
+				model, _ := ts.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+				edit, ok := model.(*Edit)
+				require.True(t, ok)
+				assert.Equal(t, "Team", edit.SelectedTemplate)
+				next, _ = ts.Next()
+				assert.IsType(t, &Edit{}, next)
+			},
+		},
+		{
+			name: "Prev cancels the confirmation",
+			test: func(t *testing.T) {
+				r := templates.NewRegistry()
+				r.Add(templates.Template{Kind: "git", Name: "Team", Body: "$(git diff)", Source: filepath.Join(config.ProjectDir, "templates", "team.md")})
+				previous := templates.Default()
+				templates.SetDefault(r)
+				t.Cleanup(func() { templates.SetDefault(previous) })
+				ts := NewTemplateSelect("git", []string{"Team"}, nil, 120, 24)
+				ts.Next()
+
+				prev, _ := ts.Prev()
+
+				assert.Nil(t, prev)
+				assert.NotContains(t, ts.View(), "Run these commands?")
+			},
+		},
 		{
 			name: "Next returns Edit component for git",
 			test: func(t *testing.T) {
@@ -1,69 +1,312 @@
 package utils
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os/exec"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/mattn/go-shellwords"
+	"github.com/trknhr/chatgpt-dev-utils/internal/templates"
 )
 
-// ExecuteCommand runs a shell command and returns its output or error
-func executeGitCommand(command string) string {
+// CommandTimeout bounds the run time of a single template command
+var CommandTimeout = 30 * time.Second
+
+// maxParallelCommands limits how many template commands run at once
+const maxParallelCommands = 8
+
+// ErrNotAllowed is reported for template commands other than git
+var ErrNotAllowed = errors.New("only 'git' commands are allowed")
+
+// ErrSubcommandNotAllowed is reported for git subcommands that are not on
+// the read-only allowlist
+var ErrSubcommandNotAllowed = errors.New("git subcommand not allowed in templates")
+
+// ErrOptionNotAllowed is reported for git options that run other programs,
+// write files or change the configuration git runs with. Templates can come
+// from the repository, so these are refused.
+var ErrOptionNotAllowed = errors.New("git option not allowed in templates")
+
+// subcommands are the read-only git subcommands templates may run. Built-in
+// subcommands take precedence over aliases, so none of these can be
+// redefined by a repository.
+var subcommands = []string{"diff", "log", "show", "status", "rev-parse", "ls-files", "blame"}
+
+// options are refused after the subcommand. Git accepts unambiguous
+// abbreviations of long options, so any prefix of these is refused too.
+var options = []string{"--output", "--ext-diff", "--open-files-in-pager", "--paginate", "--exec", "--extcmd", "--upload-pack", "--receive-pack"}
+
+// checkCommand returns an error if a git command line runs anything but an
+// allowed subcommand. Options before the subcommand, such as -c, -C or
+// --exec-path, are all git's own and are refused.
+func checkCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: none given", ErrSubcommandNotAllowed)
+	}
+	if strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("%w: %s", ErrOptionNotAllowed, args[0])
+	}
+	if !slices.Contains(subcommands, args[0]) {
+		return fmt.Errorf("%w: %s", ErrSubcommandNotAllowed, args[0])
+	}
+	for _, arg := range args[1:] {
+		if arg == "--" {
+			break
+		}
+		name, _, _ := strings.Cut(arg, "=")
+		if len(name) <= 2 || !strings.HasPrefix(name, "--") {
+			continue
+		}
+		for _, option := range options {
+			if strings.HasPrefix(option, name) {
+				return fmt.Errorf("%w: %s", ErrOptionNotAllowed, arg)
+			}
+		}
+	}
+	return nil
+}
+
+// CommandError describes a template command that failed
+type CommandError struct {
+	Command  string
+	ExitCode int // -1 if the command did not run to completion
+	Stderr   string
+	Err      error
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("$(%s): %s", e.Command, e.Summary())
+}
+
+func (e *CommandError) Unwrap() error { return e.Err }
+
+// hints explains common git failures in plain words
+var hints = []struct{ match, hint string }{
+	{"not a git repository", "not a git repository; run cdev inside a repository"},
+	{"does not have any commits yet", "the repository has no commits yet"},
+	{"ambiguous argument 'HEAD", "the repository has no commits yet"},
+	{"executable file not found", "git is not installed or not on PATH"},
+}
+
+// Summary is a one line description of the failure
+func (e *CommandError) Summary() string {
+	msg := e.Err.Error()
+	if e.Stderr != "" {
+		msg = e.Stderr
+	}
+	for _, h := range hints {
+		if strings.Contains(msg, h.match) {
+			return h.hint
+		}
+	}
+	line, _, _ := strings.Cut(msg, "\n")
+	return strings.TrimPrefix(strings.TrimSpace(line), "fatal: ")
+}
+
+// Placeholder is inserted in the prompt in place of the command output
+func (e *CommandError) Placeholder() string {
+	return "[git error: " + e.Summary() + "]"
+}
+
+// CommandErrors is the failed commands of a prompt, in template order
+type CommandErrors []*CommandError
+
+func (errs CommandErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Rendered is a prompt with its template commands expanded
+type Rendered struct {
+	Prompt string
+	Spans  []Span        // substituted parts of Prompt, in order
+	Errors CommandErrors // failed commands, whatever the policy
+	Files  []FileNote    // selected files not in the prompt in full
+}
+
+// FileNote says why a selected file is not in the prompt in full
+type FileNote struct {
+	Path string
+	Note string
+}
+
+// Span is the byte range of Prompt that a substitution expanded to
+type Span struct {
+	Start, End int
+	Failed     bool // the range is an error placeholder
+}
+
+// executeGitCommand runs a git command and returns its output
+func executeGitCommand(ctx context.Context, command string) (string, *CommandError) {
 	parser := shellwords.NewParser()
 	fields, err := parser.Parse(command)
 	if err != nil || len(fields) == 0 || fields[0] != "git" {
-		return "[only 'git' commands are allowed]"
+		return "", &CommandError{Command: command, ExitCode: -1, Err: ErrNotAllowed}
+	}
+	if err := checkCommand(fields[1:]); err != nil {
+		return "", &CommandError{Command: command, ExitCode: -1, Err: err}
 	}
 
-	cmd := exec.Command(fields[0], fields[1:]...)
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, fields[0], fields[1:]...)
 	out, err := cmd.Output()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", &CommandError{Command: command, ExitCode: -1, Err: fmt.Errorf("timed out after %s", CommandTimeout)}
+	}
 	if err != nil {
-		return "[error executing git command]"
+		cmdErr := &CommandError{Command: command, ExitCode: -1, Err: err}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			cmdErr.ExitCode = exitErr.ExitCode()
+			cmdErr.Stderr = strings.TrimSpace(string(exitErr.Stderr))
+		}
+		return "", cmdErr
 	}
 
-	return strings.TrimSpace(string(out))
+	return strings.TrimSpace(string(out)), nil
 }
 
-// ExecuteGitCommands replaces $(git ...) in the prompt with the output of the git command
+// ExecuteGitCommands replaces $(git ...) in the prompt with the output of the
+// git command. Substituted output is never expanded again; a malformed
+// substitution is left as written and a failed command is replaced by a
+// "[git error: ...]" placeholder.
 func ExecuteGitCommands(prompt string) string {
-	// lines := strings.Split(prompt, "\n")
-	// for i, line := range lines {
-	// 	if strings.Contains(line, "$(git ") {
-	// 		start := strings.Index(line, "$(git ")
-	// 		end := strings.Index(line[start:], ")")
-	// 		if end != -1 {
-	// 			end += start
-	// 			command := line[start+2 : end] // Remove $( and )
-	// 			output := ExecuteCommand(command)
-	// 			// Handle common git errors
-	// 			if strings.Contains(output, "not a git repository") ||
-	// 				strings.Contains(output, "does not have any commits yet") ||
-	// 				strings.Contains(output, "fatal:") {
-	// 				output = "[git error: " + output + "]"
-	// 			}
-	// 			lines[i] = strings.Replace(line, line[start:end+1], output, 1)
-	// 		}
-	// 	}
-	// }
-	// return strings.Join(lines, "\n")
-	lines := strings.Split(prompt, "\n")
-	for i, line := range lines {
-		for {
-			start := strings.Index(line, "$(")
-			if start == -1 {
-				break
+	r, _ := ExecuteGitCommandsContext(context.Background(), prompt, templates.PolicyPlaceholder, nil)
+	return r.Prompt
+}
+
+// ExecuteGitCommandsContext is ExecuteGitCommands with the commands run
+// concurrently, each bounded by CommandTimeout, and failed commands handled
+// by policy. Under PolicyFail the failures are also returned as
+// CommandErrors. progress, if not nil, is called from the command goroutines
+// as commands finish. When ctx is cancelled the running commands are killed
+// and ctx.Err() is returned.
+func ExecuteGitCommandsContext(ctx context.Context, prompt string, policy templates.Policy, progress func(done, total int)) (Rendered, error) {
+	nodes, _ := templates.Parse(prompt)
+	subs := templates.Substitutions(nodes)
+	outputs := make(map[templates.Pos]string, len(subs))
+	failed := make(map[templates.Pos]*CommandError)
+	if progress != nil {
+		progress(0, len(subs))
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		done int
+	)
+	sem := make(chan struct{}, maxParallelCommands)
+	for _, s := range subs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+			out, err := executeGitCommand(ctx, s.Command)
+
+			mu.Lock()
+			defer mu.Unlock()
+			outputs[s.Pos] = out
+			if err != nil {
+				failed[s.Pos] = err
 			}
-			end := strings.Index(line[start:], ")")
-			if end == -1 {
-				break
+			done++
+			if progress != nil {
+				progress(done, len(subs))
 			}
-			end += start
-			command := line[start+2 : end]
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return Rendered{}, err
+	}
 
-			output := executeGitCommand(command)
-			line = strings.Replace(line, line[start:end+1], output, 1)
+	var r Rendered
+	for _, s := range subs {
+		if err, ok := failed[s.Pos]; ok {
+			r.Errors = append(r.Errors, err)
+		}
+	}
+	r.Prompt, r.Spans = expand(nodes, outputs, failed, policy)
+	if policy == templates.PolicyFail && len(r.Errors) > 0 {
+		return r, r.Errors
+	}
+	return r, nil
+}
+
+// expand writes out the prompt. Under PolicyOmit failed substitutions are
+// left out, together with their line if nothing else is on it.
+func expand(nodes []templates.Node, outputs map[templates.Pos]string, failed map[templates.Pos]*CommandError, policy templates.Policy) (string, []Span) {
+	var (
+		sb    strings.Builder
+		spans []Span
+		// held is the indentation of a line whose only content so far was
+		// omitted; it is written back if anything else follows on the line
+		held    string
+		holding bool
+	)
+	release := func() {
+		if holding {
+			sb.WriteString(held)
+			held, holding = "", false
+		}
+	}
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case templates.Text:
+			v := n.Value
+			if holding {
+				rest := strings.TrimLeft(v, " \t")
+				if rest == "" {
+					continue
+				}
+				if rest[0] == '\n' {
+					v = rest[1:]
+					held, holding = "", false
+				} else {
+					release()
+				}
+			}
+			sb.WriteString(v)
+		case templates.Substitution:
+			err, ok := failed[n.Pos]
+			switch {
+			case !ok:
+				release()
+				start := sb.Len()
+				sb.WriteString(outputs[n.Pos])
+				spans = append(spans, Span{Start: start, End: sb.Len()})
+			case policy == templates.PolicyOmit:
+				if holding {
+					continue
+				}
+				s := sb.String()
+				start := strings.LastIndex(s, "\n") + 1
+				if strings.TrimSpace(s[start:]) == "" {
+					sb.Reset()
+					sb.WriteString(s[:start])
+					held, holding = s[start:], true
+				}
+			default:
+				release()
+				start := sb.Len()
+				sb.WriteString(err.Placeholder())
+				spans = append(spans, Span{Start: start, End: sb.Len(), Failed: true})
+			}
 		}
-		lines[i] = line
 	}
-	return strings.Join(lines, "\n")
+	return sb.String(), spans
 }
@@ -1,11 +1,16 @@
 package utils
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trknhr/chatgpt-dev-utils/internal/templates"
 )
 
 func TestExecuteGitCommands(t *testing.T) {
@@ -29,7 +34,7 @@ func TestExecuteGitCommands(t *testing.T) {
 			prompt: `Commit info: $(git log -n 1 --pretty=format:"%h %s")`,
 			validate: func(t *testing.T, output string) {
 				assert.False(t,
-					strings.Contains(output, "[error executing git command]"),
+					strings.Contains(output, "[git error:"),
 					"unexpected git error: '%s'", output,
 				)
 				assert.True(t,
@@ -43,11 +48,39 @@ func TestExecuteGitCommands(t *testing.T) {
 				fmt.Println("Pretty output:", output)
 			},
 		},
+		{
+			name:   "output is not expanded again",
+			prompt: `$(git rev-parse --sq-quote "$(git --version)")`,
+			validate: func(t *testing.T, output string) {
+				assert.Equal(t, `'$(git --version)'`, output)
+			},
+		},
+		{
+			name:   "escaped substitution is kept",
+			prompt: `Run \$(git status) yourself`,
+			validate: func(t *testing.T, output string) {
+				assert.Equal(t, "Run $(git status) yourself", output)
+			},
+		},
+		{
+			name:   "substitution spanning lines",
+			prompt: "$(git rev-parse\n  --sq-quote multi)",
+			validate: func(t *testing.T, output string) {
+				assert.Equal(t, "'multi'", output)
+			},
+		},
+		{
+			name:   "unterminated substitution is left as written",
+			prompt: "Diff: $(git diff",
+			validate: func(t *testing.T, output string) {
+				assert.Equal(t, "Diff: $(git diff", output)
+			},
+		},
 		{
 			name:   "git command error",
-			prompt: "$(git not-a-real-command)",
+			prompt: "$(git rev-parse --verify not-a-real-ref)",
 			validate: func(t *testing.T, output string) {
-				assert.Contains(t, output, "[error executing git command]", "expected git error")
+				assert.Contains(t, output, "[git error: Needed a single revision", "expected git error")
 				fmt.Println(output)
 			},
 		},
@@ -60,3 +93,171 @@ func TestExecuteGitCommands(t *testing.T) {
 		})
 	}
 }
+
+func TestExecuteGitCommandsContext(t *testing.T) {
+	t.Run("reports progress for every command", func(t *testing.T) {
+		var calls [][2]int
+		r, err := ExecuteGitCommandsContext(context.Background(), "$(git rev-parse --sq-quote a) $(git rev-parse --sq-quote b)", templates.PolicyPlaceholder, func(done, total int) {
+			calls = append(calls, [2]int{done, total})
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, "'a' 'b'", r.Prompt)
+		assert.Equal(t, [][2]int{{0, 2}, {1, 2}, {2, 2}}, calls)
+	})
+
+	t.Run("spans mark the substituted output", func(t *testing.T) {
+		r, err := ExecuteGitCommandsContext(context.Background(), "a $(git rev-parse --sq-quote b) c $(ls)", templates.PolicyPlaceholder, nil)
+
+		require.NoError(t, err)
+		require.Len(t, r.Spans, 2)
+		assert.Equal(t, "'b'", r.Prompt[r.Spans[0].Start:r.Spans[0].End])
+		assert.False(t, r.Spans[0].Failed)
+		assert.Equal(t, "[git error: only 'git' commands are allowed]", r.Prompt[r.Spans[1].Start:r.Spans[1].End])
+		assert.True(t, r.Spans[1].Failed)
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := ExecuteGitCommandsContext(ctx, "$(git rev-parse --sq-quote x)", templates.PolicyPlaceholder, nil)
+
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("commands are bounded by CommandTimeout", func(t *testing.T) {
+		previous := CommandTimeout
+		CommandTimeout = time.Nanosecond
+		t.Cleanup(func() { CommandTimeout = previous })
+
+		r, err := ExecuteGitCommandsContext(context.Background(), "$(git rev-parse --sq-quote x)", templates.PolicyPlaceholder, nil)
+
+		require.NoError(t, err)
+		assert.Equal(t, "[git error: timed out after 1ns]", r.Prompt)
+		require.Len(t, r.Errors, 1)
+		assert.Equal(t, -1, r.Errors[0].ExitCode)
+	})
+
+	t.Run("failed commands are reported with exit code and stderr", func(t *testing.T) {
+		r, err := ExecuteGitCommandsContext(context.Background(), "$(git rev-parse --sq-quote ok) $(git rev-parse --verify not-a-real-ref) $(ls)", templates.PolicyPlaceholder, nil)
+
+		require.NoError(t, err)
+		require.Len(t, r.Errors, 2)
+		assert.Equal(t, "git rev-parse --verify not-a-real-ref", r.Errors[0].Command)
+		assert.Equal(t, 128, r.Errors[0].ExitCode)
+		assert.Contains(t, r.Errors[0].Stderr, "Needed a single revision")
+		assert.Equal(t, "ls", r.Errors[1].Command)
+		assert.ErrorIs(t, r.Errors[1], ErrNotAllowed)
+		assert.Equal(t, "'ok' "+r.Errors[0].Placeholder()+" [git error: only 'git' commands are allowed]", r.Prompt)
+	})
+
+	t.Run("fail policy returns the errors", func(t *testing.T) {
+		_, err := ExecuteGitCommandsContext(context.Background(), "Diff:\n$(ls)", templates.PolicyFail, nil)
+
+		var errs CommandErrors
+		require.ErrorAs(t, err, &errs)
+		assert.Equal(t, "$(ls): only 'git' commands are allowed", errs.Error())
+	})
+
+	t.Run("omit policy drops the section", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			prompt string
+			want   string
+		}{
+			{name: "own line", prompt: "Diff:\n  $(ls)\nEnd", want: "Diff:\nEnd"},
+			{name: "inline", prompt: "Diff: $(ls) end", want: "Diff:  end"},
+			{name: "indented with text after", prompt: "a\n  $(ls) b", want: "a\n   b"},
+			{name: "last line", prompt: "a\n$(ls)", want: "a\n"},
+			{name: "kept output", prompt: "$(ls)\n$(git rev-parse --sq-quote x)", want: "'x'"},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				r, err := ExecuteGitCommandsContext(context.Background(), tc.prompt, templates.PolicyOmit, nil)
+
+				require.NoError(t, err)
+				assert.Equal(t, tc.want, r.Prompt)
+				assert.Len(t, r.Errors, 1)
+			})
+		}
+	})
+}
+
+func TestCheckCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    error
+	}{
+		{name: "plain command", command: "git diff --cached", want: nil},
+		{name: "log options", command: "git log -n 3 --pretty=format:%s --output-indicator-new=+", want: nil},
+		{name: "diff --text", command: "git diff --text HEAD~1", want: nil},
+		{name: "-c of a subcommand", command: "git log -c -1", want: nil},
+		{name: "no subcommand", command: "git", want: ErrSubcommandNotAllowed},
+		{name: "config before the subcommand", command: "git -c core.pager=sh diff", want: ErrOptionNotAllowed},
+		{name: "other directory", command: "git -C /tmp status", want: ErrOptionNotAllowed},
+		{name: "exec path", command: "git --exec-path=/tmp log", want: ErrOptionNotAllowed},
+		{name: "grep pager", command: "git grep --open-files-in-pager=touch foo", want: ErrSubcommandNotAllowed},
+		{name: "config", command: "git config alias.x !touch", want: ErrSubcommandNotAllowed},
+		{name: "alias", command: "git x", want: ErrSubcommandNotAllowed},
+		{name: "difftool", command: "git difftool -x touch", want: ErrSubcommandNotAllowed},
+		{name: "rebase exec", command: "git rebase -x touch HEAD~1", want: ErrSubcommandNotAllowed},
+		{name: "bisect run", command: "git bisect run touch", want: ErrSubcommandNotAllowed},
+		{name: "submodule foreach", command: "git submodule foreach touch", want: ErrSubcommandNotAllowed},
+		{name: "output file", command: "git diff --output=/tmp/x", want: ErrOptionNotAllowed},
+		{name: "abbreviated output", command: "git log --outp=/tmp/x", want: ErrOptionNotAllowed},
+		{name: "external diff", command: "git show --ext-diff", want: ErrOptionNotAllowed},
+		{name: "paths after --", command: "git log -- --output", want: nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkCommand(strings.Fields(tc.command)[1:])
+			if tc.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tc.want)
+		})
+	}
+
+	r, err := ExecuteGitCommandsContext(context.Background(), "$(git -c core.pager=touch log)", templates.PolicyPlaceholder, nil)
+	require.NoError(t, err)
+	require.Len(t, r.Errors, 1)
+	assert.ErrorIs(t, r.Errors[0], ErrOptionNotAllowed)
+	assert.Equal(t, "[git error: git option not allowed in templates: -c]", r.Prompt)
+}
+
+func TestCommandErrorSummary(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *CommandError
+		want string
+	}{
+		{
+			name: "outside a repository",
+			err:  &CommandError{Stderr: "fatal: not a git repository (or any of the parent directories): .git", Err: errors.New("exit status 128")},
+			want: "not a git repository; run cdev inside a repository",
+		},
+		{
+			name: "no commits",
+			err:  &CommandError{Stderr: "fatal: your current branch 'main' does not have any commits yet", Err: errors.New("exit status 128")},
+			want: "the repository has no commits yet",
+		},
+		{
+			name: "first stderr line",
+			err:  &CommandError{Stderr: "fatal: bad revision 'nope'\nmore", Err: errors.New("exit status 128")},
+			want: "bad revision 'nope'",
+		},
+		{
+			name: "no stderr",
+			err:  &CommandError{Err: errors.New("signal: killed")},
+			want: "signal: killed",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.err.Summary())
+		})
+	}
+}
@@ -1,28 +1,94 @@
 package utils
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"strings"
 
+	"github.com/trknhr/chatgpt-dev-utils/internal/content"
 	"github.com/trknhr/chatgpt-dev-utils/internal/file"
+	"github.com/trknhr/chatgpt-dev-utils/internal/templates"
 )
 
-// GenerateFilePrompt replaces $(files) in the template with the contents of selected files
+// GenerateFilePrompt replaces $(files) in the template with the contents of selected files.
+// Binary files are left out and large files cut, as read by content.Current.
 func GenerateFilePrompt(text string, selectedFiles []*file.FileNode) string {
+	return renderFilePrompt(text, selectedFiles).Prompt
+}
+
+// renderFilePrompt is GenerateFilePrompt with the inserted contents marked
+func renderFilePrompt(text string, selectedFiles []*file.FileNode) Rendered {
 	if text == "" {
 		text = "Please analyze these files:\n\n$(files)"
 	}
 
-	fileContents := ""
-	for _, file := range selectedFiles {
-		content, err := os.ReadFile(file.Path)
+	var (
+		fileContents string
+		notes        []FileNote
+	)
+	reader := content.Current()
+	for _, node := range selectedFiles {
+		read := reader.Read
+		if len(node.Ranges) > 0 {
+			// The excerpts are taken from the whole file
+			read = reader.ReadAll
+		}
+		f, err := read(node.Path)
 		if err != nil {
-			fileContents += fmt.Sprintf("// Error reading %s: %v\n\n", file.Path, err)
+			fileContents += fmt.Sprintf("// Error reading %s: %v\n\n", node.Path, err)
+			notes = append(notes, FileNote{Path: node.Path, Note: "skipped: " + err.Error()})
 			continue
 		}
-		fileContents += fmt.Sprintf("// File: %s\n%s\n\n", file.Path, string(content))
+		if note := f.Note(); note != "" {
+			notes = append(notes, FileNote{Path: node.Path, Note: note})
+		}
+		switch {
+		case f.Binary:
+			fileContents += fmt.Sprintf("// File: %s (%s)\n\n", node.Path, f.Note())
+		case f.Truncated:
+			fileContents += fmt.Sprintf("// File: %s (%s)\n%s\n\n", node.Path, f.Note(), f.Text)
+		case len(node.Ranges) == 0:
+			fileContents += fmt.Sprintf("// File: %s\n%s\n\n", node.Path, f.Text)
+		default:
+			// Only the excerpts, each under its own header
+			for _, r := range node.Ranges {
+				fileContents += fmt.Sprintf("// File: %s (%s)\n%s\n\n", node.Path, r, file.Excerpt(f.Text, r))
+			}
+		}
 	}
 
-	return strings.ReplaceAll(text, "$(files)", fileContents)
+	var (
+		r  Rendered
+		sb strings.Builder
+	)
+	for i, part := range strings.Split(text, "$(files)") {
+		if i > 0 {
+			start := sb.Len()
+			sb.WriteString(fileContents)
+			r.Spans = append(r.Spans, Span{Start: start, End: sb.Len()})
+		}
+		sb.WriteString(part)
+	}
+	r.Prompt = sb.String()
+	r.Files = notes
+	return r
+}
+
+// BuildPrompt expands a prompt template for the given prompt type ("file" or "git")
+func BuildPrompt(promptType, text string, selectedFiles []*file.FileNode) string {
+	if promptType == "file" {
+		// Generate file prompt with actual content
+		return GenerateFilePrompt(text, selectedFiles)
+	}
+	// Execute git commands
+	return ExecuteGitCommands(text)
+}
+
+// BuildPromptContext is BuildPrompt with cancellation, progress reporting
+// and an error policy for the template commands of git prompts
+func BuildPromptContext(ctx context.Context, promptType, text string, selectedFiles []*file.FileNode, policy templates.Policy, progress func(done, total int)) (Rendered, error) {
+	if promptType == "file" {
+		return renderFilePrompt(text, selectedFiles), ctx.Err()
+	}
+	return ExecuteGitCommandsContext(ctx, text, policy, progress)
 }
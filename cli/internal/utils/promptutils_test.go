@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trknhr/chatgpt-dev-utils/internal/config"
+	"github.com/trknhr/chatgpt-dev-utils/internal/content"
+	"github.com/trknhr/chatgpt-dev-utils/internal/file"
+	"github.com/trknhr/chatgpt-dev-utils/internal/templates"
+)
+
+func TestBuildPromptContext(t *testing.T) {
+	t.Run("file contents are marked as substituted", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "a.go")
+		require.NoError(t, os.WriteFile(path, []byte("package a"), 0644))
+		files := []*file.FileNode{{Path: path}}
+
+		r, err := BuildPromptContext(context.Background(), "file", "Review:\n$(files)End", files, templates.PolicyPlaceholder, nil)
+
+		require.NoError(t, err)
+		want := "// File: " + path + "\npackage a\n\n"
+		assert.Equal(t, "Review:\n"+want+"End", r.Prompt)
+		require.Len(t, r.Spans, 1)
+		assert.Equal(t, want, r.Prompt[r.Spans[0].Start:r.Spans[0].End])
+	})
+
+	t.Run("files selected in part show only the excerpts", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "a.go")
+		require.NoError(t, os.WriteFile(path, []byte("package a\n\nfunc Foo() {\n}\n\nvar x = 1\n"), 0644))
+		files := []*file.FileNode{{Path: path, Ranges: []file.Range{{From: 3, To: 4, Label: "func Foo"}, {From: 6, To: 6}}}}
+
+		r, err := BuildPromptContext(context.Background(), "file", "$(files)", files, templates.PolicyPlaceholder, nil)
+
+		require.NoError(t, err)
+		assert.Equal(t, "// File: "+path+" (lines 3-4, func Foo)\nfunc Foo() {\n}\n\n\n"+
+			"// File: "+path+" (line 6)\nvar x = 1\n\n\n", r.Prompt)
+	})
+
+	t.Run("binary and large files are noted", func(t *testing.T) {
+		reader, err := content.New(config.Files{MaxBytes: 64})
+		require.NoError(t, err)
+		previous := content.Current()
+		content.Configure(reader)
+		t.Cleanup(func() { content.Configure(previous) })
+		dir := t.TempDir()
+		png := filepath.Join(dir, "logo.png")
+		require.NoError(t, os.WriteFile(png, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0644))
+		big := filepath.Join(dir, "big.txt")
+		require.NoError(t, os.WriteFile(big, []byte(strings.Repeat("0123456789\n", 20)), 0644))
+		files := []*file.FileNode{{Path: png}, {Path: big}}
+
+		r, err := BuildPromptContext(context.Background(), "file", "$(files)", files, templates.PolicyPlaceholder, nil)
+
+		require.NoError(t, err)
+		assert.Equal(t, "// File: "+png+" (skipped: binary file, 16 B)\n\n"+
+			"// File: "+big+" (truncated: first and last lines of 220 B)\n"+
+			"0123456789\n0123456789\n// ... 176 B truncated ...\n0123456789\n0123456789\n\n\n", r.Prompt)
+		assert.Equal(t, []FileNote{
+			{Path: png, Note: "skipped: binary file, 16 B"},
+			{Path: big, Note: "truncated: first and last lines of 220 B"},
+		}, r.Files)
+	})
+
+	t.Run("git prompts run the template commands", func(t *testing.T) {
+		r, err := BuildPromptContext(context.Background(), "git", "$(git rev-parse --sq-quote x)", nil, templates.PolicyPlaceholder, nil)
+
+		require.NoError(t, err)
+		assert.Equal(t, "'x'", r.Prompt)
+	})
+}
@@ -1,31 +1,96 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
-	"net/http"
+	"net"
 	"os"
+	"path/filepath"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/gorilla/websocket"
+	"github.com/trknhr/chatgpt-dev-utils/internal/config"
+	"github.com/trknhr/chatgpt-dev-utils/internal/content"
+	"github.com/trknhr/chatgpt-dev-utils/internal/hub"
+	"github.com/trknhr/chatgpt-dev-utils/internal/pairing"
+	"github.com/trknhr/chatgpt-dev-utils/internal/redact"
+	"github.com/trknhr/chatgpt-dev-utils/internal/server"
+	"github.com/trknhr/chatgpt-dev-utils/internal/sink"
+	"github.com/trknhr/chatgpt-dev-utils/internal/templates"
+	"github.com/trknhr/chatgpt-dev-utils/internal/tokens"
 	"github.com/trknhr/chatgpt-dev-utils/internal/ui"
-)
-
-// WebSocket related variables
-var (
-	upgrader  = websocket.Upgrader{}
-	clients   = make(map[*websocket.Conn]bool)
-	broadcast = make(chan string)
+	"github.com/trknhr/chatgpt-dev-utils/internal/ui/components"
 )
 
 func main() {
-	// Always start WebSocket server
-	go startWebSocketServer()
+	// Load user and project templates on top of the built-ins
+	registry, err := templates.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	templates.SetDefault(registry)
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	budget, err := tokens.NewBudget(cfg.Budget)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	tokens.Configure(budget)
+	redactor, err := redact.New(cfg.Redact)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	redact.Configure(redactor)
+	reader, err := content.New(cfg.Files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	content.Configure(reader)
+
+	// Non-interactive subcommands for scripts and git hooks
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		os.Exit(runCommand(cfg, args[0], args[1:], os.Stdout, os.Stderr))
+	}
+
+	fs := flag.NewFlagSet("cdev", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	addServerFlags(fs, &cfg)
+	if err := fs.Parse(args); err != nil {
+		os.Exit(exitError)
+	}
+
+	store, err := pairing.Open(config.TokenPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cdev: pairing token: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	// The alternate screen hides log output, so keep it in a file
+	if logFile, err := openLogFile(); err == nil {
+		defer logFile.Close()
+		log.SetOutput(logFile)
+	}
+
+	// Start the WebSocket server, or share the one another cdev already runs
+	extension, err := connectExtension(cfg, store)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cdev: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	// The stdout sink prints once the TUI has left the alternate screen
+	var output bytes.Buffer
+	sink.Configure(cfg.Sinks, &output)
 
 	// Create model with WebSocket integration
-	model := ui.InitialModel(broadcast, func() int {
-		return len(clients)
-	})
+	model := ui.InitialModel(extension, store.Token())
 
 	p := tea.NewProgram(
 		model,
@@ -36,65 +101,56 @@ func main() {
 		fmt.Printf("Error: %v", err)
 		os.Exit(1)
 	}
+	os.Stdout.Write(output.Bytes())
 }
 
-func startWebSocketServer() {
-	http.HandleFunc("/ws", handleConnections)
-
-	// Simple HTTP health check
-	http.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("pong"))
-	})
-
-	go handleMessages()
+// addServerFlags registers --addr and --port, defaulting to the loaded config
+func addServerFlags(fs *flag.FlagSet, cfg *config.Config) {
+	fs.StringVar(&cfg.Addr, "addr", cfg.Addr, "address the WebSocket server listens on")
+	fs.IntVar(&cfg.Port, "port", cfg.Port, "port the WebSocket server listens on")
+}
 
-	go func() {
-		err := http.ListenAndServe(":32123", nil)
-		if err != nil {
-			log.Printf("WebSocket server error: %v", err)
-		}
-	}()
+// openLogFile opens cdev.log in the user configuration directory
+func openLogFile() (*os.File, error) {
+	if err := os.MkdirAll(config.Dir(), 0700); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(filepath.Join(config.Dir(), "cdev.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
 }
 
-func handleConnections(w http.ResponseWriter, r *http.Request) {
-	upgrader.CheckOrigin = func(r *http.Request) bool { return true }
-	ws, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Println("Upgrade failed:", err)
-		return
+// connectExtension starts the WebSocket server on the configured address. If
+// another cdev instance already serves it, prompts are relayed through that
+// instance instead.
+func connectExtension(cfg config.Config, store *pairing.Store) (components.Extension, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
-	defer ws.Close()
-	clients[ws] = true
 
-	for {
-		_, _, err := ws.ReadMessage()
-		if err != nil {
-			delete(clients, ws)
-			break
-		}
+	guard := pairing.Guard{Store: store, AllowedOrigins: cfg.ExtensionOrigins()}
+	srv, err := server.Listen(cfg.ListenAddr(), guard)
+	if err == nil {
+		return srv.Hub(), nil
+	}
+	if !errors.Is(err, server.ErrAddrInUse) {
+		return nil, err
+	}
+
+	addr := dialAddr(cfg)
+	if !server.Probe(addr) {
+		return nil, fmt.Errorf("%s is already in use by another program", cfg.ListenAddr())
+	}
+	remote, err := hub.Dial(addr, store.Token())
+	if err != nil {
+		return nil, fmt.Errorf("cdev is already running on %s but relaying failed: %w", addr, err)
 	}
+	return remote, nil
 }
 
-func handleMessages() {
-	for {
-		msg := <-broadcast
-		for client := range clients {
-			err := client.WriteMessage(websocket.TextMessage, []byte(msg))
-			if err != nil {
-				log.Println("Write error:", err)
-				client.Close()
-				delete(clients, client)
-			}
-		}
+// dialAddr is the address to reach a server listening on cfg from this machine
+func dialAddr(cfg config.Config) string {
+	host := cfg.Addr
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
 	}
+	return net.JoinHostPort(host, fmt.Sprint(cfg.Port))
 }
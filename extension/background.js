@@ -1,5 +1,8 @@
 let ws = null;
 
+// Protocol version spoken with the CLI (see cli/internal/protocol)
+const PROTOCOL_VERSION = 1;
+
 const LOG_LEVEL = __LOG_LEVEL__; 
 
 const LOG_LEVELS = {
@@ -32,31 +35,111 @@ function logWithTimestamp(message, type = 'log') {
   }
 }
 
+// Port cdev listens on, set from the popup to match `cdev --port`
+const DEFAULT_PORT = 32123;
+let serverPort = DEFAULT_PORT;
+
 // Check if the local CLI proxy is available before attempting to connect
 function isServerRunning() {
-  return fetch("http://localhost:32123/ping", { method: "GET" })
+  return fetch(`http://localhost:${serverPort}/ping`, { method: "GET" })
     .then(() => true)
     .catch(() => false);
 }
 
+// Pairing token shown by `cdev pair`, set from the popup
+let pairingToken = "";
+
+// Identity sent to the CLI in the hello message. The client ID is generated
+// once and kept, so `cdev send --target` keeps working across restarts.
+let clientId = "";
+let profileLabel = "";
+
+chrome.storage.local.get(["pairingToken", "clientId", "profileLabel", "serverPort"], (items) => {
+  pairingToken = items.pairingToken || "";
+  serverPort = items.serverPort || DEFAULT_PORT;
+  profileLabel = items.profileLabel || "";
+  clientId = items.clientId;
+  if (!clientId) {
+    clientId = crypto.randomUUID().slice(0, 8);
+    chrome.storage.local.set({ clientId });
+  }
+});
+
+// Best effort browser name from the user agent
+function browserName() {
+  const ua = navigator.userAgent;
+  if (ua.includes("Edg/")) return "Edge";
+  if (ua.includes("OPR/")) return "Opera";
+  if (navigator.brave) return "Brave";
+  if (ua.includes("Chrome/")) return "Chrome";
+  return "Browser";
+}
+
+function sendHello() {
+  sendToCLI({
+    type: "hello",
+    client: {
+      id: clientId,
+      browser: browserName(),
+      profile: profileLabel,
+      version: chrome.runtime.getManifest().version,
+    },
+  });
+}
+
+chrome.storage.onChanged.addListener((changes, area) => {
+  if (area === "local" && changes.profileLabel) {
+    profileLabel = changes.profileLabel.newValue || "";
+    if (ws && ws.readyState === WebSocket.OPEN) sendHello();
+  }
+  if (area === "local" && changes.pairingToken) {
+    pairingToken = changes.pairingToken.newValue || "";
+    logWithTimestamp("🔑 Pairing token updated, reconnecting");
+    if (ws) {
+      ws.close();
+      ws = null;
+    }
+  }
+  if (area === "local" && changes.serverPort) {
+    serverPort = changes.serverPort.newValue || DEFAULT_PORT;
+    logWithTimestamp("🔌 Port changed to " + serverPort + ", reconnecting");
+    if (ws) {
+      ws.close();
+      ws = null;
+    }
+  }
+});
+
 function connectWebSocket() {
   if (ws && (ws.readyState === WebSocket.OPEN || ws.readyState === WebSocket.CONNECTING)) {
     return; // do nothing when it's already connected or connecting
   }
+  if (!pairingToken) {
+    logWithTimestamp("🔑 Not paired yet: paste the token from `cdev pair` into the extension popup", 'warn');
+    return;
+  }
 
-  ws = new WebSocket("ws://localhost:32123/ws");
+  ws = new WebSocket(`ws://localhost:${serverPort}/ws?token=` + encodeURIComponent(pairingToken));
 
   ws.addEventListener("open", () => {
     logWithTimestamp("✅ WebSocket connected to CLI proxy");
+    sendHello();
   });
 
   ws.addEventListener("message", (event) => {
     logWithTimestamp("📬 Message received from CLI: " + event.data);
     try {
-      const { type, prompt } = JSON.parse(event.data);
-      if (type === "chatgpt-prompt") {
+      const { type, id, prompt, sequence } = JSON.parse(event.data);
+      if (type === "prompt" || type === "chatgpt-prompt") {
         logWithTimestamp("📨 Prompt received from CLI: " + prompt);
-        openOrCreateChatGPTTab(prompt);
+        if (id) {
+          sendToCLI({ type: "ack", id });
+        }
+        if (sequence && sequenceTabs.has(sequence)) {
+          sendToSequenceTab(sequenceTabs.get(sequence), prompt, id);
+        } else {
+          openOrCreateChatGPTTab(prompt, id, sequence);
+        }
       }
     } catch (e) {
       logWithTimestamp("❌ Invalid WS message: " + e, 'error');
@@ -86,11 +169,32 @@ setInterval(() => {
       }
     });
   } else if (ws.readyState === WebSocket.OPEN) {
-    ws.send("ping");
+    sendToCLI({ type: "ping" });
     logWithTimestamp("📡 Sent ping to CLI proxy (keep-alive)");
   }
 }, 1000);
 
+// Send a protocol message to the CLI if the socket is open
+function sendToCLI(message) {
+  if (!ws || ws.readyState !== WebSocket.OPEN) {
+    logWithTimestamp("⚠️ Cannot send to CLI, WebSocket is not open", 'warn');
+    return;
+  }
+  ws.send(JSON.stringify({ v: PROTOCOL_VERSION, ...message }));
+}
+
+// Relay replies observed by the content script back to the CLI
+chrome.runtime.onMessage.addListener((message, sender, sendResponse) => {
+  if (message && message.type === "connection-status") {
+    sendResponse({ connected: !!ws && ws.readyState === WebSocket.OPEN, clientId });
+    return;
+  }
+  if (!message || !message.id) return;
+  if (["response-chunk", "response-done", "error"].includes(message.type)) {
+    sendToCLI({ type: message.type, id: message.id, text: message.text, error: message.error });
+  }
+});
+
 // Create a heartbeat alarm to verify the extension is alive
 chrome.runtime.onInstalled.addListener(() => {
   chrome.alarms.create('heartbeat', { periodInMinutes: 1 });
@@ -102,8 +206,41 @@ chrome.alarms.onAlarm.addListener((alarm) => {
   }
 });
 
-// Open or reuse a ChatGPT tab and send the prompt
-function openOrCreateChatGPTTab(prompt) {
+// Tabs holding the conversation of a split prompt, keyed by the sequence ID
+// its parts share. After the first part ChatGPT moves the tab to /c/<id>,
+// so the later parts are sent to the tab rather than to a new chat.
+const sequenceTabs = new Map();
+
+chrome.tabs.onRemoved.addListener((tabId) => {
+  for (const [sequence, id] of sequenceTabs) {
+    if (id === tabId) sequenceTabs.delete(sequence);
+  }
+});
+
+// Send a later part of a sequence to the tab of its conversation
+function sendToSequenceTab(tabId, prompt, id, retries = 20) {
+  chrome.tabs.get(tabId, (tab) => {
+    if (chrome.runtime.lastError || !tab) {
+      logWithTimestamp("⚠️ The ChatGPT tab of the sequence was closed", 'warn');
+      if (id) {
+        sendToCLI({ type: "error", id, error: "the ChatGPT tab of this conversation was closed" });
+      }
+      return;
+    }
+    if (tab.status === "complete") {
+      logWithTimestamp("➡️ Continuing the conversation in tab: " + tabId);
+      chrome.tabs.sendMessage(tabId, { type: "chatgpt-prompt", prompt, id });
+    } else if (retries > 0) {
+      setTimeout(() => sendToSequenceTab(tabId, prompt, id, retries - 1), 500);
+    } else if (id) {
+      sendToCLI({ type: "error", id, error: "ChatGPT tab did not load in time" });
+    }
+  });
+}
+
+// Open or reuse a ChatGPT tab and send the prompt. The tab is remembered for
+// the rest of the sequence, if the prompt is part of one.
+function openOrCreateChatGPTTab(prompt, id, sequence) {
   chrome.tabs.query({}, (tabs) => {
     const existingNewChatPage = tabs.find(tab =>
       tab.url && tab.url === "https://chatgpt.com" && tab.status === "complete"
@@ -111,22 +248,27 @@ function openOrCreateChatGPTTab(prompt) {
 
     if (existingNewChatPage) {
       logWithTimestamp("🟢 Found existing ChatGPT tab: " + existingNewChatPage.id);
-      chrome.tabs.sendMessage(existingNewChatPage.id, { type: "chatgpt-prompt", prompt });
+      if (sequence) sequenceTabs.set(sequence, existingNewChatPage.id);
+      chrome.tabs.sendMessage(existingNewChatPage.id, { type: "chatgpt-prompt", prompt, id });
     } else {
       chrome.tabs.create({ url: "https://chatgpt.com" }, (tab) => {
         const tabId = tab.id;
         logWithTimestamp("🆕 Created new ChatGPT tab: " + tabId);
+        if (sequence) sequenceTabs.set(sequence, tabId);
 
         const checkTabReady = (retries = 20) => {
           if (retries <= 0) {
             logWithTimestamp("⚠️ New ChatGPT tab did not load in time", 'warn');
+            if (id) {
+              sendToCLI({ type: "error", id, error: "ChatGPT tab did not load in time" });
+            }
             return;
           }
 
           chrome.tabs.get(tabId, (updatedTab) => {
             if (updatedTab.status === "complete") {
               logWithTimestamp("✅ ChatGPT tab is ready: " + updatedTab.id);
-              chrome.tabs.sendMessage(updatedTab.id, { type: "chatgpt-prompt", prompt });
+              chrome.tabs.sendMessage(updatedTab.id, { type: "chatgpt-prompt", prompt, id });
             } else {
               setTimeout(() => checkTabReady(retries - 1), 500);
             }
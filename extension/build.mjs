@@ -16,6 +16,8 @@ const replaceInFile = (filePath, placeholder, value) => {
 
 replaceInFile('background.js', '__LOG_LEVEL__', mode === 'prod' ? 'none' : 'log');
 fs.copyFileSync('content.js', path.join(outputDir, 'content.js'));
+fs.copyFileSync('popup.html', path.join(outputDir, 'popup.html'));
+fs.copyFileSync('popup.js', path.join(outputDir, 'popup.js'));
 fs.cpSync('icon', path.join(outputDir, 'icon'), { recursive: true });
 
 console.log(`✅ Build complete for ${mode}`);
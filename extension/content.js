@@ -25,6 +25,7 @@ chrome.runtime.onMessage.addListener((message) => {
     console.log("🧠 content.js received prompt:", message.prompt);
 
     waitForInputBox().then((inputBox) => {
+      const previousReplies = assistantMessages().length;
       setTimeout(() => {
         inputBox.focus();
         const html = message.prompt
@@ -45,6 +46,10 @@ chrome.runtime.onMessage.addListener((message) => {
             keyCode: 13,
             which: 13
           }));
+
+          if (message.id) {
+            watchResponse(message.id, previousReplies);
+          }
         }, 1000);
       })
       // Important: fire `input` event
@@ -60,10 +65,58 @@ chrome.runtime.onMessage.addListener((message) => {
       //     which: 13
       //   }));
       // }, 1000);
+    }).catch((err) => {
+      if (message.id) {
+        chrome.runtime.sendMessage({ type: "error", id: message.id, error: err.message });
+      }
     })
   }
 });
 
+// Replies rendered by ChatGPT, oldest first
+function assistantMessages() {
+  return document.querySelectorAll('[data-message-author-role="assistant"]');
+}
+
+function isGenerating() {
+  return !!document.querySelector('button[data-testid="stop-button"]');
+}
+
+// Stream the reply to the prompt `id` back to the CLI. Chunks carry only the
+// appended text; response-done carries the full reply.
+function watchResponse(id, previousReplies, interval = 500, timeout = 60000) {
+  const started = Date.now();
+  let lastText = "";
+  let stableTicks = 0;
+
+  const timer = setInterval(() => {
+    const replies = assistantMessages();
+    if (replies.length <= previousReplies) {
+      if (Date.now() - started > timeout) {
+        clearInterval(timer);
+        chrome.runtime.sendMessage({ type: "error", id, error: "ChatGPT did not start replying" });
+      }
+      return;
+    }
+
+    const text = replies[replies.length - 1].innerText;
+    if (text !== lastText) {
+      if (text.startsWith(lastText)) {
+        chrome.runtime.sendMessage({ type: "response-chunk", id, text: text.slice(lastText.length) });
+      }
+      lastText = text;
+      stableTicks = 0;
+      return;
+    }
+
+    // Done once generation stopped and the text settled
+    if (!isGenerating() && ++stableTicks >= 3) {
+      clearInterval(timer);
+      chrome.runtime.sendMessage({ type: "response-done", id, text });
+    }
+  }, interval);
+}
+
 function waitForInputBox(retries = 10, delay = 500) {
   return new Promise((resolve, reject) => {
     const tryFind = () => {
@@ -0,0 +1,52 @@
+const tokenInput = document.getElementById("token");
+const statusLine = document.getElementById("status");
+const profileInput = document.getElementById("profile");
+const clientLine = document.getElementById("client");
+const portInput = document.getElementById("port");
+
+function showStatus() {
+  chrome.runtime.sendMessage({ type: "connection-status" }, (response) => {
+    if (chrome.runtime.lastError || !response) return;
+    statusLine.textContent = response.connected ? "✅ Connected to cdev" : "🔌 Not connected to cdev";
+    if (response.clientId) {
+      clientLine.textContent = "Client ID (for cdev send --target): " + response.clientId;
+    }
+  });
+}
+
+chrome.storage.local.get(["pairingToken", "profileLabel", "serverPort"], ({ pairingToken, profileLabel, serverPort }) => {
+  tokenInput.value = pairingToken || "";
+  profileInput.value = profileLabel || "";
+  portInput.value = serverPort || "";
+});
+
+document.getElementById("savePort").addEventListener("click", () => {
+  const value = portInput.value.trim();
+  const port = Number(value);
+  if (value !== "" && !(Number.isInteger(port) && port >= 1 && port <= 65535)) {
+    statusLine.textContent = "The port must be a number from 1 to 65535";
+    return;
+  }
+  // An empty port goes back to the default
+  const save = value === "" ? chrome.storage.local.remove("serverPort") : chrome.storage.local.set({ serverPort: port });
+  save.then(() => {
+    statusLine.textContent = "Port saved, connecting...";
+    setTimeout(showStatus, 1500);
+  });
+});
+
+document.getElementById("saveProfile").addEventListener("click", () => {
+  chrome.storage.local.set({ profileLabel: profileInput.value.trim() }, () => {
+    statusLine.textContent = "Label saved";
+  });
+});
+
+document.getElementById("save").addEventListener("click", () => {
+  const pairingToken = tokenInput.value.trim();
+  chrome.storage.local.set({ pairingToken }, () => {
+    statusLine.textContent = "Saved, connecting...";
+    setTimeout(showStatus, 1500);
+  });
+});
+
+showStatus();